@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/jobs"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+func commands() []*command {
+	return []*command{
+		crawlCommand(),
+		backfillCommand(),
+		parseAnnouncementsCommand(),
+		parseBoardCommand(),
+		parseShareholdingCommand(),
+		downloadAttachmentsCommand(),
+		extractTextCommand(),
+		extractTablesCommand(),
+		extractAnnualCommand(),
+		parseTableCommand(),
+		importPeopleCommand(),
+		reconcileCommand(),
+		runsCommand(),
+		configShowCommand(),
+	}
+}
+
+func crawlCommand() *command {
+	return &command{
+		name:    "crawl",
+		stage:   "crawler",
+		summary: "Fetch announcements newer than the crawl ledger",
+		network: true,
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			return jobs.Crawl(ctx, log, run, cfg, database, jobs.Backfill{})
+		},
+	}
+}
+
+func backfillCommand() *command {
+	var bf jobs.Backfill
+
+	return &command{
+		name:    "backfill",
+		stage:   "crawler",
+		summary: "Fetch an explicit range or list of ann_ids",
+		network: true,
+		flags:   bf.RegisterFlags,
+		check: func() error {
+			if !bf.Enabled() {
+				return errors.New("one of -from, -to, -ids or -since-date is required")
+			}
+			return nil
+		},
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			return jobs.Crawl(ctx, log, run, cfg, database, bf)
+		},
+	}
+}
+
+func parseAnnouncementsCommand() *command {
+	return &command{
+		name:    "parse announcements",
+		stage:   "parser",
+		summary: "Parse the stored page of every unparsed announcement",
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			_, err := jobs.ParseAnnouncements(ctx, log, run, cfg, database)
+			return err
+		},
+	}
+}
+
+func parseBoardCommand() *command {
+	return &command{
+		name:    "parse board",
+		stage:   "parser-board",
+		summary: "Parse change in boardroom announcements and link directors to entities",
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			_, err := jobs.ParseBoardroomChanges(ctx, log, run, cfg, database)
+			return err
+		},
+	}
+}
+
+func parseShareholdingCommand() *command {
+	var link bool
+
+	return &command{
+		name:    "parse shareholding",
+		stage:   "parser-sholder",
+		summary: "Parse shareholding change announcements and link shareholders to entities",
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&link, "link", true, "Link individual shareholders to entities after parsing")
+		},
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			if _, err := jobs.ParseShareholdingChanges(ctx, log, run, cfg, database); err != nil {
+				return err
+			}
+			if !link {
+				return nil
+			}
+			return jobs.LinkShareholders(ctx, log, run, database)
+		},
+	}
+}
+
+func downloadAttachmentsCommand() *command {
+	return &command{
+		name:    "download attachments",
+		stage:   "parser-att",
+		summary: "Download the attachments of recent announcements",
+		network: true,
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			_, err := jobs.DownloadAttachments(ctx, log, run, cfg, database)
+			return err
+		},
+	}
+}
+
+func extractTextCommand() *command {
+	return &command{
+		name:    "extract text",
+		summary: "Extract the page text of downloaded PDF attachments",
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			_, err := jobs.ExtractAttachmentText(ctx, log, run, cfg, database)
+			return err
+		},
+	}
+}
+
+func extractTablesCommand() *command {
+	return &command{
+		name:    "extract tables",
+		summary: "Read the tables of downloaded spreadsheet and CSV attachments",
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			_, err := jobs.ParseAttachmentTables(ctx, log, run, cfg, database)
+			return err
+		},
+	}
+}
+
+func extractAnnualCommand() *command {
+	return &command{
+		name:    "extract annual",
+		stage:   "ext-annual",
+		summary: "Extract people and shareholder records from annual report text",
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			_, err := jobs.ExtractAnnualReports(ctx, log, run, cfg, database)
+			return err
+		},
+	}
+}
+
+func parseTableCommand() *command {
+	var file, category string
+
+	return &command{
+		name:    "parse table",
+		summary: "Print the records read from a spreadsheet or CSV attachment as JSON",
+		offline: true,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&file, "file", "", "The .xlsx or .csv file to read")
+			fs.StringVar(&category, "category", "", "Announcement category, e.g. Share Buy Back; detected from the header when empty")
+		},
+		check: func() error {
+			if file == "" {
+				return errors.New("-file is required")
+			}
+			return nil
+		},
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			records, err := services.ParseTableAttachment(file, category)
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(records)
+		},
+	}
+}
+
+func importPeopleCommand() *command {
+	var input string
+
+	return &command{
+		name:    "import people",
+		stage:   "import-people",
+		summary: "Import people and corporate profiles from the extraction CSVs",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&input, "input", "input", "Directory of the ext_*.csv files")
+		},
+		check: func() error {
+			if input == "" {
+				return errors.New("-input is required")
+			}
+			return nil
+		},
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			return jobs.ImportPeople(ctx, log, run, database, input)
+		},
+	}
+}
+
+func reconcileCommand() *command {
+	return &command{
+		name:    "reconcile",
+		stage:   "cleaner-board",
+		summary: "Rebuild entity roles from the boardroom changes of merged entities",
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			return jobs.ReconcileBoardRoles(ctx, log, run, database)
+		},
+	}
+}
+
+func runsCommand() *command {
+	var (
+		name  string
+		limit int
+	)
+
+	return &command{
+		name:    "runs",
+		summary: "List recent runs from the job_runs ledger",
+		report:  true,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&name, "command", "", "Only list runs of this command, e.g. parser-sholder")
+			fs.IntVar(&limit, "limit", 20, "Max runs to list")
+		},
+		check: func() error {
+			if limit <= 0 {
+				return errors.New("-limit must be positive")
+			}
+			return nil
+		},
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			runs, err := db.FetchJobRuns(ctx, database, name, limit)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tCOMMAND\tSTATUS\tSTARTED\tDURATION\tFETCHED\tPARSED\tFAILED\tSKIPPED\tERROR")
+			for _, r := range runs {
+				duration := "-"
+				if r.FinishedAt != nil {
+					duration = r.FinishedAt.Sub(r.StartedAt).Round(time.Second).String()
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n",
+					r.ID, r.Command, r.Status, r.StartedAt.Format("2006-01-02 15:04"), duration,
+					r.Fetched, r.Parsed, r.Failed, r.Skipped, utils.Truncate(utils.StringValue(r.ErrorSummary), 60))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func configShowCommand() *command {
+	var section string
+
+	c := &command{
+		name:    "config show",
+		summary: "Print the effective configuration with secrets redacted",
+		offline: true,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&section, "command", "", "Show the configuration as seen by this command, e.g. parser-board")
+		},
+		run: func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error {
+			return cfg.WriteYAML(os.Stdout)
+		},
+	}
+	c.sectionFor = func() string { return section }
+	return c
+}
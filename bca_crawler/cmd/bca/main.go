@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"bca_crawler/internal/archive"
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/jobs"
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// single entry point for the crawl, parse and import commands
+
+// command is one bca subcommand. Each gets its own flag set on top of the
+// shared configuration flags.
+type command struct {
+	name    string
+	summary string
+	// network commands fetch from Bursa and need the announcement URLs
+	network bool
+	// offline commands run without the database
+	offline bool
+	// report commands only read, and are left out of the job_runs ledger
+	report bool
+	// sectionFor overrides section, for commands without a stage
+	sectionFor func() string
+	// stage names the command in logs, the job_runs ledger and the config
+	// file when it differs from section; it matches the standalone binary and
+	// scheduler stage, so both entry points record the same name and read the
+	// same config file section.
+	stage string
+	flags func(fs *flag.FlagSet)
+	check func() error
+	run   func(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB) error
+}
+
+func main() {
+	cmds := commands()
+
+	args := os.Args[1:]
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		if len(args) > 1 {
+			if c, _ := lookup(cmds, args[1:]); c != nil {
+				fs, _ := c.flagSet(os.Stdout)
+				fs.Usage()
+				return
+			}
+		}
+		usage(os.Stdout, cmds)
+		return
+	}
+
+	c, rest := lookup(cmds, args)
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "bca: unknown command %q\n\n", strings.Join(args, " "))
+		usage(os.Stderr, cmds)
+		os.Exit(2)
+	}
+
+	os.Exit(c.execute(rest))
+}
+
+// lookup matches the longest command name at the start of args, so both
+// "crawl" and "parse board" resolve.
+func lookup(cmds []*command, args []string) (*command, []string) {
+	for n := min(2, len(args)); n > 0; n-- {
+		name := strings.Join(args[:n], " ")
+		for _, c := range cmds {
+			if c.name == name {
+				return c, args[n:]
+			}
+		}
+	}
+	return nil, nil
+}
+
+func usage(w io.Writer, cmds []*command) {
+	fmt.Fprintf(w, "Usage: bca <command> [flags]\n\nCommands:\n")
+	for _, c := range cmds {
+		fmt.Fprintf(w, "  %-22s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nRun \"bca help <command>\" for the flags of a command.\n")
+}
+
+// flagSet builds the command's flag set, which also carries the shared
+// configuration flags.
+func (c *command) flagSet(output io.Writer) (*flag.FlagSet, *utils.ConfigFlags) {
+	fs := flag.NewFlagSet("bca "+c.name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	cfg := utils.RegisterConfigFlags(fs)
+	if c.flags != nil {
+		c.flags(fs)
+	}
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bca %s [flags]\n\n%s\n\nFlags:\n", c.name, c.summary)
+		fs.PrintDefaults()
+	}
+	return fs, cfg
+}
+
+// section is the name of the command with spaces turned into dashes, e.g.
+// "extract-text", unless sectionFor overrides it.
+func (c *command) section() string {
+	if c.sectionFor != nil {
+		return c.sectionFor()
+	}
+	return strings.ReplaceAll(c.name, " ", "-")
+}
+
+// stageName is the name of the command in logs, the job_runs ledger and the
+// config file, e.g. "parser-board" for "bca parse board".
+func (c *command) stageName() string {
+	if c.stage != "" {
+		return c.stage
+	}
+	return c.section()
+}
+
+// execute parses and validates args, sets up logging, the raw archive and the
+// database, then runs the command. It returns the process exit code.
+func (c *command) execute(args []string) int {
+	fs, cfgFlags := c.flagSet(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "bca %s: unexpected arguments %q\n", c.name, fs.Args())
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := cfgFlags.Load(c.stageName())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bca %s: %v\n", c.name, err)
+		return 2
+	}
+	if err := cfg.Validate(c.network); err != nil {
+		fmt.Fprintf(os.Stderr, "bca %s: %v\n", c.name, err)
+		return 2
+	}
+	if c.check != nil {
+		if err := c.check(); err != nil {
+			fmt.Fprintf(os.Stderr, "bca %s: %v\n", c.name, err)
+			fs.Usage()
+			return 2
+		}
+	}
+
+	if c.offline {
+		if err := c.run(context.Background(), utils.Logger, nil, cfg, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "bca %s: %v\n", c.name, err)
+			return 1
+		}
+		return 0
+	}
+
+	// Initialize logger
+	utils.InitLogger(cfg)
+	log := utils.Logger
+
+	ctx, stop := utils.SignalContext()
+	defer stop()
+
+	// Expose Prometheus metrics (optional)
+	metrics.Serve(cfg.MetricsAddr)
+
+	// Open the raw page archive (optional)
+	if err := archive.Init(cfg.ArchiveDir); err != nil {
+		log.Errorf("[Error] Failed to open raw archive: %v", err)
+		return 1
+	}
+
+	// Setup database
+	database, err := db.Setup(cfg.DBPath, db.DriverType(cfg.DBDriver))
+	if err != nil {
+		log.Errorf("[Error] Failed to setup DB: %v", err)
+		return 1
+	}
+	defer database.Close()
+	db.ConfigurePool(database, cfg)
+
+	stageLog := log.WithField(utils.FieldStage, c.stageName())
+
+	var run *jobs.Run
+	if !c.report {
+		run = jobs.StartRun(ctx, stageLog, database, c.stageName(), os.Args[1:])
+	}
+
+	err = c.run(ctx, stageLog, run, cfg, database)
+	if run != nil {
+		run.Finish(err)
+	}
+	if err != nil {
+		log.Errorf("[Error] %s failed: %v", c.name, err)
+		return 1
+	}
+	return 0
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -9,10 +10,10 @@ import (
 	"bca_crawler/internal/utils"
 )
 
-func cleaner_excel_entity() {
-	data_exhist, err := db.FetchExHist(database)
-	data_entity, err := db.FetchEntity(database)
-	data_board, err := db.FetchBoardChanges(database)
+func cleaner_excel_entity(ctx context.Context) {
+	data_exhist, err := db.FetchExHist(ctx, database)
+	data_entity, err := db.FetchEntity(ctx, database)
+	data_board, err := db.FetchBoardChanges(ctx, database)
 
 	if err != nil {
 		panic(fmt.Sprintf("❌ Failed to fetch DB: %v", err))
@@ -163,7 +164,7 @@ func cleaner_excel_entity() {
 
 	updated := 0
 	for i := range toInsertList {
-		err := db.UpdateBoardroomChange(database, &toInsertList[i])
+		err := db.UpdateBoardroomChange(ctx, database, &toInsertList[i])
 		if err != nil {
 			log.Errorf("❌ Entity insert failed for ann_id %s: %v", utils.StringValue(toInsertList[i].PersonName), err)
 			continue
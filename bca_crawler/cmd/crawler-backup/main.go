@@ -1,12 +1,13 @@
 package main
 
 import (
-	"strconv"
-	"strings"
-	"time"
+	"os"
 
+	"bca_crawler/internal/archive"
 	"bca_crawler/internal/db"
-	"bca_crawler/internal/models"
+	"bca_crawler/internal/jobs"
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/retry"
 	"bca_crawler/internal/services"
 	"bca_crawler/internal/utils"
 )
@@ -14,18 +15,6 @@ import (
 // crawler for missing announcement IDs
 
 func main() {
-	retryTriggers := []string{
-		"Web server is returning an unknown error",
-		"SSL handshake failed",
-		"A timeout occurred",
-		"Just a moment",
-		"Connection timed out",
-		"Internal server error",
-		"you have been blocked",
-		"SYSTEM MAINTENANCE NOTICE",
-		"HTML file is not found",
-	}
-
 	// Load configuration
 	cfg, err := utils.LoadCfg()
 	if err != nil {
@@ -33,85 +22,65 @@ func main() {
 	}
 
 	// Initialize logger with level from config
-	utils.InitLogger()
+	utils.InitLogger(cfg)
 	log := utils.Logger
 
+	ctx, stop := utils.SignalContext()
+	defer stop()
+
+	// Expose Prometheus metrics (optional)
+	metrics.Serve(cfg.MetricsAddr)
+
+	// Open the raw page archive (optional)
+	if err := archive.Init(cfg.ArchiveDir); err != nil {
+		log.Fatalf("[Error] Failed to open raw archive: %v", err)
+	}
+
 	// Setup database
-	database, err := db.Connect(cfg.DBPath, db.DriverType(cfg.DBDriver))
+	database, err := db.Setup(cfg.DBPath, db.DriverType(cfg.DBDriver))
 	if err != nil {
 		log.Fatalf("[Error] Failed to setup DB: %v", err)
 	}
 	defer database.Close()
 
-	// Load Bursa main page
-	chromeCtx, cancel := services.InitCtx(cfg.UserAgent)
-	defer cancel()
+	stageLog := log.WithField(utils.FieldStage, "crawler-backup")
+	run := jobs.StartRun(ctx, stageLog, database, "crawler-backup", os.Args[1:])
 
-	data, err := db.FetchMissingAnnID(database)
+	claims, err := jobs.OpenClaims(ctx, stageLog, database, cfg, jobs.QueueCrawl)
+	if err != nil {
+		log.Fatalf("[Error] Failed to open the crawl queue: %v", err)
+	}
+	defer claims.Close()
+
+	if _, err := db.SyncCrawlLedger(ctx, database); err != nil {
+		log.Fatalf("Failed to sync crawl ledger: %v", err)
+	}
+
+	data, err := db.FetchMissingAnnID(ctx, database)
 	if err != nil {
 		log.Fatalf("Failed to fetch missing announcement IDs: %v", err)
 	}
 
-	for _, id := range data {
-		annID := strconv.Itoa(id)
-		url := cfg.DetailDomain + cfg.DetailURL + annID
-		log.Infof("Processing announcement ID: %s", annID)
-
-		var html string
-		var err error
-		maxRetries := 3
-
-		for attempt := 1; attempt <= maxRetries; attempt++ {
-			html, err = services.RunPage(chromeCtx, &url)
-
-			shouldRetry := false
-			if err != nil {
-				if strings.Contains(err.Error(), "net::ERR_SOCKET_NOT_CONNECTED") {
-					shouldRetry = true
-				} else {
-					for _, trigger := range retryTriggers {
-						if strings.Contains(err.Error(), trigger) {
-							shouldRetry = true
-							break
-						}
-					}
-				}
-			} else {
-				for _, trigger := range retryTriggers {
-					if strings.Contains(html, trigger) {
-						shouldRetry = true
-						break
-					}
-				}
-			}
-
-			if !shouldRetry {
-				break
-			}
-
-			log.Warnf("Retrying ID %d (attempt %d/%d)...", id, attempt, maxRetries)
-			time.Sleep(3 * time.Second)
-		}
-		if err != nil {
-			log.Errorf("[Error] Failed to load ID %d: %v", id, err)
-			continue
-		}
-		if strings.Contains(html, "HTML file is not found") {
-			log.Warnf("Announcement ID %d not found (404). Skipping.", id)
-			continue
-		}
-
-		a := &models.Announcement{
-			AnnID:   int(id),
-			Link:    url,
-			Content: html,
-		}
-		if err := db.SaveAnnouncement(database, a); err != nil {
-			log.Errorf("[Error] Failed to save ID %d: %v", id, err)
-		} else {
-			log.Infof("Saved announcement ID %d", id)
-		}
+	log.Infof("Found %d missing or due announcement IDs", len(data))
+
+	// Load Bursa main page
+	fetchers, err := services.NewFetchers(cfg, stageLog)
+	if err != nil {
+		log.Fatalf("[Error] Failed to create fetchers: %v", err)
 	}
+	defer services.CloseFetchers(fetchers)
 
-	log.Info("Done scraping all announcements.")
+	err = claims.Crawl(ctx, run, fetchers, cfg, data)
+	run.Finish(err)
+	if err != nil && ctx.Err() == nil {
+		log.Errorf("[Error] Crawl failed: %v", err)
+	}
+
+	log.Infof("Fetch outcomes: %s", retry.Metrics)
+	for _, b := range retry.Breakers() {
+		log.Infof("Circuit breaker: %s", b)
+	}
+	if err == nil {
+		log.Info("Done scraping all announcements.")
+	}
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"bca_crawler/internal/archive"
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/jobs"
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/retry"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// historical backfill of every announcement of one stock through the
+// company-filtered announcement search
+
+func main() {
+	stockCode := flag.String("stock", "", "Stock code to backfill (must be in the stocks table)")
+	restart := flag.Bool("restart", false, "Discard saved progress and search from the first page")
+	maxPages := flag.Int("max-pages", 0, "Max search pages per run (0 = no limit)")
+
+	// Load configuration
+	cfg, err := utils.LoadCfg()
+	if err != nil {
+		panic(err)
+	}
+
+	// Initialize logger
+	utils.InitLogger(cfg)
+	log := utils.Logger
+
+	ctx, stop := utils.SignalContext()
+	defer stop()
+
+	// Expose Prometheus metrics (optional)
+	metrics.Serve(cfg.MetricsAddr)
+
+	if *stockCode == "" {
+		log.Fatal("[Error] -stock is required")
+	}
+
+	// Open the raw page archive (optional)
+	if err := archive.Init(cfg.ArchiveDir); err != nil {
+		log.Fatalf("[Error] Failed to open raw archive: %v", err)
+	}
+
+	// Setup database
+	database, err := db.Setup(cfg.DBPath, db.DriverType(cfg.DBDriver))
+	if err != nil {
+		log.Fatalf("[Error] Failed to setup DB: %v", err)
+	}
+	defer database.Close()
+
+	stageLog := log.WithFields(logrus.Fields{utils.FieldStage: "crawler-company", utils.FieldStockCode: *stockCode})
+	run := jobs.StartRun(ctx, stageLog, database, "crawler-company", os.Args[1:])
+
+	err = backfill(ctx, stageLog, run, cfg, database, *stockCode, *restart, *maxPages)
+	run.Finish(err)
+	if err != nil && ctx.Err() == nil {
+		log.Fatalf("[Error] Backfill of %s failed: %v", *stockCode, err)
+	}
+}
+
+// backfill runs one pass of the backfill of stockCode. Progress is saved page
+// by page, so an interrupted backfill keeps its status and resumes on the
+// next run; any other error marks the backfill failed.
+func backfill(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB, stockCode string, restart bool, maxPages int) error {
+	stock, err := db.FetchStockByCode(ctx, database, stockCode)
+	if err != nil {
+		return fmt.Errorf("fetch stock: %w", err)
+	}
+	if stock == nil {
+		return fmt.Errorf("stock %s is not in the stocks table", stockCode)
+	}
+
+	progress, err := db.StartStockBackfill(ctx, database, stock.StockCode, restart)
+	if err != nil {
+		return fmt.Errorf("load backfill progress: %w", err)
+	}
+	if progress.Status == models.BackfillDone {
+		log.Infof("Backfill of %s already finished (%d/%d fetched). Use -restart to run it again.",
+			stock.StockCode, progress.Fetched, progress.Listed)
+		return nil
+	}
+
+	fetchers, err := services.NewFetchers(cfg, log)
+	if err != nil {
+		return fmt.Errorf("create fetchers: %w", err)
+	}
+	defer services.CloseFetchers(fetchers)
+
+	fail := func(err error) error {
+		if ctx.Err() != nil {
+			log.Warnf("Backfill of %s interrupted; run again to resume.", stock.StockCode)
+			return ctx.Err()
+		}
+		if ferr := db.FinishStockBackfill(ctx, database, stock.StockCode, models.BackfillFailed, utils.PtrString(err.Error())); ferr != nil {
+			log.Errorf("[Error] Failed to record backfill failure: %v", ferr)
+		}
+		return err
+	}
+
+	// 1. Page through the company search, resuming after the last saved page
+	if progress.Status != models.BackfillFetching {
+		// Bursa filters the search by its own company id when we have it
+		company := stock.StockCode
+		if stock.BursaID != nil {
+			company = strconv.Itoa(int(*stock.BursaID))
+		}
+
+		startPage := progress.LastPage + 1
+		log.Infof("Searching announcements of %s from page %d", stock.StockCode, startPage)
+
+		q := services.ListingQuery{Company: company}
+		n, complete, err := services.CrawlListing(ctx, log, fetchers[0], cfg, q, startPage, maxPages, func(page int, rows []*models.Announcement) error {
+			if err := db.SaveListedAnnouncements(ctx, database, rows); err != nil {
+				return err
+			}
+
+			ids := make([]int, len(rows))
+			for i, r := range rows {
+				ids[i] = r.AnnID
+			}
+			return db.RecordBackfillPage(ctx, database, stock.StockCode, page, ids)
+		})
+		if err != nil {
+			return fail(err)
+		}
+
+		log.Infof("Found %d announcements of %s", n, stock.StockCode)
+
+		if !complete {
+			log.Infof("Stopped after %d pages; run again to continue the search.", maxPages)
+			return nil
+		}
+
+		if err := db.SetStockBackfillStatus(ctx, database, stock.StockCode, models.BackfillFetching); err != nil {
+			return fail(err)
+		}
+	}
+
+	// 2. Fetch every discovered announcement that is not stored yet
+	claims, err := jobs.OpenClaims(ctx, log, database, cfg, jobs.QueueCrawl)
+	if err != nil {
+		return fail(err)
+	}
+	defer claims.Close()
+
+	pending, err := db.FetchBackfillPending(ctx, database, stock.StockCode)
+	if err != nil {
+		return fail(err)
+	}
+
+	log.Infof("Fetching %d announcements of %s", len(pending), stock.StockCode)
+	if err := claims.Crawl(ctx, run, fetchers, cfg, pending); err != nil {
+		return fail(err)
+	}
+
+	remaining, err := db.FetchBackfillPending(ctx, database, stock.StockCode)
+	if err != nil {
+		return fail(err)
+	}
+
+	status, lastErr := models.BackfillDone, (*string)(nil)
+	if len(remaining) > 0 {
+		status = models.BackfillFetching
+		lastErr = utils.PtrString(fmt.Sprintf("%d announcements still pending", len(remaining)))
+	}
+	if err := db.FinishStockBackfill(ctx, database, stock.StockCode, status, lastErr); err != nil {
+		log.Errorf("[Error] Failed to record backfill progress: %v", err)
+	}
+
+	log.Infof("Fetch outcomes: %s", retry.Metrics)
+	log.Infof("Backfill of %s: %s (%d pending)", stock.StockCode, status, len(remaining))
+	return nil
+}
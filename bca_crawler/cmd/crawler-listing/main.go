@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"bca_crawler/internal/archive"
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/jobs"
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/retry"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// crawler for the announcement listing: stores row metadata first, then
+// fetches detail pages by category priority
+
+func main() {
+	today := time.Now().Format("2006-01-02")
+	fromDate := flag.String("from-date", today, "First listing date (YYYY-MM-DD)")
+	toDate := flag.String("to-date", today, "Last listing date (YYYY-MM-DD)")
+	categories := flag.String("categories", "", "Listing category filters as CODE=Label, comma separated (default: all)")
+	maxPages := flag.Int("max-pages", 100, "Max listing pages per category (0 = no limit)")
+	details := flag.Bool("details", true, "Fetch detail pages of newly listed announcements")
+	priority := flag.String("priority", "Change in Boardroom,Pursuant", "Categories whose detail pages are fetched first, comma separated")
+
+	// Load configuration
+	cfg, err := utils.LoadCfg()
+	if err != nil {
+		panic(err)
+	}
+
+	// Initialize logger
+	utils.InitLogger(cfg)
+	log := utils.Logger
+
+	ctx, stop := utils.SignalContext()
+	defer stop()
+
+	// Expose Prometheus metrics (optional)
+	metrics.Serve(cfg.MetricsAddr)
+
+	from, err := time.Parse("2006-01-02", *fromDate)
+	if err != nil {
+		log.Fatalf("[Error] Invalid -from-date %q: %v", *fromDate, err)
+	}
+	to, err := time.Parse("2006-01-02", *toDate)
+	if err != nil {
+		log.Fatalf("[Error] Invalid -to-date %q: %v", *toDate, err)
+	}
+
+	// Open the raw page archive (optional)
+	if err := archive.Init(cfg.ArchiveDir); err != nil {
+		log.Fatalf("[Error] Failed to open raw archive: %v", err)
+	}
+
+	// Setup database
+	database, err := db.Setup(cfg.DBPath, db.DriverType(cfg.DBDriver))
+	if err != nil {
+		log.Fatalf("[Error] Failed to setup DB: %v", err)
+	}
+	defer database.Close()
+
+	stageLog := log.WithField(utils.FieldStage, "crawler-listing")
+	run := jobs.StartRun(ctx, stageLog, database, "crawler-listing", os.Args[1:])
+
+	fetchers, err := services.NewFetchers(cfg, stageLog)
+	if err != nil {
+		log.Fatalf("[Error] Failed to create fetchers: %v", err)
+	}
+	defer services.CloseFetchers(fetchers)
+
+	cats := services.ParseListingCategories(*categories)
+	if len(cats) == 0 {
+		cats = []services.ListingCategory{{}}
+	}
+
+	listed := 0
+	for _, cat := range cats {
+		if ctx.Err() != nil {
+			break
+		}
+
+		q := services.ListingQuery{From: from, To: to, Category: cat}
+
+		n, _, err := services.CrawlListing(ctx, stageLog, fetchers[0], cfg, q, 1, *maxPages, func(_ int, rows []*models.Announcement) error {
+			return db.SaveListedAnnouncements(ctx, database, rows)
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Errorf("[Error] Listing crawl failed for category %q: %v", cat.Code, err)
+			run.Failed(fmt.Errorf("listing %q: %w", cat.Code, err))
+		}
+
+		log.Infof("Listed %d announcements for category %q", n, cat.Code)
+		listed += n
+	}
+
+	log.Infof("Listed %d announcements between %s and %s", listed, *fromDate, *toDate)
+
+	if *details && ctx.Err() == nil {
+		if err := crawlListed(ctx, stageLog, run, cfg, database, fetchers, splitList(*priority)); err != nil && ctx.Err() == nil {
+			log.Errorf("[Error] Failed to fetch listed announcement detail pages: %v", err)
+			run.Failed(fmt.Errorf("detail pages: %w", err))
+		}
+	}
+
+	log.Infof("Fetch outcomes: %s", retry.Metrics)
+	run.Finish(ctx.Err())
+	log.Info("Done crawling the announcement listing.")
+}
+
+// crawlListed fetches the detail pages of listed announcements in priority
+// order, sharing them through the crawl queue with other hosts.
+func crawlListed(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config, database *sqlx.DB, fetchers []services.Fetcher, priority []string) error {
+	claims, err := jobs.OpenClaims(ctx, log, database, cfg, jobs.QueueCrawl)
+	if err != nil {
+		return err
+	}
+	defer claims.Close()
+
+	ids, err := db.FetchListedAnnIDs(ctx, database, priority)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Fetching %d listed announcement detail pages", len(ids))
+	return claims.Crawl(ctx, run, fetchers, cfg, ids)
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
-	"bca_crawler/internal/services"
-	"bca_crawler/internal/utils"
-	"net/http"
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/jobs"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/sirupsen/logrus"
 )
 
 // crawler for market statistics
@@ -20,17 +26,43 @@ func main() {
 	}
 
 	// Initialize logger
-	utils.InitLogger()
+	utils.InitLogger(cfg)
 	log := utils.Logger
 
-	// Load Bursa main page using Chromedp
-	chromeCtx, cancel := services.InitCtx(cfg.UserAgent)
-	defer cancel()
+	ctx, stop := utils.SignalContext()
+	defer stop()
+
+	// Setup database
+	database, err := db.Setup(cfg.DBPath, db.DriverType(cfg.DBDriver))
+	if err != nil {
+		log.Fatalf("[Error] Failed to setup DB: %v", err)
+	}
+	defer database.Close()
+
+	stageLog := log.WithField(utils.FieldStage, "crawler-mkt")
+	run := jobs.StartRun(ctx, stageLog, database, "crawler-mkt", os.Args[1:])
 
-	body, err := services.RunPage(chromeCtx, &cfg.StartURL)
+	err = crawl(ctx, stageLog, run, cfg)
+	run.Finish(err)
+	if err != nil && ctx.Err() == nil {
+		log.Fatalf("[Error] Market statistics crawl failed: %v", err)
+	}
+}
+
+// crawl downloads today's market statistics files linked from the Bursa
+// start page.
+func crawl(ctx context.Context, log logrus.FieldLogger, run *jobs.Run, cfg *utils.Config) error {
+	// Load Bursa main page
+	fetcher, err := services.NewFetcher(cfg, log)
+	if err != nil {
+		return fmt.Errorf("create fetcher: %w", err)
+	}
+
+	// The fetcher is only needed for the start page
+	body, err := fetcher.Fetch(ctx, cfg.StartURL)
+	fetcher.Close()
 	if err != nil {
-		log.Fatalf("[Error] Failed to load start page: %v", err)
-		return
+		return fmt.Errorf("load start page: %w", err)
 	}
 
 	// Parse HTML with GoQuery
@@ -39,8 +71,7 @@ func main() {
 	var miscURLs []string
 	allURLs, err := services.GetURLs(body)
 	if err != nil {
-		log.Fatalf("[Error] Failed to parse HTML: %v", err)
-		return
+		return fmt.Errorf("parse HTML: %w", err)
 	}
 
 	// Deduplicate allURLs
@@ -55,7 +86,7 @@ func main() {
 
 	if len(allURLs) == 0 {
 		log.Warn("[Error] No Bursa attachment URLs found.")
-		return
+		return nil
 	}
 
 	for _, href := range allURLs {
@@ -68,22 +99,42 @@ func main() {
 	today := time.Now().Format("20060102")
 	baseDir := filepath.Join("ms", today)
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
-		log.Fatalf("[Error] Failed to create directory %s: %v", baseDir, err)
+		return fmt.Errorf("create directory %s: %w", baseDir, err)
 	}
 	log.Infof("📂 Download directory: %s", baseDir)
 
-	client := &http.Client{
-		Timeout: 60 * time.Second,
+	downloader, err := services.NewDownloader(cfg, log)
+	if err != nil {
+		return fmt.Errorf("create downloader: %w", err)
 	}
+	defer downloader.Close()
 
+	reqs := make([]services.DownloadRequest, len(miscURLs))
 	for i, fileURL := range miscURLs {
-		err := utils.DownloadFile(client, cfg, fileURL, baseDir)
-		if err == nil {
-			log.Infof("[%d/%d] ⬇️ Downloaded: %s", i+1, len(miscURLs), fileURL)
-		} else {
-			log.Warnf("⚠️ Failed to download %s: %v", fileURL, err)
+		reqs[i] = services.DownloadRequest{URL: fileURL, Path: services.PartPath(baseDir, fileURL)}
+	}
+
+	done := 0
+	downloader.DownloadAll(ctx, reqs, func(res *services.Download) {
+		if res.Err == nil {
+			res.Err = os.Rename(res.Path, filepath.Join(baseDir, res.Filename))
+		}
+		if res.Err != nil {
+			if ctx.Err() == nil {
+				log.Warnf("⚠️ Failed to download %s: %v", res.URL, res.Err)
+				run.Failed(fmt.Errorf("download %s: %w", res.URL, res.Err))
+			}
+			return
 		}
+		done++
+		run.Fetched(1)
+		log.Infof("[%d/%d] ⬇️ Downloaded: %s", done, len(miscURLs), res.URL)
+	})
+	if ctx.Err() != nil {
+		log.Warnf("Interrupted after %d/%d files.", done, len(miscURLs))
+		return ctx.Err()
 	}
 
 	log.Infof("🏁 Download complete. Files saved under %s", baseDir)
+	return nil
 }
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"strings"
-	"time"
 
 	"bca_crawler/internal/db"
+	"bca_crawler/internal/jobs"
 	"bca_crawler/internal/models"
+	"bca_crawler/internal/retry"
 	"bca_crawler/internal/services"
 	"bca_crawler/internal/utils"
 
@@ -22,9 +26,12 @@ func main() {
 	}
 
 	// Initialize logger with level from config
-	utils.InitLogger()
+	utils.InitLogger(cfg)
 	log := utils.Logger
 
+	ctx, stop := utils.SignalContext()
+	defer stop()
+
 	// Setup database
 	database, err := db.Connect(cfg.DBPath, db.DriverType(cfg.DBDriver))
 	if err != nil {
@@ -32,10 +39,14 @@ func main() {
 	}
 	defer database.Close()
 
+	stageLog := log.WithField(utils.FieldStage, "crawler-roc")
+	run := jobs.StartRun(ctx, stageLog, database, "crawler-roc", os.Args[1:])
+	defer run.Finish(nil)
+
 	// -------------------------------------------------------------------------
 	// 3️⃣ Fetch rows to process
 	// -------------------------------------------------------------------------
-	data, err := db.FetchStockList(database)
+	data, err := db.FetchStockList(ctx, database)
 	if err != nil {
 		log.Fatalf("❌ Failed to fetch stock list: %v", err)
 	}
@@ -50,96 +61,115 @@ func main() {
 	})
 
 	// Load main page
-	chromeCtx, cancel := services.InitCtx(cfg.UserAgent)
-	defer cancel()
+	pool, err := services.NewBrowserPool(cfg.UserAgent, services.BrowserPoolOptions{
+		Size:           1,
+		MaxNavigations: cfg.BrowserMaxNavigations,
+		AcquireTimeout: cfg.BrowserAcquireTimeout,
+		PageTimeout:    cfg.BrowserPageTimeout,
+		Log:            stageLog,
+	})
+	if err != nil {
+		log.Fatalf("[Error] Failed to start browser: %v", err)
+	}
+	defer pool.Close()
 
 	url := "https://businessreport.ctoscredit.com.my/oneoffreport/search-result-page"
 
-	for _, stock := range result {
-		log.Infof("Processing stock: %s", stock.StockCode)
+	policy := retry.NewPolicy(cfg)
+	policy.Log = stageLog
+	breaker := retry.NewBreaker(cfg)
+	if breaker != nil {
+		breaker.Log = stageLog
+	}
+	breakerGen := 0
+
+	for i := 0; i < len(result); i++ {
+		stock := result[i]
 
-		var html string
-		var err error
-		maxRetries := 3
-		retryTriggers := []string{
-			"Web server is returning an unknown error",
-			"SSL handshake failed",
-			"A timeout occurred",
-			"Just a moment",
-			"Connection timed out",
-			"Internal server error",
-			"you have been blocked",
-			"SYSTEM MAINTENANCE NOTICE",
-			"HTML file is not found",
+		if ctx.Err() != nil {
+			log.Warnf("Interrupted before %s; the remaining stocks are left for the next run.", stock.StockCode)
+			break
 		}
 
-		for attempt := 1; attempt <= maxRetries; attempt++ {
-			searchTerm := ""
-			if stock.Name != nil {
-				searchTerm = *stock.Name
+		if breaker != nil {
+			if err := breaker.Allow(ctx); err != nil {
+				log.Errorf("[Error] Stopping at %s: %v", stock.StockCode, err)
+				break
 			}
-			html, err = services.RunRocSearch(chromeCtx, &url, searchTerm)
-
-			if html != "" {
-				regNum := services.GetRegNum(html)
-				if regNum != "" {
-					log.Infof("✅ Found Registration Number: %s for %s", regNum, stock.StockCode)
-
-					parts := strings.Split(regNum, "/")
-					var oldReg, newReg string
-					if len(parts) == 2 {
-						oldReg = strings.TrimSpace(parts[0])
-						newReg = strings.TrimSpace(parts[1])
-						log.Infof("Old Reg No: %s, New Reg No: %s", oldReg, newReg)
-					} else {
-						// Fallback if there's no '/' separator
-						newReg = strings.TrimSpace(regNum)
-						log.Infof("Reg No: %s (Single part found)", newReg)
-					}
-
-					if err := db.UpdateStockRegNumbers(database, stock.ID, newReg, oldReg); err != nil {
-						log.Errorf("❌ Failed to update DB for %s: %v", stock.StockCode, err)
-					} else {
-						log.Infof("✅ Updated DB for %s", stock.StockCode)
-					}
-				} else {
-					log.Warnf("⚠️ Could not find Registration Number in results for %s", stock.StockCode)
+			if gen := breaker.Generation(); gen != breakerGen {
+				breakerGen = gen
+				if err := pool.Restart(pool.Generation()); err != nil {
+					log.Errorf("[Error] Failed to restart browser: %v", err)
 				}
 			}
+		}
 
-			shouldRetry := false
-			if err != nil {
-				if strings.Contains(err.Error(), "net::ERR_SOCKET_NOT_CONNECTED") {
-					shouldRetry = true
-				} else {
-					for _, trigger := range retryTriggers {
-						if strings.Contains(err.Error(), trigger) {
-							shouldRetry = true
-							break
-						}
-					}
-				}
-			} else {
-				for _, trigger := range retryTriggers {
-					if strings.Contains(html, trigger) {
-						shouldRetry = true
-						break
-					}
-				}
-			}
+		log.Infof("Processing stock: %s", stock.StockCode)
 
-			if !shouldRetry {
-				break
-			}
+		searchTerm := ""
+		if stock.Name != nil {
+			searchTerm = *stock.Name
+		}
 
-			log.Warnf("Retrying (attempt %d/%d)...", attempt, maxRetries)
-			time.Sleep(3 * time.Second)
+		html, outcome, err := policy.Do(ctx, stock.StockCode, func() (string, error) {
+			return pool.Do(ctx, func(ctx context.Context) (string, error) {
+				return services.RunRocSearch(ctx, log, &url, searchTerm)
+			})
+		})
+		if breaker != nil && breaker.Record(outcome) {
+			// Search this stock again once the cooldown is over
+			i--
+			continue
+		}
+		if ctx.Err() != nil {
+			continue
 		}
 		if err != nil {
 			log.Errorf("[Error] Failed to load: %v", err)
+			run.Failed(fmt.Errorf("%s: %w", stock.StockCode, err))
+			continue
+		}
+		if outcome.Class != retry.OK {
+			log.Errorf("[Error] Search rejected for %s: %s", stock.StockCode, outcome.Reason)
+			run.Failed(fmt.Errorf("%s: search rejected: %s", stock.StockCode, outcome.Reason))
 			continue
 		}
+		run.Fetched(1)
+
+		regNum := services.GetRegNum(html)
+		if regNum == "" {
+			log.Warnf("⚠️ Could not find Registration Number in results for %s", stock.StockCode)
+			run.Skipped(1)
+			continue
+		}
+
+		log.Infof("✅ Found Registration Number: %s for %s", regNum, stock.StockCode)
+
+		parts := strings.Split(regNum, "/")
+		var oldReg, newReg string
+		if len(parts) == 2 {
+			oldReg = strings.TrimSpace(parts[0])
+			newReg = strings.TrimSpace(parts[1])
+			log.Infof("Old Reg No: %s, New Reg No: %s", oldReg, newReg)
+		} else {
+			// Fallback if there's no '/' separator
+			newReg = strings.TrimSpace(regNum)
+			log.Infof("Reg No: %s (Single part found)", newReg)
+		}
+
+		if err := db.UpdateStockRegNumbers(ctx, database, stock.ID, newReg, oldReg); err != nil {
+			log.Errorf("❌ Failed to update DB for %s: %v", stock.StockCode, err)
+			run.Failed(fmt.Errorf("%s: update: %w", stock.StockCode, err))
+		} else {
+			log.Infof("✅ Updated DB for %s", stock.StockCode)
+			run.Parsed(1)
+		}
 	}
 
+	log.Infof("Fetch outcomes: %s", retry.Metrics)
+	if breaker != nil {
+		log.Infof("Circuit breaker: %s", breaker)
+	}
+	run.Finish(ctx.Err())
 	log.Info("Done scraping all announcements.")
 }
@@ -1,19 +1,22 @@
 package main
 
 import (
-	"strconv"
-	"strings"
-	"time"
+	"flag"
+	"os"
 
+	"bca_crawler/internal/archive"
 	"bca_crawler/internal/db"
-	"bca_crawler/internal/models"
-	"bca_crawler/internal/services"
+	"bca_crawler/internal/jobs"
+	"bca_crawler/internal/metrics"
 	"bca_crawler/internal/utils"
 )
 
 // main crawler for announcements
 
 func main() {
+	var bf jobs.Backfill
+	bf.RegisterFlags(flag.CommandLine)
+
 	// Load configuration
 	cfg, err := utils.LoadCfg()
 	if err != nil {
@@ -21,123 +24,33 @@ func main() {
 	}
 
 	// Initialize logger with level from config
-	utils.InitLogger()
+	utils.InitLogger(cfg)
 	log := utils.Logger
 
-	// Setup database
-	database, err := db.Connect(cfg.DBPath, db.DriverType(cfg.DBDriver))
-	if err != nil {
-		log.Fatalf("[Error] Failed to setup DB: %v", err)
-	}
-	defer database.Close()
-
-	// Load Bursa main page
-	chromeCtx, cancel := services.InitCtx(cfg.UserAgent)
-	defer cancel()
+	ctx, stop := utils.SignalContext()
+	defer stop()
 
-	body, err := services.RunPage(chromeCtx, &cfg.StartURL)
-	if err != nil {
-		log.Fatalf("[Error] Failed to load start page: %v", err)
-		return
-	}
+	// Expose Prometheus metrics (optional)
+	metrics.Serve(cfg.MetricsAddr)
 
-	log.Info("Page loaded successfully, parsing announcements...")
-	maxID := services.GetMaxAnnID(body)
-	if maxID == 0 {
-		log.Warn("No announcements found. Exiting.")
-		return
+	// Open the raw page archive (optional)
+	if err := archive.Init(cfg.ArchiveDir); err != nil {
+		log.Fatalf("[Error] Failed to open raw archive: %v", err)
 	}
 
-	log.Infof("Parsed announcements. Max ann_id: %d", maxID)
-
-	startID := 1
-
-	// Fetch existing announcements to determine starting ID
-	data, err := db.GetMaxAnnID(database)
+	// Setup database
+	database, err := db.Setup(cfg.DBPath, db.DriverType(cfg.DBDriver))
 	if err != nil {
-		log.Infof("[Error] Failed to fetch max ann_id from DB: %v", err)
-	} else {
-		if int64(data) >= int64(maxID) {
-			log.Info("Database is already up-to-date. No new announcements to scrape.")
-			return
-		}
-
-		startID = int(data) + 1
+		log.Fatalf("[Error] Failed to setup DB: %v", err)
 	}
+	defer database.Close()
 
-	log.Infof("Starting from ann_id: %d", startID)
-
-	for i := startID; i <= maxID; i++ {
-		annID := strconv.Itoa(i)
-		url := cfg.DetailDomain + cfg.DetailURL + annID
-		log.Infof("Processing announcement ID: %s", annID)
-
-		var html string
-		var err error
-		maxRetries := 3
-		retryTriggers := []string{
-			"Web server is returning an unknown error",
-			"SSL handshake failed",
-			"A timeout occurred",
-			"Just a moment",
-			"Connection timed out",
-			"Internal server error",
-			"you have been blocked",
-			"SYSTEM MAINTENANCE NOTICE",
-			"HTML file is not found",
-		}
-
-		for attempt := 1; attempt <= maxRetries; attempt++ {
-			html, err = services.RunPage(chromeCtx, &url)
-
-			shouldRetry := false
-			if err != nil {
-				if strings.Contains(err.Error(), "net::ERR_SOCKET_NOT_CONNECTED") {
-					shouldRetry = true
-				} else {
-					for _, trigger := range retryTriggers {
-						if strings.Contains(err.Error(), trigger) {
-							shouldRetry = true
-							break
-						}
-					}
-				}
-			} else {
-				for _, trigger := range retryTriggers {
-					if strings.Contains(html, trigger) {
-						shouldRetry = true
-						break
-					}
-				}
-			}
-
-			if !shouldRetry {
-				break
-			}
-
-			log.Warnf("Retrying ID %d (attempt %d/%d)...", i, attempt, maxRetries)
-			time.Sleep(3 * time.Second)
-		}
-		if err != nil {
-			log.Errorf("[Error] Failed to load ID %d: %v", i, err)
-			continue
-		}
-		if strings.Contains(html, "HTML file is not found") {
-			log.Warnf("Announcement ID %d not found (404). Skipping.", i)
-			continue
-		}
+	stageLog := log.WithField(utils.FieldStage, "crawler")
+	run := jobs.StartRun(ctx, stageLog, database, "crawler", os.Args[1:])
 
-		a := &models.Announcement{
-			AnnID:   i,
-			Link:    url,
-			Content: html,
-		}
-		if err := db.SaveAnnouncement(database, a); err != nil {
-			log.Errorf("[Error] Failed to save ID %d: %v", i, err)
-		} else {
-			log.Infof("Saved announcement ID %d", i)
-		}
+	err = jobs.Crawl(ctx, stageLog, run, cfg, database, bf)
+	run.Finish(err)
+	if err != nil {
+		log.Fatalf("[Error] Crawl failed: %v", err)
 	}
-
-	log.Info("Done scraping all announcements.")
 }
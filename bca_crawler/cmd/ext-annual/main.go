@@ -1,21 +1,31 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"bca_crawler/internal/db"
+	"bca_crawler/internal/jobs"
 	"bca_crawler/internal/utils"
 )
 
-func main() {
-	// 1. Initialize Logger
-	utils.InitLogger()
-	log := utils.Logger
+// extractor for director, company secretary and substantial shareholder
+// records in annual reports
 
-	// 2. Load Configuration
+func main() {
+	// 1. Load Configuration
 	cfg, err := utils.LoadCfg()
 	if err != nil {
-		log.Fatalf("❌ Failed to load config: %v", err)
+		panic(fmt.Sprintf("❌ Failed to load config: %v", err))
 	}
 
+	// 2. Initialize Logger
+	utils.InitLogger(cfg)
+	log := utils.Logger
+
+	ctx, stop := utils.SignalContext()
+	defer stop()
+
 	// 3. Connect to Database
 	database, err := db.Connect(cfg.DBPath, db.DriverType(cfg.DBDriver))
 	if err != nil {
@@ -23,4 +33,14 @@ func main() {
 	}
 	defer database.Close()
 
+	// 4. Extract the annual reports whose attachment text is stored
+	stageLog := log.WithField(utils.FieldStage, "ext-annual")
+	run := jobs.StartRun(ctx, stageLog, database, "ext-annual", os.Args[1:])
+
+	_, err = jobs.ExtractAnnualReports(ctx, stageLog, run, cfg, database)
+	run.Finish(err)
+	if err != nil {
+		log.Errorf("❌ %v", err)
+		os.Exit(1)
+	}
 }
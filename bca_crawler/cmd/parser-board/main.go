@@ -2,12 +2,11 @@ package main
 
 import (
 	"fmt"
-	"strconv"
-	"strings"
+	"os"
 
+	"bca_crawler/internal/archive"
 	"bca_crawler/internal/db"
-	"bca_crawler/internal/models"
-	"bca_crawler/internal/services"
+	"bca_crawler/internal/jobs"
 	"bca_crawler/internal/utils"
 
 	"github.com/jmoiron/sqlx"
@@ -28,8 +27,16 @@ func main() {
 	}
 
 	// Initialize logger
-	utils.InitLogger()
-	log.Infof("🔧 Configuration loaded: %+v", *cfg)
+	utils.InitLogger(cfg)
+	log.Infof("🔧 Configuration loaded: %+v", cfg.Redacted())
+
+	ctx, stop := utils.SignalContext()
+	defer stop()
+
+	// Open the raw page archive (optional)
+	if err := archive.Init(cfg.ArchiveDir); err != nil {
+		log.Fatalf("❌ Failed to open raw archive: %v", err)
+	}
 
 	// -------------------------------------------------------------------------
 	// 2️⃣ Connect to Database
@@ -40,62 +47,12 @@ func main() {
 	}
 	defer database.Close()
 
-	// -------------------------------------------------------------------------
-	// 3️⃣ Fetch rows to process
-	// -------------------------------------------------------------------------
-	data, err := db.FetchAnnouncementsByCategory(database, "Change in Boardroom")
-	if err != nil {
-		log.Fatalf("❌ Failed to fetch change in boardroom announcements: %v", err)
-	}
-
-	if len(data) == 0 {
-		log.Info("⚠️ No change in boardroom announcements found. Exiting.")
-		return
-	}
-
-	updated := 0
-	for i := range data {
-		ann := data[i]
-		annID := strconv.Itoa(ann.AnnID)
-
-		change, err := services.ParseBoardroomChangeHTML(ann)
-		if err != nil {
-			log.Warnf("⚠️ Parse failed for ann_id %s: %v", annID, err)
-			continue
-		}
-
-		title, name := utils.SplitTitle(utils.StringValue(change.PersonName))
-
-		entity := &models.Entity{
-			DisplayName: utils.PtrString(strings.TrimSpace(title + " " + name)),
-			OriName:     change.PersonName,
-			Name:        &name,
-			Salutation:  &title,
-			StockCode:   change.StockCode,
-			BirthYear:   change.PersonBirthYear,
-			Gender:      change.PersonGender,
-			Nationality: change.PersonNationality,
-			CreatedAt:   *change.DateAnnounced,
-		}
-
-		permID, err := services.GetOrCreateEntity(log, database, entity, &change.Background)
-		if err != nil {
-			log.Errorf("❌ Entity lookup/creation failed for ann_id %s: %v", annID, err)
-			continue
-		}
+	stageLog := log.WithField(utils.FieldStage, "parser-board")
+	run := jobs.StartRun(ctx, stageLog, database, "parser-board", os.Args[1:])
 
-		change.RelatedPerm = permID
-		change.PersonTitle = &title
-		change.PersonName = &name
-
-		err = db.UpdateBoardroomChange(database, change)
-		if err != nil {
-			log.Errorf("❌ Boardroom change update failed for ann_id %s: %v", annID, err)
-			continue
-		}
-
-		updated++
-
-		log.Infof("🏁 Done. Updated %d records.", updated)
+	_, err = jobs.ParseBoardroomChanges(ctx, stageLog, run, cfg, database)
+	run.Finish(err)
+	if err != nil {
+		log.Fatalf("❌ Parse failed: %v", err)
 	}
 }
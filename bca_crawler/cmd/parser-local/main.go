@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"bca_crawler/internal/db"
+	"bca_crawler/internal/jobs"
 	"bca_crawler/internal/models"
 	"bca_crawler/internal/services"
 	"bca_crawler/internal/utils"
@@ -22,9 +23,12 @@ func main() {
 		panic(fmt.Sprintf("❌ Failed to load config: %v", err))
 	}
 
-	utils.InitLogger()
+	utils.InitLogger(cfg)
 	log := utils.Logger
-	log.Infof("🔧 Configuration loaded: %+v", *cfg)
+
+	ctx, stop := utils.SignalContext()
+	defer stop()
+	log.Infof("🔧 Configuration loaded: %+v", cfg.Redacted())
 
 	// -------------------------------------------------------------------------
 	// 2️⃣ Connect to Database
@@ -35,6 +39,9 @@ func main() {
 	}
 	defer database.Close()
 
+	run := jobs.StartRun(ctx, log.WithField(utils.FieldStage, "parser-local"), database, "parser-local", os.Args[1:])
+	defer run.Finish(nil)
+
 	// -------------------------------------------------------------------------
 	// 3️⃣ Determine Input Folder (Default: ./CA)
 	// -------------------------------------------------------------------------
@@ -79,6 +86,7 @@ func main() {
 		content, err := os.ReadFile(path)
 		if err != nil {
 			log.Warnf("⚠️ Failed to read file %s: %v", path, err)
+			run.Failed(err)
 			continue
 		}
 
@@ -86,6 +94,7 @@ func main() {
 		annIDInt, err := strconv.Atoi(annID)
 		if err != nil {
 			log.Warnf("⚠️ Invalid AnnID %s: %v", annID, err)
+			run.Skipped(1)
 			continue
 		}
 
@@ -99,18 +108,21 @@ func main() {
 		// ---------------------------------------------------------------------
 		if err := services.ParseAnnouncementHTML(ann); err != nil {
 			log.Warnf("⚠️ Parse failed for %s: %v", annID, err)
+			run.Failed(fmt.Errorf("ann_id %s: parse: %w", annID, err))
 			continue
 		}
 
 		// -------------------------------------------------------------------------
 		// 5️⃣ Update Announcement in DB
 		// -------------------------------------------------------------------------
-		if err := db.UpdateAnnouncement(database, ann); err != nil {
+		if err := db.UpdateAnnouncement(ctx, log, database, ann); err != nil {
 			log.Errorf("❌ Update failed for ann_id %s: %v", annID, err)
+			run.Failed(fmt.Errorf("ann_id %s: update: %w", annID, err))
 			continue
 		}
 
 		parsed++
+		run.Parsed(1)
 	}
 
 	log.Infof("🏁 Done. Updated %d records.", parsed)
@@ -2,10 +2,11 @@ package main
 
 import (
 	"fmt"
-	"strconv"
+	"os"
 
+	"bca_crawler/internal/archive"
 	"bca_crawler/internal/db"
-	"bca_crawler/internal/services"
+	"bca_crawler/internal/jobs"
 	"bca_crawler/internal/utils"
 )
 
@@ -21,9 +22,17 @@ func main() {
 	}
 
 	// Initialize logger
-	utils.InitLogger()
+	utils.InitLogger(cfg)
 	log := utils.Logger
-	log.Infof("🔧 Configuration loaded: %+v", *cfg)
+
+	ctx, stop := utils.SignalContext()
+	defer stop()
+	log.Infof("🔧 Configuration loaded: %+v", cfg.Redacted())
+
+	// Open the raw page archive (optional)
+	if err := archive.Init(cfg.ArchiveDir); err != nil {
+		log.Fatalf("❌ Failed to open raw archive: %v", err)
+	}
 
 	// -------------------------------------------------------------------------
 	// 2️⃣ Connect to Database
@@ -34,43 +43,12 @@ func main() {
 	}
 	defer database.Close()
 
-	// -------------------------------------------------------------------------
-	// 3️⃣ Fetch rows to process
-	// -------------------------------------------------------------------------
-	data, err := db.FetchUnparsedAnnouncements(database)
-	if err != nil {
-		log.Fatalf("❌ Failed to fetch unparsed announcements: %v", err)
-	}
-
-	if len(data) == 0 {
-		log.Info("⚠️ No unparsed announcements found. Exiting.")
-		return
-	}
-
-	updated := 0
-	for i := range data {
-		ann := data[i]
-		annID := strconv.Itoa(ann.AnnID)
-		log.Infof("Processing ann_id %s", annID)
-
-		// -------------------------------------------------------------------------
-		// 4️⃣ Parse Announcement HTML
-		// -------------------------------------------------------------------------
-		if err := services.ParseAnnouncementHTML(ann); err != nil {
-			log.Warnf("⚠️ Parse failed for ann_id %s: %v", annID, err)
-			continue
-		}
+	stageLog := log.WithField(utils.FieldStage, "parser")
+	run := jobs.StartRun(ctx, stageLog, database, "parser", os.Args[1:])
 
-		// -------------------------------------------------------------------------
-		// 5️⃣ Update Announcement in DB
-		// -------------------------------------------------------------------------
-		if err := db.UpdateAnnouncement(database, ann); err != nil {
-			log.Errorf("❌ Update failed for ann_id %s: %v", annID, err)
-			continue
-		}
-
-		updated++
+	_, err = jobs.ParseAnnouncements(ctx, stageLog, run, cfg, database)
+	run.Finish(err)
+	if err != nil {
+		log.Fatalf("❌ Parse failed: %v", err)
 	}
-
-	log.Infof("🏁 Done. Updated %d records.", updated)
 }
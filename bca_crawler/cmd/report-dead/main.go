@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/utils"
+)
+
+// report of announcement IDs confirmed dead by the crawl ledger
+
+func main() {
+	from := flag.String("from", time.Now().AddDate(0, 0, -30).Format("2006-01-02"), "Start date (YYYY-MM-DD), inclusive")
+	to := flag.String("to", time.Now().Format("2006-01-02"), "End date (YYYY-MM-DD), inclusive")
+
+	// Load configuration
+	cfg, err := utils.LoadCfg()
+	if err != nil {
+		panic(err)
+	}
+
+	// Initialize logger
+	utils.InitLogger(cfg)
+	log := utils.Logger
+
+	ctx, stop := utils.SignalContext()
+	defer stop()
+
+	fromDate, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		log.Fatalf("[Error] Invalid -from date %q: %v", *from, err)
+	}
+	toDate, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		log.Fatalf("[Error] Invalid -to date %q: %v", *to, err)
+	}
+
+	// Setup database
+	database, err := db.Setup(cfg.DBPath, db.DriverType(cfg.DBDriver))
+	if err != nil {
+		log.Fatalf("[Error] Failed to setup DB: %v", err)
+	}
+	defer database.Close()
+
+	dead, err := db.FetchDeadAnnouncements(ctx, database, fromDate, toDate.AddDate(0, 0, 1))
+	if err != nil {
+		log.Fatalf("[Error] Failed to fetch dead announcements: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ANN_ID\tSTATUS\tATTEMPTS\tAPPROX_DATE\tDEAD_AT")
+	for _, d := range dead {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n",
+			d.AnnID, d.Status, d.Attempts, utils.FormatDate(d.ApproxDate), d.DeadAt.Format("2006-01-02 15:04"))
+	}
+	w.Flush()
+
+	log.Infof("🏁 %d dead announcement IDs between %s and %s", len(dead), *from, *to)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/scheduler"
+	"bca_crawler/internal/utils"
+)
+
+// long-running daemon that runs the crawl and parse stages on their schedule,
+// one at a time, and chains each stage into the ones depending on it; the
+// parser also runs as soon as new announcements are stored, alongside the crawl
+
+// schedulerLockKey is the Postgres advisory lock that keeps a single
+// scheduler running against a database.
+const schedulerLockKey int64 = 0x62636173636864 // "bcaschd"
+
+func main() {
+	stagesFile := flag.String("stages", "", "JSON file of stages (default: crawler, then parser, then parser-board, parser-sholder and parser-att)")
+	binDir := flag.String("bin-dir", "./bin", "Directory of the bca and crawler-backup binaries used by the default stages")
+	holidaysFile := flag.String("holidays", os.Getenv("HOLIDAYS_FILE"), "Bursa holiday calendar, one YYYY-MM-DD per line")
+	poll := flag.Duration("poll", time.Minute, "How often to check for newly stored announcements (0 = never)")
+
+	// Load configuration
+	cfg, err := utils.LoadCfg()
+	if err != nil {
+		panic(err)
+	}
+
+	// Initialize logger
+	utils.InitLogger(cfg)
+	log := utils.Logger
+
+	// Expose Prometheus metrics (optional)
+	metrics.Serve(cfg.MetricsAddr)
+
+	stages := scheduler.DefaultStages(*binDir)
+	if *stagesFile != "" {
+		stages, err = scheduler.LoadStages(*stagesFile)
+		if err != nil {
+			log.Fatalf("[Error] Failed to load stages: %v", err)
+		}
+	}
+
+	calendar, err := scheduler.LoadCalendar(*holidaysFile)
+	if err != nil {
+		log.Fatalf("[Error] Failed to load holiday calendar: %v", err)
+	}
+
+	sched, err := scheduler.New(stages, calendar)
+	if err != nil {
+		log.Fatalf("[Error] Invalid stages: %v", err)
+	}
+
+	// Setup database
+	database, err := db.Setup(cfg.DBPath, db.DriverType(cfg.DBDriver))
+	if err != nil {
+		log.Fatalf("[Error] Failed to setup DB: %v", err)
+	}
+	defer database.Close()
+
+	ctx, stop := utils.SignalContext()
+	defer stop()
+
+	lock, err := db.TryAdvisoryLock(ctx, database, schedulerLockKey)
+	if err != nil {
+		log.Fatalf("[Error] Failed to take scheduler lock: %v", err)
+	}
+	if lock == nil {
+		log.Fatal("[Error] Another scheduler is already running against this database")
+	}
+	defer lock.Release()
+
+	if *poll > 0 {
+		// Only stored pages count: rows the listing crawler saved with
+		// metadata only have nothing to parse yet
+		lastID, err := db.GetMaxStoredAnnID(ctx, database)
+		if err != nil {
+			log.Fatalf("[Error] Failed to fetch max ann_id: %v", err)
+		}
+
+		sched.PollInterval = *poll
+		sched.NewData = func() (bool, error) {
+			maxID, err := db.GetMaxStoredAnnID(ctx, database)
+			if err != nil {
+				return false, err
+			}
+			if maxID <= lastID {
+				return false, nil
+			}
+			log.Infof("New announcements up to ann_id %d", maxID)
+			lastID = maxID
+			return true, nil
+		}
+	}
+
+	log.Infof("Scheduler started with %d stages", len(stages))
+	if err := sched.Run(ctx); err != nil {
+		log.Errorf("[Error] Scheduler stopped: %v", err)
+	}
+	log.Info("Scheduler stopped")
+}
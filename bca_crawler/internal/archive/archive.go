@@ -0,0 +1,120 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Default is the archive used by the crawler and parsers. It is nil until
+// Init is called with a directory.
+var Default *Store
+
+// Init opens the archive at dir as Default. An empty dir leaves the archive
+// disabled and pages are kept in announcements.content as before.
+func Init(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	s, err := New(dir)
+	if err != nil {
+		return err
+	}
+	Default = s
+	return nil
+}
+
+// Store keeps raw pages gzip-compressed on disk under their SHA-256, so each
+// distinct version of a page is stored once.
+type Store struct {
+	dir string
+}
+
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Path returns where the page with the given hash is stored, sharded by the
+// first two bytes of the hash, e.g. "ab/cd/abcd....html.gz".
+func (s *Store) Path(sum string) string {
+	if len(sum) < 4 {
+		return filepath.Join(s.dir, sum+".html.gz")
+	}
+	return filepath.Join(s.dir, sum[:2], sum[2:4], sum+".html.gz")
+}
+
+// Put stores data and returns its hex SHA-256. Storing the same content
+// again is a no-op.
+func (s *Store) Put(data []byte) (string, error) {
+	h := sha256.Sum256(data)
+	sum := hex.EncodeToString(h[:])
+
+	path := s.Path(sum)
+	if _, err := os.Stat(path); err == nil {
+		return sum, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %w", filepath.Dir(path), err)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return "", fmt.Errorf("compress %s: %w", sum, err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("compress %s: %w", sum, err)
+	}
+
+	// Write to a temp file and rename, so a crash never leaves a truncated
+	// page under a valid hash
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("write %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("rename %s: %w", path, err)
+	}
+
+	return sum, nil
+}
+
+// Get loads and decompresses the page with the given hash.
+func (s *Store) Get(sum string) ([]byte, error) {
+	f, err := os.Open(s.Path(sum))
+	if err != nil {
+		return nil, fmt.Errorf("archive: open %s: %w", sum, err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("archive: decompress %s: %w", sum, err)
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("archive: read %s: %w", sum, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/people"
+)
+
+// FetchPendingAnnualReports returns the annual report announcements with
+// extracted attachment text that were not recorded in annual_reports yet.
+func FetchPendingAnnualReports(ctx context.Context, db *sqlx.DB) ([]*models.AnnualReport, error) {
+	var reports []*models.AnnualReport
+	err := db.SelectContext(ctx, &reports, `
+	SELECT a.ann_id, COALESCE(a.company_name, '') AS company_name, a.date_posted
+	FROM announcements a
+	WHERE (a.category ILIKE '%annual report%' OR a.title ILIKE '%annual report%')
+	AND EXISTS (
+		SELECT 1 FROM attachment_extractions e
+		WHERE e.ann_id = a.ann_id AND e.status = $1
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM annual_reports r WHERE r.ann_id = a.ann_id
+	)
+	ORDER BY a.ann_id ASC`, models.TextExtracted)
+	if err != nil {
+		return nil, fmt.Errorf("query pending annual reports: %w", err)
+	}
+	return reports, nil
+}
+
+// SaveAnnualReport persists the records extracted from report and records
+// it in annual_reports in one transaction, so a report is never imported
+// twice or half.
+func SaveAnnualReport(ctx context.Context, db *sqlx.DB, report *models.AnnualReport, store *people.DataStore) error {
+	defer metrics.ObserveDBWrite("save_annual_report", time.Now())
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := store.PersistTx(ctx, tx); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+	INSERT INTO annual_reports (ann_id, people, secretaries, shareholders)
+	VALUES ($1, $2, $3, $4)`,
+		report.AnnID, len(store.People), len(store.CompanySecretaries), len(store.SubShareholders)); err != nil {
+		return fmt.Errorf("record annual report %d: %w", report.AnnID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
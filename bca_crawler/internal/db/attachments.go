@@ -0,0 +1,271 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/utils"
+)
+
+const attachmentColumns = `id, ann_id, url, filename, mime, size, sha256, storage_path,
+	status, attempts, last_error, downloaded_at, created_at, updated_at`
+
+// FetchStoredAttachment returns a downloaded manifest row for url, preferring
+// the one of annID, or nil when url was never downloaded.
+func FetchStoredAttachment(ctx context.Context, db *sqlx.DB, annID int, url string) (*models.Attachment, error) {
+	var a models.Attachment
+	err := db.GetContext(ctx, &a, `
+	SELECT `+attachmentColumns+`
+	FROM announcement_attachments
+	WHERE url = $1 AND status = $2
+	ORDER BY ann_id = $3 DESC, id ASC
+	LIMIT 1`, url, models.AttachmentDownloaded, annID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query attachment %s: %w", url, err)
+	}
+	return &a, nil
+}
+
+// FetchAttachmentBySHA256 returns the first downloaded manifest row with the
+// given content hash, or nil when there is none.
+func FetchAttachmentBySHA256(ctx context.Context, db *sqlx.DB, sum string) (*models.Attachment, error) {
+	var a models.Attachment
+	err := db.GetContext(ctx, &a, `
+	SELECT `+attachmentColumns+`
+	FROM announcement_attachments
+	WHERE sha256 = $1 AND status = $2
+	ORDER BY id ASC
+	LIMIT 1`, sum, models.AttachmentDownloaded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query attachment by sha256: %w", err)
+	}
+	return &a, nil
+}
+
+// SaveAttachment upserts the manifest row of (a.AnnID, a.URL). A failed
+// download only records the error in last_error, keeping the status and
+// file of an earlier successful download.
+func SaveAttachment(ctx context.Context, db *sqlx.DB, a *models.Attachment) error {
+	defer metrics.ObserveDBWrite("save_attachment", time.Now())
+
+	_, err := db.ExecContext(ctx, `
+	INSERT INTO announcement_attachments (
+		ann_id, url, filename, mime, size, sha256, storage_path,
+		status, attempts, last_error, downloaded_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8::text, 1, $9,
+		CASE WHEN $8::text = 'downloaded' THEN NOW() END)
+	ON CONFLICT (ann_id, url)
+	DO UPDATE SET
+		filename = CASE WHEN EXCLUDED.status = 'downloaded' THEN EXCLUDED.filename ELSE announcement_attachments.filename END,
+		mime = CASE WHEN EXCLUDED.status = 'downloaded' THEN EXCLUDED.mime ELSE announcement_attachments.mime END,
+		size = CASE WHEN EXCLUDED.status = 'downloaded' THEN EXCLUDED.size ELSE announcement_attachments.size END,
+		sha256 = CASE WHEN EXCLUDED.status = 'downloaded' THEN EXCLUDED.sha256 ELSE announcement_attachments.sha256 END,
+		storage_path = CASE WHEN EXCLUDED.status = 'downloaded' THEN EXCLUDED.storage_path ELSE announcement_attachments.storage_path END,
+		downloaded_at = COALESCE(EXCLUDED.downloaded_at, announcement_attachments.downloaded_at),
+		status = CASE WHEN announcement_attachments.status = 'downloaded' THEN announcement_attachments.status ELSE EXCLUDED.status END,
+		attempts = announcement_attachments.attempts + 1,
+		last_error = EXCLUDED.last_error,
+		updated_at = NOW()`,
+		a.AnnID, a.URL, a.Filename, a.MIME, a.Size, a.SHA256, a.StoragePath, a.Status, a.LastError)
+	if err != nil {
+		return fmt.Errorf("save attachment %d %s: %w", a.AnnID, a.URL, err)
+	}
+	return nil
+}
+
+// FetchPendingTextAttachments returns the downloaded PDF attachments whose
+// text was not extracted from their current content yet, leaving out those
+// that already failed maxAttempts times.
+func FetchPendingTextAttachments(ctx context.Context, db *sqlx.DB, maxAttempts int) ([]*models.Attachment, error) {
+	var atts []*models.Attachment
+	err := db.SelectContext(ctx, &atts, `
+	SELECT `+attachmentColumns+`
+	FROM announcement_attachments a
+	WHERE status = $1
+	AND (mime = 'application/pdf' OR LOWER(storage_path) LIKE '%.pdf')
+	AND NOT EXISTS (
+		SELECT 1 FROM attachment_extractions e
+		WHERE e.ann_id = a.ann_id AND e.file = a.storage_path AND e.sha256 = a.sha256
+		AND (e.status = $2 OR e.attempts >= $3)
+	)
+	ORDER BY id ASC`, models.AttachmentDownloaded, models.TextExtracted, maxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("query pending attachment text: %w", err)
+	}
+	return atts, nil
+}
+
+// SaveAttachmentText replaces the stored text of a with pages, the text of
+// each page in order, and marks it extracted. Pages without text are not
+// stored.
+func SaveAttachmentText(ctx context.Context, db *sqlx.DB, a *models.Attachment, pages []string) error {
+	defer metrics.ObserveDBWrite("save_attachment_text", time.Now())
+
+	var pageNos []int
+	var texts []string
+	for i, text := range pages {
+		if text != "" {
+			pageNos = append(pageNos, i+1)
+			texts = append(texts, text)
+		}
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+	DELETE FROM attachment_text WHERE ann_id = $1 AND file = $2`,
+		a.AnnID, a.StoragePath); err != nil {
+		return fmt.Errorf("delete attachment text %d %s: %w", a.AnnID, a.StoragePath, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+	INSERT INTO attachment_text (ann_id, file, page_no, text)
+	SELECT $1, $2, p.page_no, p.text
+	FROM unnest($3::int[], $4::text[]) AS p(page_no, text)`,
+		a.AnnID, a.StoragePath, pq.Array(pageNos), pq.Array(texts)); err != nil {
+		return fmt.Errorf("insert attachment text %d %s: %w", a.AnnID, a.StoragePath, err)
+	}
+
+	if err := saveExtraction(ctx, tx, a, models.TextExtracted, len(pages), nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// RecordAttachmentTextFailure marks the text extraction of a failed with
+// errMsg, keeping any text an earlier extraction stored.
+func RecordAttachmentTextFailure(ctx context.Context, db *sqlx.DB, a *models.Attachment, errMsg string) error {
+	defer metrics.ObserveDBWrite("save_attachment_text", time.Now())
+
+	return saveExtraction(ctx, db, a, models.TextFailed, 0, &errMsg)
+}
+
+// saveExtraction upserts the attachment_extractions row of a. The attempts
+// count restarts when the attachment's content changed.
+func saveExtraction(ctx context.Context, db sqlx.ExecerContext, a *models.Attachment, status string, pages int, lastError *string) error {
+	_, err := db.ExecContext(ctx, `
+	INSERT INTO attachment_extractions (
+		ann_id, file, sha256, status, pages, attempts, last_error, extracted_at)
+	VALUES ($1, $2, $3, $4::text, $5, 1, $6,
+		CASE WHEN $4::text = 'extracted' THEN NOW() END)
+	ON CONFLICT (ann_id, file)
+	DO UPDATE SET
+		status = EXCLUDED.status,
+		pages = CASE WHEN EXCLUDED.status = 'extracted' THEN EXCLUDED.pages ELSE attachment_extractions.pages END,
+		attempts = CASE WHEN attachment_extractions.sha256 = EXCLUDED.sha256 THEN attachment_extractions.attempts + 1 ELSE 1 END,
+		sha256 = EXCLUDED.sha256,
+		last_error = EXCLUDED.last_error,
+		extracted_at = COALESCE(EXCLUDED.extracted_at, attachment_extractions.extracted_at),
+		updated_at = NOW()`,
+		a.AnnID, a.StoragePath, a.SHA256, status, pages, lastError)
+	if err != nil {
+		return fmt.Errorf("save extraction %d %s: %w", a.AnnID, a.StoragePath, err)
+	}
+	return nil
+}
+
+// FetchAttachmentText returns the stored page text of every attachment of
+// annID, by file and page.
+func FetchAttachmentText(ctx context.Context, db *sqlx.DB, annID int) ([]*models.AttachmentPage, error) {
+	var pages []*models.AttachmentPage
+	err := db.SelectContext(ctx, &pages, `
+	SELECT id, ann_id, file, page_no, text, created_at
+	FROM attachment_text
+	WHERE ann_id = $1
+	ORDER BY file, page_no`, annID)
+	if err != nil {
+		return nil, fmt.Errorf("query attachment text %d: %w", annID, err)
+	}
+	return pages, nil
+}
+
+// FetchPendingTableAttachments returns the downloaded spreadsheet and CSV
+// attachments whose tables were not parsed from their current content yet,
+// leaving out those that already failed maxAttempts times.
+func FetchPendingTableAttachments(ctx context.Context, db *sqlx.DB, maxAttempts int) ([]*models.TableAttachment, error) {
+	var atts []*models.TableAttachment
+	err := db.SelectContext(ctx, &atts, `
+	SELECT `+attachmentColumns+`,
+		COALESCE((SELECT n.category FROM announcements n WHERE n.ann_id = a.ann_id), '') AS category
+	FROM announcement_attachments a
+	WHERE status = $1
+	AND (LOWER(storage_path) LIKE '%.xlsx' OR LOWER(storage_path) LIKE '%.xlsm' OR LOWER(storage_path) LIKE '%.csv')
+	AND NOT EXISTS (
+		SELECT 1 FROM attachment_tables t
+		WHERE t.ann_id = a.ann_id AND t.file = a.storage_path AND t.sha256 = a.sha256
+		AND (t.status = $2 OR t.attempts >= $3)
+	)
+	ORDER BY id ASC`, models.AttachmentDownloaded, models.TablesParsed, maxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("query pending attachment tables: %w", err)
+	}
+	return atts, nil
+}
+
+// SaveAttachmentTables stores the records read from the tables of a and
+// marks it parsed.
+func SaveAttachmentTables(ctx context.Context, db *sqlx.DB, a *models.Attachment, records *models.TableRecords) error {
+	defer metrics.ObserveDBWrite("save_attachment_tables", time.Now())
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("marshal attachment tables %d %s: %w", a.AnnID, a.StoragePath, err)
+	}
+	return saveTableParse(ctx, db, a, models.TablesParsed, utils.PtrString(string(data)), records.Len(), nil)
+}
+
+// RecordAttachmentTablesFailure marks the table parse of a failed with
+// errMsg, keeping any records an earlier parse stored.
+func RecordAttachmentTablesFailure(ctx context.Context, db *sqlx.DB, a *models.Attachment, errMsg string) error {
+	defer metrics.ObserveDBWrite("save_attachment_tables", time.Now())
+
+	return saveTableParse(ctx, db, a, models.TablesFailed, nil, 0, &errMsg)
+}
+
+// saveTableParse upserts the attachment_tables row of a. The attempts count
+// restarts when the attachment's content changed.
+func saveTableParse(ctx context.Context, db *sqlx.DB, a *models.Attachment, status string, records *string, rows int, lastError *string) error {
+	_, err := db.ExecContext(ctx, `
+	INSERT INTO attachment_tables (
+		ann_id, file, sha256, status, records, rows, attempts, last_error, parsed_at)
+	VALUES ($1, $2, $3, $4::text, $5::jsonb, $6, 1, $7,
+		CASE WHEN $4::text = 'parsed' THEN NOW() END)
+	ON CONFLICT (ann_id, file)
+	DO UPDATE SET
+		status = EXCLUDED.status,
+		records = CASE WHEN EXCLUDED.status = 'parsed' THEN EXCLUDED.records ELSE attachment_tables.records END,
+		rows = CASE WHEN EXCLUDED.status = 'parsed' THEN EXCLUDED.rows ELSE attachment_tables.rows END,
+		attempts = CASE WHEN attachment_tables.sha256 = EXCLUDED.sha256 THEN attachment_tables.attempts + 1 ELSE 1 END,
+		sha256 = EXCLUDED.sha256,
+		last_error = EXCLUDED.last_error,
+		parsed_at = COALESCE(EXCLUDED.parsed_at, attachment_tables.parsed_at),
+		updated_at = NOW()`,
+		a.AnnID, a.StoragePath, a.SHA256, status, records, rows, lastError)
+	if err != nil {
+		return fmt.Errorf("save attachment tables %d %s: %w", a.AnnID, a.StoragePath, err)
+	}
+	return nil
+}
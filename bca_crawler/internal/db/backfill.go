@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"bca_crawler/internal/models"
+)
+
+// FetchStockByCode returns the stock with the given code, or nil if it is not
+// in the stocks table.
+func FetchStockByCode(ctx context.Context, db *sqlx.DB, code string) (*models.Stock, error) {
+	var stock models.Stock
+	err := db.GetContext(ctx, &stock, `SELECT * FROM stocks WHERE stock_code = $1`, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query stock %s: %w", code, err)
+	}
+	return &stock, nil
+}
+
+// StartStockBackfill returns the backfill progress of a stock, creating it
+// when missing. With restart the progress and discovered ann_ids are reset.
+func StartStockBackfill(ctx context.Context, db *sqlx.DB, code string, restart bool) (*models.StockBackfill, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if restart {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM stock_backfill_ids WHERE stock_code = $1`, code); err != nil {
+			return nil, fmt.Errorf("reset backfill ids %s: %w", code, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM stock_backfill WHERE stock_code = $1`, code); err != nil {
+			return nil, fmt.Errorf("reset backfill %s: %w", code, err)
+		}
+	}
+
+	var b models.StockBackfill
+	err = tx.GetContext(ctx, &b, `
+	INSERT INTO stock_backfill (stock_code, status)
+	VALUES ($1, $2)
+	ON CONFLICT (stock_code) DO UPDATE SET updated_at = CURRENT_TIMESTAMP
+	RETURNING stock_code, status, last_page, listed, fetched, last_error, started_at, updated_at, finished_at`,
+		code, models.BackfillListing)
+	if err != nil {
+		return nil, fmt.Errorf("start backfill %s: %w", code, err)
+	}
+
+	return &b, tx.Commit()
+}
+
+// RecordBackfillPage stores the ann_ids found on one search page and moves
+// the stock's progress to that page.
+func RecordBackfillPage(ctx context.Context, db *sqlx.DB, code string, page int, annIDs []int) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range annIDs {
+		if _, err := tx.ExecContext(ctx, `
+		INSERT INTO stock_backfill_ids (stock_code, ann_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, code, id); err != nil {
+			return fmt.Errorf("record backfill id %d: %w", id, err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE stock_backfill SET
+		last_page = $2,
+		listed = (SELECT COUNT(*) FROM stock_backfill_ids WHERE stock_code = $1),
+		updated_at = CURRENT_TIMESTAMP
+	WHERE stock_code = $1`, code, page)
+	if err != nil {
+		return fmt.Errorf("record backfill page %s: %w", code, err)
+	}
+
+	return tx.Commit()
+}
+
+// FetchBackfillPending returns the ann_ids found for a stock whose page is
+// not stored yet.
+func FetchBackfillPending(ctx context.Context, db *sqlx.DB, code string) ([]int, error) {
+	var ids []int
+	err := db.SelectContext(ctx, &ids, `
+	SELECT b.ann_id
+	FROM stock_backfill_ids b
+	LEFT JOIN announcements a ON a.ann_id = b.ann_id
+	WHERE b.stock_code = $1
+	AND (a.ann_id IS NULL OR (a.content IS NULL AND a.content_sha256 IS NULL))
+	ORDER BY b.ann_id ASC`, code)
+	if err != nil {
+		return nil, fmt.Errorf("query pending backfill ids %s: %w", code, err)
+	}
+	return ids, nil
+}
+
+// FinishStockBackfill sets the final status of a backfill and recounts how
+// many of its ann_ids are stored.
+func FinishStockBackfill(ctx context.Context, db *sqlx.DB, code, status string, lastErr *string) error {
+	_, err := db.ExecContext(ctx, `
+	UPDATE stock_backfill SET
+		status = $2::text,
+		last_error = $3,
+		fetched = (
+			SELECT COUNT(*)
+			FROM stock_backfill_ids b
+			JOIN announcements a ON a.ann_id = b.ann_id
+			WHERE b.stock_code = $1
+			AND (a.content IS NOT NULL OR a.content_sha256 IS NOT NULL)
+		),
+		updated_at = CURRENT_TIMESTAMP,
+		finished_at = CASE WHEN $2::text = 'done' THEN CURRENT_TIMESTAMP END
+	WHERE stock_code = $1`, code, status, lastErr)
+	if err != nil {
+		return fmt.Errorf("finish backfill %s: %w", code, err)
+	}
+	return nil
+}
+
+// SetStockBackfillStatus moves a backfill to another stage.
+func SetStockBackfillStatus(ctx context.Context, db *sqlx.DB, code, status string) error {
+	_, err := db.ExecContext(ctx, `
+	UPDATE stock_backfill SET status = $2, updated_at = CURRENT_TIMESTAMP
+	WHERE stock_code = $1`, code, status)
+	if err != nil {
+		return fmt.Errorf("update backfill %s: %w", code, err)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -12,40 +13,38 @@ import (
 	"bca_crawler/internal/models"
 )
 
-func FetchMissingAnnID(db *sqlx.DB) ([]int, error) {
-	rows, err := db.Query(`
-		SELECT t1.ann_id + 1 AS missing_ann_id
-		FROM announcements t1
-		LEFT JOIN announcements t2
-			ON t2.ann_id = t1.ann_id + 1
-		WHERE t2.ann_id IS NULL
-		ORDER BY missing_ann_id ASC
+// FetchMissingAnnID returns the ann_ids the crawl ledger says still need a
+// fetch: ids below the ledger maximum that were never attempted, plus failed
+// or not-found ids whose retry is due. Confirmed dead ids are never returned.
+func FetchMissingAnnID(ctx context.Context, db *sqlx.DB) ([]int, error) {
+	var missing []int
+	err := db.SelectContext(ctx, &missing, `
+		SELECT ann_id
+		FROM crawl_attempts
+		WHERE status <> 'saved'
+		AND dead_at IS NULL
+		AND next_retry_at <= NOW()
+		UNION
+		SELECT s.id
+		FROM generate_series(
+			(SELECT MIN(ann_id) FROM crawl_attempts),
+			(SELECT MAX(ann_id) FROM crawl_attempts)
+		) AS s(id)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM crawl_attempts c WHERE c.ann_id = s.id
+		)
+		ORDER BY 1 ASC
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("query missing ann_id gaps: %w", err)
 	}
-	defer rows.Close()
-
-	var missing []int
-
-	for rows.Next() {
-		var id int
-		if err := rows.Scan(&id); err != nil {
-			return nil, fmt.Errorf("scan missing ann_id: %w", err)
-		}
-		missing = append(missing, id)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows error: %w", err)
-	}
 
 	return missing, nil
 }
 
-func FetchUnparsedAnnouncements(db *sqlx.DB) ([]*models.Announcement, error) {
-	rows, err := db.Query(`
-	SELECT id, ann_id, content 
+func FetchUnparsedAnnouncements(ctx context.Context, db *sqlx.DB) ([]*models.Announcement, error) {
+	rows, err := db.QueryContext(ctx, `
+	SELECT id, ann_id, content, content_sha256
 	FROM announcements 
 	WHERE ref_number = ''
 	ORDER BY ann_id DESC`)
@@ -58,9 +57,12 @@ func FetchUnparsedAnnouncements(db *sqlx.DB) ([]*models.Announcement, error) {
 	var announcements []*models.Announcement
 	for rows.Next() {
 		var ann models.Announcement
-		if err := rows.Scan(&ann.ID, &ann.AnnID, &ann.Content); err != nil {
+		var content, sha sql.NullString
+		if err := rows.Scan(&ann.ID, &ann.AnnID, &content, &sha); err != nil {
 			return nil, fmt.Errorf("scan row: %w", err)
 		}
+		ann.Content = content.String
+		ann.ContentSHA256 = sha.String
 		announcements = append(announcements, &ann)
 	}
 	if err := rows.Err(); err != nil {
@@ -70,28 +72,43 @@ func FetchUnparsedAnnouncements(db *sqlx.DB) ([]*models.Announcement, error) {
 	return announcements, nil
 }
 
-func GetMaxAnnID(db *sqlx.DB) (int, error) {
-	var maxID int
-	err := db.QueryRow(`SELECT MAX(ann_id) FROM announcements`).Scan(&maxID)
+func GetMaxAnnID(ctx context.Context, db *sqlx.DB) (int, error) {
+	var maxID sql.NullInt64
+	err := db.QueryRowContext(ctx, `SELECT MAX(ann_id) FROM announcements`).Scan(&maxID)
 	if err != nil {
 		return 0, fmt.Errorf("query max ann_id: %w", err)
 	}
-	return maxID, nil
+	return int(maxID.Int64), nil
 }
 
-func FetchAnnouncementsByCategory(db *sqlx.DB, category string) ([]*models.Announcement, error) {
+// GetMaxStoredAnnID returns the highest ann_id whose page is stored, leaving
+// out rows the listing crawler saved with metadata only, or 0 when there is
+// none.
+func GetMaxStoredAnnID(ctx context.Context, db *sqlx.DB) (int, error) {
+	var maxID sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+		SELECT MAX(ann_id) FROM announcements
+		WHERE content IS NOT NULL OR content_sha256 IS NOT NULL`).Scan(&maxID)
+	if err != nil {
+		return 0, fmt.Errorf("query max stored ann_id: %w", err)
+	}
+	return int(maxID.Int64), nil
+}
+
+func FetchAnnouncementsByCategory(ctx context.Context, db *sqlx.DB, category string) ([]*models.Announcement, error) {
 	sqlQuery := `SELECT id, ann_id,
       link, company_name, stock_name,
       date_posted, category, ref_number,
-      attachments, content 
-      FROM announcements`
+      attachments, content, content_sha256
+      FROM announcements
+      WHERE (content IS NOT NULL OR content_sha256 IS NOT NULL)`
 
 	var args []interface{}
 	if category != "" {
 		if category == "attachments" {
-			sqlQuery += " WHERE attachments != 'null' AND date_posted >= CURRENT_DATE - INTERVAL '3 days'"
+			sqlQuery += " AND attachments != 'null' AND date_posted >= CURRENT_DATE - INTERVAL '3 days'"
 		} else {
-			sqlQuery += " WHERE category = $1 AND date_posted >= CURRENT_DATE - INTERVAL '3 days'"
+			sqlQuery += " AND category = $1 AND date_posted >= CURRENT_DATE - INTERVAL '3 days'"
 			args = append(args, category)
 		}
 	}
@@ -99,7 +116,7 @@ func FetchAnnouncementsByCategory(db *sqlx.DB, category string) ([]*models.Annou
 	sqlQuery += " ORDER BY ann_id ASC"
 
 	var announcements []models.AnnouncementDB
-	err := db.Select(&announcements, sqlQuery, args...)
+	err := db.SelectContext(ctx, &announcements, sqlQuery, args...)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -121,23 +138,29 @@ func FetchAnnouncementsByCategory(db *sqlx.DB, category string) ([]*models.Annou
 	return result, nil
 }
 
-func FetchAnnouncementsByShareholder(db *sqlx.DB) ([]*models.Announcement, error) {
+func FetchAnnouncementsByShareholder(ctx context.Context, db *sqlx.DB) ([]*models.Announcement, error) {
 	query := `
 		SELECT a.id, a.ann_id, a.link, a.company_name, a.stock_name,
-			a.date_posted, a.category, a.ref_number, a.attachments, a.content
+			a.date_posted, a.category, a.ref_number, a.attachments, a.content, a.content_sha256
 		FROM announcements a
 		WHERE a.category LIKE '%Pursuant%'
+		AND (a.content IS NOT NULL OR a.content_sha256 IS NOT NULL)
 		AND a.category NOT LIKE '%Company%'
 		AND a.category NOT LIKE '%Treasury%'
-		AND NOT EXISTS (
-			SELECT 1 FROM shareholding_change sc WHERE sc.ann_id = a.ann_id
+		AND (
+			NOT EXISTS (
+				SELECT 1 FROM shareholding_change sc WHERE sc.ann_id = a.ann_id
+			)
+			OR EXISTS (
+				SELECT 1 FROM shareholding_change sc WHERE sc.ann_id = a.ann_id AND sc.needs_reparse
+			)
 		)
 		ORDER BY a.ann_id ASC
 	`
 
 	var announcements []models.AnnouncementDB
 
-	if err := db.Select(&announcements, query); err != nil {
+	if err := db.SelectContext(ctx, &announcements, query); err != nil {
 		return nil, fmt.Errorf("select announcements: %w", err)
 	}
 
@@ -159,6 +182,34 @@ func FetchAnnouncementsByShareholder(db *sqlx.DB) ([]*models.Announcement, error
 	return result, nil
 }
 
+// FetchBoardroomReparseAnnouncements returns the announcements whose
+// boardroom_changes row was flagged for reparse after the announcement changed.
+func FetchBoardroomReparseAnnouncements(ctx context.Context, db *sqlx.DB) ([]*models.Announcement, error) {
+	var announcements []models.AnnouncementDB
+	err := db.SelectContext(ctx, &announcements, `
+		SELECT a.id, a.ann_id, a.link, a.company_name, a.stock_name,
+			a.date_posted, a.category, a.ref_number, a.attachments, a.content, a.content_sha256
+		FROM announcements a
+		JOIN boardroom_changes bc ON bc.ann_id = a.ann_id
+		WHERE bc.needs_reparse
+		ORDER BY a.ann_id ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("select boardroom reparse announcements: %w", err)
+	}
+
+	result := make([]*models.Announcement, 0, len(announcements))
+	for _, a := range announcements {
+		ann, err := ConvertAnnouncementDBToAnnouncement(a)
+		if err != nil {
+			return nil, fmt.Errorf("convert announcement db to announcement: %w", err)
+		}
+		result = append(result, ann)
+	}
+
+	return result, nil
+}
+
 func ConvertAnnouncementDBToAnnouncement(a models.AnnouncementDB) (*models.Announcement, error) {
 	attachments := []string{}
 	if err := json.Unmarshal([]byte(a.Attachments.String), &attachments); err != nil {
@@ -177,13 +228,15 @@ func ConvertAnnouncementDBToAnnouncement(a models.AnnouncementDB) (*models.Annou
 		RefNumber:   a.RefNumber.String,
 		Content:     a.Content.String,
 		Attachments: attachments,
+
+		ContentSHA256: a.ContentSHA256.String,
 	}, nil
 }
 
 // FindEntitiesByNameOrDisplay finds all entities matching the given name or display_name
-func FindEntitiesByNameOrDisplay(db *sqlx.DB, name string, displayName string) ([]models.Entity, error) {
+func FindEntitiesByNameOrDisplay(ctx context.Context, db *sqlx.DB, name string, displayName string) ([]models.Entity, error) {
 	var entities []models.Entity
-	err := db.Select(&entities, `
+	err := db.SelectContext(ctx, &entities, `
 		SELECT id, primary_perm_id, secondary_perm_id, display_name, name, salutation, 
 		       stock_code, birth_year, gender, nationality, created_at, updated_at
 		FROM entities
@@ -196,8 +249,8 @@ func FindEntitiesByNameOrDisplay(db *sqlx.DB, name string, displayName string) (
 }
 
 // UpdatePrimaryPermID updates all entities matching name or display_name to set their primary_perm_id
-func UpdatePrimaryPermID(db *sqlx.DB, id int, primaryPermID int) error {
-	_, err := db.Exec(`
+func UpdatePrimaryPermID(ctx context.Context, db *sqlx.DB, id int, primaryPermID int) error {
+	_, err := db.ExecContext(ctx, `
 		UPDATE entities
 		SET primary_perm_id = $1,
 		    updated_at = CURRENT_TIMESTAMP
@@ -209,9 +262,9 @@ func UpdatePrimaryPermID(db *sqlx.DB, id int, primaryPermID int) error {
 }
 
 // FindEntitiesByNameOrDisplay finds all entities matching the given name or display_name
-func FetchExHistEntity(db *sqlx.DB) ([]models.Entity, error) {
+func FetchExHistEntity(ctx context.Context, db *sqlx.DB) ([]models.Entity, error) {
 	var entities []models.Entity
-	err := db.Select(&entities, `
+	err := db.SelectContext(ctx, &entities, `
 		SELECT
 			h.director_name as name,
 			h.title as salutation,
@@ -230,9 +283,9 @@ func FetchExHistEntity(db *sqlx.DB) ([]models.Entity, error) {
 }
 
 // FindEntitiesByNameOrDisplay finds all entities matching the given name or display_name
-func FetchExHist(db *sqlx.DB) ([]models.ExHistEntity, error) {
+func FetchExHist(ctx context.Context, db *sqlx.DB) ([]models.ExHistEntity, error) {
 	var entities []models.ExHistEntity
-	err := db.Select(&entities, `
+	err := db.SelectContext(ctx, &entities, `
 		SELECT
 			s.stock_name as stock_code,
 			h.company_name as company_name,
@@ -256,9 +309,9 @@ func FetchExHist(db *sqlx.DB) ([]models.ExHistEntity, error) {
 }
 
 // FindEntitiesByNameOrDisplay finds all entities matching the given name or display_name
-func FetchEntity(db *sqlx.DB) ([]models.Entity, error) {
+func FetchEntity(ctx context.Context, db *sqlx.DB) ([]models.Entity, error) {
 	var entities []models.Entity
-	err := db.Select(&entities, `
+	err := db.SelectContext(ctx, &entities, `
 		SELECT * FROM entities
 		`)
 	if err != nil {
@@ -268,9 +321,9 @@ func FetchEntity(db *sqlx.DB) ([]models.Entity, error) {
 }
 
 // FindEntitiesByNameOrDisplay finds all entities matching the given name or display_name
-func FetchBoardChanges(db *sqlx.DB) ([]models.BoardroomChange, error) {
+func FetchBoardChanges(ctx context.Context, db *sqlx.DB) ([]models.BoardroomChange, error) {
 	var changes []models.BoardroomChange
-	err := db.Select(&changes, `
+	err := db.SelectContext(ctx, &changes, `
 		SELECT * FROM boardroom_changes order by date_of_change
 		`)
 	if err != nil {
@@ -279,9 +332,9 @@ func FetchBoardChanges(db *sqlx.DB) ([]models.BoardroomChange, error) {
 	return changes, nil
 }
 
-func FetchStockList(db *sqlx.DB) ([]models.Stock, error) {
+func FetchStockList(ctx context.Context, db *sqlx.DB) ([]models.Stock, error) {
 	var stockList []models.Stock
-	err := db.Select(&stockList, `
+	err := db.SelectContext(ctx, &stockList, `
 		SELECT * FROM stocks
 		`)
 	if err != nil {
@@ -290,8 +343,8 @@ func FetchStockList(db *sqlx.DB) ([]models.Stock, error) {
 	return stockList, nil
 }
 
-func UpdateStockRegNumbers(db *sqlx.DB, id int, regNo, regNoOld string) error {
-	_, err := db.Exec(`
+func UpdateStockRegNumbers(ctx context.Context, db *sqlx.DB, id int, regNo, regNoOld string) error {
+	_, err := db.ExecContext(ctx, `
 		UPDATE stocks
 		SET reg_no = $1, reg_no_old = $2, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $3
@@ -299,9 +352,9 @@ func UpdateStockRegNumbers(db *sqlx.DB, id int, regNo, regNoOld string) error {
 	return err
 }
 
-func FetchShareHoldingChanges(db *sqlx.DB) ([]models.ShareholdingChange, error) {
+func FetchShareHoldingChanges(ctx context.Context, db *sqlx.DB) ([]models.ShareholdingChange, error) {
 	var changes []models.ShareholdingChange
-	err := db.Select(&changes, `
+	err := db.SelectContext(ctx, &changes, `
 		SELECT *
 		FROM shareholding_change
 		WHERE related_perm IS NULL
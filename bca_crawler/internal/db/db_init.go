@@ -189,6 +189,172 @@ CREATE TABLE IF NOT EXISTS shareholding_change (
     created_at TIMESTAMP DEFAULT NOW()
 );
 
+
+CREATE TABLE IF NOT EXISTS crawl_attempts (
+    ann_id INTEGER PRIMARY KEY,
+    status TEXT NOT NULL,
+    http_status INTEGER,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_retry_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_crawl_attempts_retry ON crawl_attempts(status, next_retry_at);
+ALTER TABLE crawl_attempts ADD COLUMN IF NOT EXISTS misses INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE crawl_attempts ADD COLUMN IF NOT EXISTS dead_at TIMESTAMP;
+
+
+CREATE TABLE IF NOT EXISTS raw_pages (
+    id SERIAL PRIMARY KEY,
+    ann_id INTEGER NOT NULL,
+    sha256 TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    http_status INTEGER,
+    fetched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (ann_id, sha256)
+);
+ALTER TABLE announcements ADD COLUMN IF NOT EXISTS content_sha256 TEXT;
+
+
+CREATE TABLE IF NOT EXISTS announcement_versions (
+    id SERIAL PRIMARY KEY,
+    ann_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    company_name TEXT NOT NULL DEFAULT '',
+    stock_name TEXT NOT NULL DEFAULT '',
+    date_posted TIMESTAMP,
+    category TEXT NOT NULL DEFAULT '',
+    ref_number TEXT NOT NULL DEFAULT '',
+    attachments TEXT NOT NULL DEFAULT '',
+    content_sha256 TEXT NOT NULL DEFAULT '',
+    changed_fields TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (ann_id, version)
+);
+ALTER TABLE boardroom_changes ADD COLUMN IF NOT EXISTS needs_reparse BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE shareholding_change ADD COLUMN IF NOT EXISTS needs_reparse BOOLEAN NOT NULL DEFAULT FALSE;
+
+
+CREATE TABLE IF NOT EXISTS stock_backfill (
+    stock_code VARCHAR(20) PRIMARY KEY,
+    status TEXT NOT NULL,
+    last_page INTEGER NOT NULL DEFAULT 0,
+    listed INTEGER NOT NULL DEFAULT 0,
+    fetched INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS stock_backfill_ids (
+    stock_code VARCHAR(20) NOT NULL,
+    ann_id INTEGER NOT NULL,
+    PRIMARY KEY (stock_code, ann_id)
+);
+
+
+CREATE TABLE IF NOT EXISTS job_runs (
+    id SERIAL PRIMARY KEY,
+    run_id TEXT NOT NULL,
+    command TEXT NOT NULL,
+    args TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP,
+    status TEXT NOT NULL,
+    fetched INTEGER NOT NULL DEFAULT 0,
+    parsed INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    error_summary TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_job_runs_command ON job_runs(command, started_at);
+
+
+CREATE TABLE IF NOT EXISTS work_queue (
+    queue TEXT NOT NULL,
+    item_id INTEGER NOT NULL,
+    worker TEXT,
+    lease_until TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    enqueued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    claimed_at TIMESTAMP,
+    done_at TIMESTAMP,
+    PRIMARY KEY (queue, item_id)
+);
+CREATE INDEX IF NOT EXISTS idx_work_queue_pending ON work_queue(queue, item_id) WHERE done_at IS NULL;
+
+
+CREATE TABLE IF NOT EXISTS announcement_attachments (
+    id SERIAL PRIMARY KEY,
+    ann_id INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    filename TEXT NOT NULL DEFAULT '',
+    mime TEXT NOT NULL DEFAULT '',
+    size BIGINT NOT NULL DEFAULT 0,
+    sha256 TEXT NOT NULL DEFAULT '',
+    storage_path TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    downloaded_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (ann_id, url)
+);
+CREATE INDEX IF NOT EXISTS idx_announcement_attachments_url ON announcement_attachments(url);
+CREATE INDEX IF NOT EXISTS idx_announcement_attachments_sha256 ON announcement_attachments(sha256);
+
+
+CREATE TABLE IF NOT EXISTS attachment_text (
+    id SERIAL PRIMARY KEY,
+    ann_id INTEGER NOT NULL,
+    file TEXT NOT NULL,
+    page_no INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (ann_id, file, page_no)
+);
+
+CREATE TABLE IF NOT EXISTS attachment_extractions (
+    ann_id INTEGER NOT NULL,
+    file TEXT NOT NULL,
+    sha256 TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    pages INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    extracted_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (ann_id, file)
+);
+
+CREATE TABLE IF NOT EXISTS attachment_tables (
+    ann_id INTEGER NOT NULL,
+    file TEXT NOT NULL,
+    sha256 TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    records JSONB,
+    rows INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    parsed_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (ann_id, file)
+);
+
+
+CREATE TABLE IF NOT EXISTS annual_reports (
+    ann_id INTEGER PRIMARY KEY,
+    people INTEGER NOT NULL DEFAULT 0,
+    secretaries INTEGER NOT NULL DEFAULT 0,
+    shareholders INTEGER NOT NULL DEFAULT 0,
+    extracted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 `
 
 // DriverType represents supported database drivers
@@ -216,7 +382,7 @@ func Setup(connStr string, driver DriverType) (*sqlx.DB, error) {
 		}
 	}
 
-	utils.Logger.Infof("Database initialized and schema verified (%s)", connStr)
+	utils.Logger.Infof("Database initialized and schema verified (%s)", utils.RedactDSN(connStr))
 	return db, nil
 }
 
@@ -236,6 +402,13 @@ func Connect(connStr string, driver DriverType) (*sqlx.DB, error) {
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("ping db: %w", err)
 	}
-	utils.Logger.Infof("Connected to database: %s", connStr)
+	utils.Logger.Infof("Connected to database: %s", utils.RedactDSN(connStr))
 	return db, nil
 }
+
+// ConfigurePool applies the connection pool limits from cfg.
+func ConfigurePool(db *sqlx.DB, cfg *utils.Config) {
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+)
+
+// StartJobRun inserts r as a running job and fills in its id and start time.
+func StartJobRun(ctx context.Context, db *sqlx.DB, r *models.JobRun) error {
+	defer metrics.ObserveDBWrite("start_job_run", time.Now())
+
+	err := db.QueryRowContext(ctx, `
+	INSERT INTO job_runs (run_id, command, args, status)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, started_at`,
+		r.RunID, r.Command, r.Args, models.JobRunRunning).Scan(&r.ID, &r.StartedAt)
+	if err != nil {
+		return fmt.Errorf("start job run %s: %w", r.Command, err)
+	}
+	r.Status = models.JobRunRunning
+	return nil
+}
+
+// FinishJobRun stores the final status, counts and error summary of r.
+func FinishJobRun(ctx context.Context, db *sqlx.DB, r *models.JobRun) error {
+	defer metrics.ObserveDBWrite("finish_job_run", time.Now())
+
+	_, err := db.ExecContext(ctx, `
+	UPDATE job_runs SET
+		finished_at = CURRENT_TIMESTAMP,
+		status = $2,
+		fetched = $3,
+		parsed = $4,
+		failed = $5,
+		skipped = $6,
+		error_summary = $7
+	WHERE id = $1`,
+		r.ID, r.Status, r.Fetched, r.Parsed, r.Failed, r.Skipped, r.ErrorSummary)
+	if err != nil {
+		return fmt.Errorf("finish job run %d: %w", r.ID, err)
+	}
+	return nil
+}
+
+// FetchJobRuns returns the most recent runs, newest first, optionally only
+// those of one command.
+func FetchJobRuns(ctx context.Context, db *sqlx.DB, command string, limit int) ([]models.JobRun, error) {
+	var runs []models.JobRun
+	err := db.SelectContext(ctx, &runs, `
+		SELECT id, run_id, command, args, started_at, finished_at, status,
+			fetched, parsed, failed, skipped, error_summary
+		FROM job_runs
+		WHERE $1 = '' OR command = $1
+		ORDER BY started_at DESC, id DESC
+		LIMIT $2`, command, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query job runs: %w", err)
+	}
+	return runs, nil
+}
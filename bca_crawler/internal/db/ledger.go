@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+)
+
+// DeadAfterMisses is the number of consecutive not-found outcomes after which
+// an ann_id is confirmed dead and no longer retried.
+const DeadAfterMisses = 5
+
+// RecordCrawlAttempt upserts the outcome of one fetch into the crawl ledger
+// and schedules its next retry:
+//   - failed ids are retried after 10 minutes, doubling up to roughly two days
+//   - not-found ids are retried after 1 hour, then 4, 16 and 64 hours, and are
+//     confirmed dead after DeadAfterMisses consecutive misses
+//   - withdrawn ids are confirmed dead straight away
+func RecordCrawlAttempt(ctx context.Context, db *sqlx.DB, a *models.CrawlAttempt) error {
+	defer metrics.ObserveDBWrite("record_crawl_attempt", time.Now())
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO crawl_attempts (
+		ann_id, status, http_status, attempts, misses, last_error, updated_at)
+	VALUES ($1, $2::text, $3, 1,
+		CASE WHEN $2::text IN ('not_found', 'withdrawn') THEN 1 ELSE 0 END,
+		$4, NOW())
+	ON CONFLICT(ann_id)
+	DO UPDATE SET
+		status = EXCLUDED.status,
+		http_status = EXCLUDED.http_status,
+		attempts = crawl_attempts.attempts + 1,
+		misses = CASE WHEN EXCLUDED.misses > 0 THEN crawl_attempts.misses + 1 ELSE 0 END,
+		last_error = EXCLUDED.last_error,
+		updated_at = NOW();`,
+		a.AnnID, a.Status, a.HTTPStatus, a.LastError)
+	if err != nil {
+		return fmt.Errorf("record crawl attempt %d: %w", a.AnnID, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE crawl_attempts SET
+		dead_at = CASE
+			WHEN status = 'withdrawn' OR (status = 'not_found' AND misses >= $2)
+			THEN COALESCE(dead_at, NOW())
+		END,
+		next_retry_at = CASE
+			WHEN status = 'saved' THEN NULL
+			WHEN status = 'withdrawn' OR (status = 'not_found' AND misses >= $2) THEN NULL
+			WHEN status = 'not_found' THEN NOW() + INTERVAL '1 hour' * POWER(4, misses - 1)
+			ELSE NOW() + INTERVAL '10 minutes' * POWER(2, LEAST(attempts - 1, 8))
+		END
+	WHERE ann_id = $1`,
+		a.AnnID, DeadAfterMisses)
+	if err != nil {
+		return fmt.Errorf("schedule crawl retry %d: %w", a.AnnID, err)
+	}
+
+	return tx.Commit()
+}
+
+// FetchDeadAnnouncements lists confirmed dead ann_ids whose approximate date
+// falls within [from, to).
+func FetchDeadAnnouncements(ctx context.Context, db *sqlx.DB, from, to time.Time) ([]models.DeadAnnouncement, error) {
+	var dead []models.DeadAnnouncement
+	err := db.SelectContext(ctx, &dead, `
+		SELECT ann_id, status, attempts, dead_at, approx_date
+		FROM (
+			SELECT c.ann_id, c.status, c.attempts, c.dead_at,
+				(
+					SELECT a.date_posted
+					FROM announcements a
+					WHERE a.ann_id < c.ann_id
+					AND a.date_posted IS NOT NULL
+					ORDER BY a.ann_id DESC
+					LIMIT 1
+				) AS approx_date
+			FROM crawl_attempts c
+			WHERE c.dead_at IS NOT NULL
+		) d
+		WHERE approx_date >= $1 AND approx_date < $2
+		ORDER BY ann_id ASC`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("query dead announcements: %w", err)
+	}
+	return dead, nil
+}
+
+// SyncCrawlLedger marks every stored announcement without a ledger row as
+// saved, so rows written by other tools are not treated as gaps. Rows known
+// only from the listing have no page yet and are left alone.
+func SyncCrawlLedger(ctx context.Context, db *sqlx.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, `
+	INSERT INTO crawl_attempts (ann_id, status, attempts)
+	SELECT a.ann_id, 'saved', 1
+	FROM announcements a
+	WHERE a.ann_id IS NOT NULL
+	AND (a.content IS NOT NULL OR a.content_sha256 IS NOT NULL)
+	AND NOT EXISTS (
+		SELECT 1 FROM crawl_attempts c WHERE c.ann_id = a.ann_id
+	)
+	ON CONFLICT(ann_id) DO NOTHING`)
+	if err != nil {
+		return 0, fmt.Errorf("sync crawl ledger: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// GetLedgerMaxAnnID returns the highest ann_id ever attempted, or 0 when the
+// ledger is empty. Gaps below it are picked up by FetchMissingAnnID.
+func GetLedgerMaxAnnID(ctx context.Context, db *sqlx.DB) (int, error) {
+	var maxID sql.NullInt64
+	err := db.QueryRowContext(ctx, `SELECT MAX(ann_id) FROM crawl_attempts`).Scan(&maxID)
+	if err != nil {
+		return 0, fmt.Errorf("query ledger max ann_id: %w", err)
+	}
+	return int(maxID.Int64), nil
+}
+
+// FetchStoredAnnIDs returns which of ids already have their page stored.
+func FetchStoredAnnIDs(ctx context.Context, db *sqlx.DB, ids []int) (map[int]bool, error) {
+	var stored []int
+	if err := db.SelectContext(ctx, &stored, `
+		SELECT ann_id FROM announcements
+		WHERE ann_id = ANY($1)
+		AND (content IS NOT NULL OR content_sha256 IS NOT NULL)`, pq.Array(ids)); err != nil {
+		return nil, fmt.Errorf("query stored ann_ids: %w", err)
+	}
+
+	found := make(map[int]bool, len(stored))
+	for _, id := range stored {
+		found[id] = true
+	}
+	return found, nil
+}
+
+// GetFirstAnnIDSince returns the lowest ann_id posted on or after since, or 0
+// when there is none.
+func GetFirstAnnIDSince(ctx context.Context, db *sqlx.DB, since time.Time) (int, error) {
+	var id sql.NullInt64
+	if err := db.GetContext(ctx, &id, `SELECT MIN(ann_id) FROM announcements WHERE date_posted >= $1`, since); err != nil {
+		return 0, fmt.Errorf("query first ann_id since %s: %w", since.Format("2006-01-02"), err)
+	}
+	return int(id.Int64), nil
+}
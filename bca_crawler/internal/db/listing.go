@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+)
+
+// SaveListedAnnouncements stores the metadata shown on the announcement
+// listing. Fields already filled by an earlier listing or by the parser are
+// kept; only the gaps are filled in.
+func SaveListedAnnouncements(ctx context.Context, db *sqlx.DB, anns []*models.Announcement) error {
+	defer metrics.ObserveDBWrite("save_listed_announcements", time.Now())
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PreparexContext(ctx, `
+	INSERT INTO announcements (ann_id, title, link, company_name, date_posted, category)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT(ann_id)
+	DO UPDATE SET
+		title = COALESCE(NULLIF(announcements.title, ''), EXCLUDED.title),
+		company_name = COALESCE(NULLIF(announcements.company_name, ''), EXCLUDED.company_name),
+		date_posted = COALESCE(announcements.date_posted, EXCLUDED.date_posted),
+		category = COALESCE(NULLIF(announcements.category, ''), EXCLUDED.category)`)
+	if err != nil {
+		return fmt.Errorf("prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, a := range anns {
+		var datePosted interface{}
+		if !a.DatePosted.IsZero() {
+			datePosted = a.DatePosted
+		}
+
+		if _, err := stmt.ExecContext(ctx, a.AnnID, a.Title, a.Link, a.CompanyName, datePosted, nullIfEmpty(a.Category)); err != nil {
+			return fmt.Errorf("save listed announcement %d: %w", a.AnnID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FetchListedAnnIDs returns ann_ids known from the listing whose page has not
+// been stored yet and that are due in the crawl ledger. Announcements whose
+// category contains an earlier entry of priority come first, then by ann_id.
+func FetchListedAnnIDs(ctx context.Context, db *sqlx.DB, priority []string) ([]int, error) {
+	order := "0"
+	args := make([]interface{}, 0, len(priority))
+	if len(priority) > 0 {
+		var b strings.Builder
+		b.WriteString("CASE")
+		for i, p := range priority {
+			args = append(args, "%"+p+"%")
+			fmt.Fprintf(&b, " WHEN a.category ILIKE $%d THEN %d", i+1, i)
+		}
+		fmt.Fprintf(&b, " ELSE %d END", len(priority))
+		order = b.String()
+	}
+
+	var ids []int
+	err := db.SelectContext(ctx, &ids, `
+	SELECT a.ann_id
+	FROM announcements a
+	LEFT JOIN crawl_attempts c ON c.ann_id = a.ann_id
+	WHERE a.content IS NULL AND a.content_sha256 IS NULL
+	AND (
+		c.ann_id IS NULL
+		OR (c.status <> 'saved' AND c.dead_at IS NULL AND c.next_retry_at <= NOW())
+	)
+	ORDER BY `+order+`, a.ann_id ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query listed ann_ids: %w", err)
+	}
+	return ids, nil
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AdvisoryLock is a Postgres session-level advisory lock, held on its own
+// connection for as long as the process needs it.
+type AdvisoryLock struct {
+	conn *sql.Conn
+	key  int64
+}
+
+// TryAdvisoryLock takes the advisory lock for key without waiting. It returns
+// nil when another session already holds it.
+func TryAdvisoryLock(ctx context.Context, db *sqlx.DB, key int64) (*AdvisoryLock, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("open lock connection: %w", err)
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("take advisory lock %d: %w", key, err)
+	}
+	if !locked {
+		conn.Close()
+		return nil, nil
+	}
+
+	return &AdvisoryLock{conn: conn, key: key}, nil
+}
+
+// Release unlocks and returns the connection to the pool.
+func (l *AdvisoryLock) Release() error {
+	defer l.conn.Close()
+
+	if _, err := l.conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, l.key); err != nil {
+		return fmt.Errorf("release advisory lock %d: %w", l.key, err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+)
+
+// RecordRawPage notes that p.SHA256 was fetched for p.AnnID. Each distinct
+// version is kept as its own row; fetching the same version again only
+// bumps last_seen_at.
+func RecordRawPage(ctx context.Context, db *sqlx.DB, p *models.RawPage) error {
+	defer metrics.ObserveDBWrite("record_raw_page", time.Now())
+
+	_, err := db.ExecContext(ctx, `
+	INSERT INTO raw_pages (ann_id, sha256, size, http_status)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (ann_id, sha256)
+	DO UPDATE SET
+		http_status = EXCLUDED.http_status,
+		last_seen_at = CURRENT_TIMESTAMP`,
+		p.AnnID, p.SHA256, p.Size, p.HTTPStatus)
+	if err != nil {
+		return fmt.Errorf("record raw page %d: %w", p.AnnID, err)
+	}
+	return nil
+}
+
+// FetchRawPages returns every archived version of ann_id, oldest first.
+func FetchRawPages(ctx context.Context, db *sqlx.DB, annID int) ([]models.RawPage, error) {
+	var pages []models.RawPage
+	err := db.SelectContext(ctx, &pages, `
+	SELECT id, ann_id, sha256, size, http_status, fetched_at, last_seen_at
+	FROM raw_pages
+	WHERE ann_id = $1
+	ORDER BY fetched_at ASC, id ASC`, annID)
+	if err != nil {
+		return nil, fmt.Errorf("query raw pages %d: %w", annID, err)
+	}
+	return pages, nil
+}
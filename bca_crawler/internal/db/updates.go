@@ -1,18 +1,24 @@
 package db
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
 
+	"bca_crawler/internal/metrics"
 	"bca_crawler/internal/models"
 )
 
-// SaveAnnouncement inserts or updates a full announcement
-func SaveAnnouncement(db *sqlx.DB, a *models.Announcement) error {
+// SaveAnnouncement inserts or updates a full announcement. Empty metadata does
+// not overwrite what the listing crawler already stored.
+func SaveAnnouncement(ctx context.Context, db *sqlx.DB, a *models.Announcement) error {
+	defer metrics.ObserveDBWrite("save_announcement", time.Now())
+
 	now := time.Now().UTC()
 
 	attachmentsJSON, err := json.Marshal(a.Attachments)
@@ -20,35 +26,61 @@ func SaveAnnouncement(db *sqlx.DB, a *models.Announcement) error {
 		return err
 	}
 
-	_, err = db.Exec(`
+	content, sha := contentColumns(a)
+
+	_, err = db.ExecContext(ctx, `
 	INSERT INTO announcements(
-		ann_id, title, link, company_name, stock_name, date_posted, category, ref_number, content, attachments)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ann_id, title, link, company_name, stock_name, date_posted, category, ref_number, content, attachments, content_sha256)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	ON CONFLICT(ann_id)
 	DO UPDATE SET
-		title = EXCLUDED.title,
+		title = COALESCE(NULLIF(EXCLUDED.title, ''), announcements.title),
 		link = EXCLUDED.link,
-		company_name = EXCLUDED.company_name,
-		stock_name = EXCLUDED.stock_name,
-		category = EXCLUDED.category,
+		company_name = COALESCE(NULLIF(EXCLUDED.company_name, ''), announcements.company_name),
+		stock_name = COALESCE(NULLIF(EXCLUDED.stock_name, ''), announcements.stock_name),
+		category = COALESCE(NULLIF(EXCLUDED.category, ''), announcements.category),
 		ref_number = EXCLUDED.ref_number,
 		content = EXCLUDED.content,
-		attachments = EXCLUDED.attachments;`,
-		a.AnnID, a.Title, a.Link, a.CompanyName, a.StockName, now, a.Category, a.RefNumber, a.Content, attachmentsJSON)
+		attachments = EXCLUDED.attachments,
+		content_sha256 = EXCLUDED.content_sha256;`,
+		a.AnnID, a.Title, a.Link, a.CompanyName, a.StockName, now, a.Category, a.RefNumber, content, attachmentsJSON, sha)
 
 	return err
 }
 
-func UpdateAnnouncement(db *sqlx.DB, a *models.Announcement) error {
+// contentColumns returns the values for announcements.content and
+// content_sha256. Once the page lives in the raw archive only the hash is
+// stored.
+func contentColumns(a *models.Announcement) (content, sha *string) {
+	if a.ContentSHA256 != "" {
+		return nil, &a.ContentSHA256
+	}
+	return &a.Content, nil
+}
+
+// UpdateAnnouncement writes the parsed fields of an announcement and records a
+// new announcement version when they differ from the last one, logging the
+// changed fields to log.
+func UpdateAnnouncement(ctx context.Context, log logrus.FieldLogger, db *sqlx.DB, a *models.Announcement) error {
+	defer metrics.ObserveDBWrite("update_announcement", time.Now())
+
 	attachmentsJSON, err := json.Marshal(a.Attachments)
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec(`
+	content, sha := contentColumns(a)
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
 	INSERT INTO announcements (
-		ann_id, title, company_name, stock_name, date_posted, category, ref_number, attachments, content
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ann_id, title, company_name, stock_name, date_posted, category, ref_number, attachments, content, content_sha256
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	ON CONFLICT(ann_id)
 	DO UPDATE SET
 		title = EXCLUDED.title,
@@ -58,12 +90,27 @@ func UpdateAnnouncement(db *sqlx.DB, a *models.Announcement) error {
 		category = EXCLUDED.category,
 		ref_number = EXCLUDED.ref_number,
 		attachments = EXCLUDED.attachments,
-		content = EXCLUDED.content;`,
-		a.AnnID, a.Title, a.CompanyName, a.StockName, a.DatePosted, a.Category, a.RefNumber, attachmentsJSON, a.Content)
-	return err
+		content = EXCLUDED.content,
+		content_sha256 = COALESCE(EXCLUDED.content_sha256, announcements.content_sha256);`,
+		a.AnnID, a.Title, a.CompanyName, a.StockName, a.DatePosted, a.Category, a.RefNumber, attachmentsJSON, content, sha)
+	if err != nil {
+		return err
+	}
+
+	changed, err := recordAnnouncementVersion(ctx, tx, a, attachmentsJSON)
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		log.Infof("Announcement %d changed: %s", a.AnnID, strings.Join(changed, ", "))
+	}
+
+	return tx.Commit()
 }
 
-func UpdateBoardroomChange(db *sqlx.DB, change *models.BoardroomChange) error {
+func UpdateBoardroomChange(ctx context.Context, db *sqlx.DB, change *models.BoardroomChange) error {
+	defer metrics.ObserveDBWrite("update_boardroom_change", time.Now())
+
 	query := `
 		INSERT INTO boardroom_changes (
 			ann_id, company_name, stock_code,
@@ -88,9 +135,10 @@ func UpdateBoardroomChange(db *sqlx.DB, change *models.BoardroomChange) error {
 			remarks = excluded.remarks,
 			directorate = excluded.directorate,
 			type_of_change = excluded.type_of_change,
-			related_perm = excluded.related_perm
+			related_perm = excluded.related_perm,
+			needs_reparse = FALSE
 	`
-	_, err := db.Exec(db.Rebind(query),
+	_, err := db.ExecContext(ctx, db.Rebind(query),
 		change.AnnID, change.CompanyName, change.StockCode,
 		change.PersonName, change.PersonTitle, change.PersonBirthYear,
 		change.PersonGender, change.PersonNationality,
@@ -103,21 +151,23 @@ func UpdateBoardroomChange(db *sqlx.DB, change *models.BoardroomChange) error {
 	return nil
 }
 
-func UpdateShareholdingChange(db *sqlx.DB, changes []*models.ShareholdingChange) error {
+func UpdateShareholdingChange(ctx context.Context, db *sqlx.DB, changes []*models.ShareholdingChange) error {
+	defer metrics.ObserveDBWrite("update_shareholding_change", time.Now())
+
 	if len(changes) == 0 {
 		return nil
 	}
 
 	annID := changes[0].AnnID
 
-	tx, err := db.Beginx()
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
 	// Delete existing rows for this announcement
-	_, err = tx.Exec("DELETE FROM shareholding_change WHERE ann_id = $1", annID)
+	_, err = tx.ExecContext(ctx, "DELETE FROM shareholding_change WHERE ann_id = $1", annID)
 	if err != nil {
 		return fmt.Errorf("delete existing records: %w", err)
 	}
@@ -161,7 +211,7 @@ func UpdateShareholdingChange(db *sqlx.DB, changes []*models.ShareholdingChange)
 	)
 	`
 
-	stmt, err := tx.Preparex(tx.Rebind(query))
+	stmt, err := tx.PreparexContext(ctx, tx.Rebind(query))
 	if err != nil {
 		return fmt.Errorf("prepare statement: %w", err)
 	}
@@ -169,7 +219,7 @@ func UpdateShareholdingChange(db *sqlx.DB, changes []*models.ShareholdingChange)
 
 	for _, change := range changes {
 
-		_, err := stmt.Exec(
+		_, err := stmt.ExecContext(ctx,
 			change.AnnID,
 			change.StockCode,
 			change.CompanyName,
@@ -210,12 +260,14 @@ func UpdateShareholdingChange(db *sqlx.DB, changes []*models.ShareholdingChange)
 	return tx.Commit()
 }
 
-func UpdateShareholdingChangePerm(db *sqlx.DB, id int, permID int) error {
-	_, err := db.Exec("UPDATE shareholding_change SET related_perm = $1 WHERE id = $2", permID, id)
+func UpdateShareholdingChangePerm(ctx context.Context, db *sqlx.DB, id int, permID int) error {
+	_, err := db.ExecContext(ctx, "UPDATE shareholding_change SET related_perm = $1 WHERE id = $2", permID, id)
 	return err
 }
 
-func InsertEntity(db *sqlx.DB, e *models.Entity) (int, error) {
+func InsertEntity(ctx context.Context, db *sqlx.DB, e *models.Entity) (int, error) {
+	defer metrics.ObserveDBWrite("insert_entity", time.Now())
+
 	query := `
 		INSERT INTO entities (
 			primary_perm_id,
@@ -228,7 +280,7 @@ func InsertEntity(db *sqlx.DB, e *models.Entity) (int, error) {
 	`
 
 	var scID int
-	err := db.QueryRowx(
+	err := db.QueryRowxContext(ctx,
 		db.Rebind(query),
 		e.PrimaryPermID,
 		e.DisplayName,
@@ -248,7 +300,7 @@ func InsertEntity(db *sqlx.DB, e *models.Entity) (int, error) {
 
 	// Update primary_perm_id to be the same as secondary_perm_id
 	// updateQuery := `UPDATE entities SET primary_perm_id = ?, updated_at = CURRENT_TIMESTAMP WHERE secondary_perm_id = ?`
-	// _, err = db.Exec(db.Rebind(updateQuery), scID, scID)
+	// _, err = db.ExecContext(ctx, db.Rebind(updateQuery), scID, scID)
 	// if err != nil {
 	// 	return 0, fmt.Errorf("failed to update primary_perm_id: %w", err)
 	// }
@@ -256,7 +308,7 @@ func InsertEntity(db *sqlx.DB, e *models.Entity) (int, error) {
 	return scID, nil
 }
 
-func UpdateBackground(db *sqlx.DB, personID int, bg *models.Background) error {
+func UpdateBackground(ctx context.Context, db *sqlx.DB, personID int, bg *models.Background) error {
 	queryInsert := `
 		INSERT INTO backgrounds (
 			perm_id, qualification, working_experience,
@@ -270,7 +322,7 @@ func UpdateBackground(db *sqlx.DB, personID int, bg *models.Background) error {
 			conflict_of_interest = excluded.conflict_of_interest,
 			interest_in_securities = excluded.interest_in_securities
 	`
-	_, err := db.Exec(db.Rebind(queryInsert),
+	_, err := db.ExecContext(ctx, db.Rebind(queryInsert),
 		personID, bg.Qualification, bg.WorkingExperience,
 		bg.Directorships, bg.FamilyRelationship, bg.ConflictOfInterest, bg.InterestInSecurities)
 	if err != nil {
@@ -280,7 +332,7 @@ func UpdateBackground(db *sqlx.DB, personID int, bg *models.Background) error {
 	return nil
 }
 
-func InsertEntityRoles(db *sqlx.DB, roles []models.EntityRole) error {
+func InsertEntityRoles(ctx context.Context, db *sqlx.DB, roles []models.EntityRole) error {
 	query := `
 		INSERT INTO entities_role (
 			perm_id, company_name, stock_name,
@@ -296,7 +348,7 @@ func InsertEntityRoles(db *sqlx.DB, roles []models.EntityRole) error {
 	for i := range roles {
 		r := &roles[i]
 		r.RoleName = strings.ToUpper(strings.TrimSpace(r.RoleName))
-		_, err := db.Exec(db.Rebind(query),
+		_, err := db.ExecContext(ctx, db.Rebind(query),
 			r.PermID, r.CompanyName, r.StockName,
 			r.DateAppointed, r.DateResigned,
 			r.Category, r.RoleName,
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"bca_crawler/internal/models"
+)
+
+// recordAnnouncementVersion compares the parsed state of a with its latest
+// version and records a new version when anything changed. When an existing
+// announcement changes, the rows parsed from it are flagged for reparse. It
+// returns the changed fields, or nil for the first version or no change.
+func recordAnnouncementVersion(ctx context.Context, tx *sqlx.Tx, a *models.Announcement, attachmentsJSON []byte) ([]string, error) {
+	next := &models.AnnouncementVersion{
+		AnnID:         a.AnnID,
+		Version:       1,
+		Title:         a.Title,
+		CompanyName:   a.CompanyName,
+		StockName:     a.StockName,
+		Category:      a.Category,
+		RefNumber:     a.RefNumber,
+		Attachments:   string(attachmentsJSON),
+		ContentSHA256: contentHash(a),
+	}
+	if !a.DatePosted.IsZero() {
+		next.DatePosted = &a.DatePosted
+	}
+
+	var prev models.AnnouncementVersion
+	err := tx.GetContext(ctx, &prev, `
+	SELECT id, ann_id, version, title, company_name, stock_name, date_posted,
+		category, ref_number, attachments, content_sha256, changed_fields, created_at
+	FROM announcement_versions
+	WHERE ann_id = $1
+	ORDER BY version DESC
+	LIMIT 1`, a.AnnID)
+
+	first := errors.Is(err, sql.ErrNoRows)
+	if err != nil && !first {
+		return nil, fmt.Errorf("query latest version %d: %w", a.AnnID, err)
+	}
+
+	var changed []string
+	if !first {
+		if changed = next.Diff(&prev); len(changed) == 0 {
+			return nil, nil
+		}
+		next.Version = prev.Version + 1
+		next.ChangedFields = strings.Join(changed, ",")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO announcement_versions (
+		ann_id, version, title, company_name, stock_name, date_posted,
+		category, ref_number, attachments, content_sha256, changed_fields)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		next.AnnID, next.Version, next.Title, next.CompanyName, next.StockName, next.DatePosted,
+		next.Category, next.RefNumber, next.Attachments, next.ContentSHA256, next.ChangedFields)
+	if err != nil {
+		return nil, fmt.Errorf("insert version %d of %d: %w", next.Version, a.AnnID, err)
+	}
+
+	if first {
+		return nil, nil
+	}
+
+	for _, table := range []string{"boardroom_changes", "shareholding_change"} {
+		if _, err := tx.ExecContext(ctx, "UPDATE "+table+" SET needs_reparse = TRUE WHERE ann_id = $1", a.AnnID); err != nil {
+			return nil, fmt.Errorf("flag %s for reparse: %w", table, err)
+		}
+	}
+
+	return changed, nil
+}
+
+// contentHash identifies the page content of a, whether it lives in the raw
+// archive or in announcements.content.
+func contentHash(a *models.Announcement) string {
+	if a.ContentSHA256 != "" {
+		return a.ContentSHA256
+	}
+	if a.Content == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(a.Content))
+	return hex.EncodeToString(sum[:])
+}
+
+// FetchAnnouncementVersions returns every recorded version of ann_id, oldest
+// first.
+func FetchAnnouncementVersions(ctx context.Context, db *sqlx.DB, annID int) ([]models.AnnouncementVersion, error) {
+	var versions []models.AnnouncementVersion
+	err := db.SelectContext(ctx, &versions, `
+	SELECT id, ann_id, version, title, company_name, stock_name, date_posted,
+		category, ref_number, attachments, content_sha256, changed_fields, created_at
+	FROM announcement_versions
+	WHERE ann_id = $1
+	ORDER BY version ASC`, annID)
+	if err != nil {
+		return nil, fmt.Errorf("query versions %d: %w", annID, err)
+	}
+	return versions, nil
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"bca_crawler/internal/metrics"
+)
+
+// workRetention is how long finished work_queue rows are kept. They stop a
+// worker whose listing predates the finish from queueing the item again.
+const workRetention = 24 * time.Hour
+
+// Now returns the database clock, which every lease is measured against so
+// hosts with drifting clocks still agree on when a lease expires.
+func Now(ctx context.Context, db *sqlx.DB) (time.Time, error) {
+	var now time.Time
+	if err := db.GetContext(ctx, &now, `SELECT NOW()`); err != nil {
+		return time.Time{}, fmt.Errorf("query database time: %w", err)
+	}
+	return now, nil
+}
+
+// EnqueueWork adds ids to queue. An item finished before listedAt, the time
+// the caller started selecting ids, is queued again; one finished after it is
+// left alone, as the caller's selection is older than that work.
+func EnqueueWork(ctx context.Context, db *sqlx.DB, queue string, ids []int, listedAt time.Time) (int64, error) {
+	defer metrics.ObserveDBWrite("enqueue_work", time.Now())
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+	DELETE FROM work_queue
+	WHERE queue = $1 AND done_at < NOW() - INTERVAL '1 second' * $2::float8`,
+		queue, workRetention.Seconds()); err != nil {
+		return 0, fmt.Errorf("prune %s queue: %w", queue, err)
+	}
+
+	res, err := tx.ExecContext(ctx, `
+	INSERT INTO work_queue (queue, item_id)
+	SELECT $1, id FROM unnest($2::int[]) AS id
+	ON CONFLICT (queue, item_id) DO UPDATE SET
+		done_at = NULL,
+		worker = NULL,
+		lease_until = NULL,
+		enqueued_at = NOW()
+	WHERE work_queue.done_at < $3::timestamptz`,
+		queue, pq.Array(ids), listedAt)
+	if err != nil {
+		return 0, fmt.Errorf("enqueue %s work: %w", queue, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ClaimWork leases up to n unfinished items of queue among ids to worker, in
+// the order of ids. Items leased by another worker are skipped, not waited
+// for; those whose lease expired are taken over. The claimed ids are returned
+// in the order of ids.
+func ClaimWork(ctx context.Context, db *sqlx.DB, queue, worker string, ids []int, n int, lease time.Duration) ([]int, error) {
+	defer metrics.ObserveDBWrite("claim_work", time.Now())
+
+	var claimed []int
+	err := db.SelectContext(ctx, &claimed, `
+	UPDATE work_queue w SET
+		worker = $2,
+		lease_until = NOW() + INTERVAL '1 second' * $5::float8,
+		claimed_at = NOW(),
+		attempts = w.attempts + 1
+	FROM (
+		SELECT queue, item_id
+		FROM work_queue
+		WHERE queue = $1
+		AND item_id = ANY($3::int[])
+		AND done_at IS NULL
+		AND (lease_until IS NULL OR lease_until < NOW())
+		ORDER BY array_position($3::int[], item_id)
+		LIMIT $4
+		FOR UPDATE SKIP LOCKED
+	) c
+	WHERE w.queue = c.queue AND w.item_id = c.item_id
+	RETURNING w.item_id`,
+		queue, worker, pq.Array(ids), n, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("claim %s work: %w", queue, err)
+	}
+
+	return inputOrder(claimed, ids), nil
+}
+
+// inputOrder sorts claimed, a subset of ids, into the order of ids, as
+// RETURNING does not keep the order the rows were picked in.
+func inputOrder(claimed, ids []int) []int {
+	pos := make(map[int]int, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		pos[ids[i]] = i
+	}
+	slices.SortFunc(claimed, func(a, b int) int { return pos[a] - pos[b] })
+	return claimed
+}
+
+// ExtendWorkLeases renews the lease of every unfinished item worker holds on
+// queue and returns how many it still holds.
+func ExtendWorkLeases(ctx context.Context, db *sqlx.DB, queue, worker string, lease time.Duration) (int64, error) {
+	res, err := db.ExecContext(ctx, `
+	UPDATE work_queue SET lease_until = NOW() + INTERVAL '1 second' * $3::float8
+	WHERE queue = $1 AND worker = $2
+	AND done_at IS NULL AND lease_until IS NOT NULL`,
+		queue, worker, lease.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("extend %s leases: %w", queue, err)
+	}
+	return res.RowsAffected()
+}
+
+// FinishWork marks ids done. Items whose lease has meanwhile gone to another
+// worker are left to that worker.
+func FinishWork(ctx context.Context, db *sqlx.DB, queue, worker string, ids []int) error {
+	defer metrics.ObserveDBWrite("finish_work", time.Now())
+
+	_, err := db.ExecContext(ctx, `
+	UPDATE work_queue SET done_at = clock_timestamp(), lease_until = NULL
+	WHERE queue = $1 AND worker = $2 AND item_id = ANY($3::int[])
+	AND done_at IS NULL`,
+		queue, worker, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("finish %s work: %w", queue, err)
+	}
+	return nil
+}
+
+// ReleaseWork hands every unfinished item worker holds on queue back to the
+// pool, returning how many there were.
+func ReleaseWork(ctx context.Context, db *sqlx.DB, queue, worker string) (int64, error) {
+	res, err := db.ExecContext(ctx, `
+	UPDATE work_queue SET worker = NULL, lease_until = NULL
+	WHERE queue = $1 AND worker = $2
+	AND done_at IS NULL AND lease_until IS NOT NULL`,
+		queue, worker)
+	if err != nil {
+		return 0, fmt.Errorf("release %s work: %w", queue, err)
+	}
+	return res.RowsAffected()
+}
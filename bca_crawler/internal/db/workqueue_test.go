@@ -0,0 +1,28 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestInputOrder(t *testing.T) {
+	tests := []struct {
+		claimed []int
+		ids     []int
+		want    []int
+	}{
+		{[]int{1, 2, 3}, []int{3, 1, 2}, []int{3, 1, 2}},
+		// Priority order, not ann_id order
+		{[]int{10, 40, 20}, []int{40, 30, 10, 20}, []int{40, 10, 20}},
+		// A repeated id keeps its first position
+		{[]int{5, 7}, []int{7, 5, 7}, []int{7, 5}},
+		{nil, []int{1, 2}, nil},
+	}
+
+	for _, tt := range tests {
+		got := inputOrder(slices.Clone(tt.claimed), tt.ids)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("inputOrder(%v, %v) = %v, want %v", tt.claimed, tt.ids, got, tt.want)
+		}
+	}
+}
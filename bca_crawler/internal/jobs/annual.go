@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/people"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// ExtractAnnualReports reads the director profiles, company secretaries and
+// substantial shareholders out of the extracted text of the annual reports
+// this worker claims and persists them into the ext_* tables cmd/import-people
+// fills. It returns how many reports were done; each is recorded in
+// annual_reports so it is imported once.
+func ExtractAnnualReports(ctx context.Context, log logrus.FieldLogger, run *Run, cfg *utils.Config, database *sqlx.DB) (int, error) {
+	claims, err := OpenClaims(ctx, log, database, cfg, QueueAnnual)
+	if err != nil {
+		return 0, err
+	}
+	defer claims.Close()
+
+	reports, err := db.FetchPendingAnnualReports(ctx, database)
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("Found %d annual reports to extract", len(reports))
+
+	byID := make(map[int]*models.AnnualReport, len(reports))
+	ids := make([]int, len(reports))
+	for i, r := range reports {
+		byID[r.AnnID] = r
+		ids[i] = r.AnnID
+	}
+
+	if err := claims.Enqueue(ctx, ids); err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for ctx.Err() == nil {
+		batch, err := claims.Next(ctx, ids)
+		if err != nil {
+			return done, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, id := range batch {
+			if ctx.Err() != nil {
+				break
+			}
+
+			report := byID[id]
+			log := log.WithField(utils.FieldAnnID, id)
+
+			store, err := extractAnnualReport(ctx, database, report)
+			metrics.ParseResult("annual_report", err)
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				log.Errorf("[Error] Failed to extract annual report: %v", err)
+				run.Failed(fmt.Errorf("ann_id %d: %w", id, err))
+				claims.Finish(ctx, id)
+				continue
+			}
+
+			log.Infof("Extracted %d profiles, %d company secretaries and %d substantial shareholders from the %s annual report",
+				len(store.People), len(store.CompanySecretaries), len(store.SubShareholders), report.CompanyName)
+			run.Parsed(store.Len())
+			claims.Finish(ctx, id)
+			done++
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return done, err
+	}
+
+	log.Infof("Completed. Extracted %d annual reports.", done)
+	return done, nil
+}
+
+// extractAnnualReport parses the attachment text of report and saves what
+// it found.
+func extractAnnualReport(ctx context.Context, database *sqlx.DB, report *models.AnnualReport) (*people.DataStore, error) {
+	pages, err := db.FetchAttachmentText(ctx, database, report.AnnID)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &people.DataStore{}
+	services.ParseAnnualReport(report, pages, store)
+
+	if err := db.SaveAnnualReport(ctx, database, report, store); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// tablesMaxAttempts is how often parsing the tables of one attachment is
+// tried before it is left alone until its content changes.
+const tablesMaxAttempts = 3
+
+// ParseAttachmentTables reads the tables of the downloaded spreadsheet and
+// CSV attachments this worker claims into attachment_tables and returns how
+// many attachments were done. Each table is mapped by the category of its
+// announcement; files without a table of a known type are recorded as failed,
+// like any other failure, and retried on later runs.
+func ParseAttachmentTables(ctx context.Context, log logrus.FieldLogger, run *Run, cfg *utils.Config, database *sqlx.DB) (int, error) {
+	claims, err := OpenClaims(ctx, log, database, cfg, QueueTables)
+	if err != nil {
+		return 0, err
+	}
+	defer claims.Close()
+
+	atts, err := db.FetchPendingTableAttachments(ctx, database, tablesMaxAttempts)
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("Found %d spreadsheet attachments to parse", len(atts))
+
+	byID := make(map[int]*models.TableAttachment, len(atts))
+	ids := make([]int, len(atts))
+	for i, a := range atts {
+		byID[a.ID] = a
+		ids[i] = a.ID
+	}
+
+	if err := claims.Enqueue(ctx, ids); err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for ctx.Err() == nil {
+		batch, err := claims.Next(ctx, ids)
+		if err != nil {
+			return done, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, id := range batch {
+			if ctx.Err() != nil {
+				break
+			}
+
+			a := byID[id]
+			log := log.WithField(utils.FieldAnnID, a.AnnID)
+
+			// ParseTableAttachment records the result of each table
+			records, err := services.ParseTableAttachment(filepath.Join(cfg.DownloadDir, a.StoragePath), a.Category)
+			if err == nil {
+				err = db.SaveAttachmentTables(ctx, database, &a.Attachment, records)
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				if serr := db.RecordAttachmentTablesFailure(ctx, database, &a.Attachment, err.Error()); serr != nil {
+					log.Errorf("[Error] Failed to record table parse failure: %v", serr)
+				}
+				log.Errorf("[Error] Failed to parse the tables of %s: %v", a.StoragePath, err)
+				run.Failed(fmt.Errorf("ann_id %d: parse %s: %w", a.AnnID, a.StoragePath, err))
+				claims.Finish(ctx, id)
+				continue
+			}
+
+			log.Infof("Read %d buy backs, %d dealings and %d market statistics from %s",
+				len(records.BuyBacks), len(records.Dealings), len(records.MarketStats), a.StoragePath)
+			run.Parsed(records.Len())
+			claims.Finish(ctx, id)
+			done++
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return done, err
+	}
+
+	log.Infof("Completed. Parsed %d spreadsheet attachments.", done)
+	return done, nil
+}
@@ -0,0 +1,109 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// textMaxAttempts is how often extracting the text of one attachment is
+// tried before it is left alone until its content changes.
+const textMaxAttempts = 3
+
+// ExtractAttachmentText extracts the page text of the downloaded PDF
+// attachments this worker claims into attachment_text and returns how many
+// attachments were done. Failures are recorded in attachment_extractions and
+// retried on later runs.
+func ExtractAttachmentText(ctx context.Context, log logrus.FieldLogger, run *Run, cfg *utils.Config, database *sqlx.DB) (int, error) {
+	claims, err := OpenClaims(ctx, log, database, cfg, QueueText)
+	if err != nil {
+		return 0, err
+	}
+	defer claims.Close()
+
+	atts, err := db.FetchPendingTextAttachments(ctx, database, textMaxAttempts)
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("Found %d attachments to extract", len(atts))
+
+	byID := make(map[int]*models.Attachment, len(atts))
+	ids := make([]int, len(atts))
+	for i, a := range atts {
+		byID[a.ID] = a
+		ids[i] = a.ID
+	}
+
+	if err := claims.Enqueue(ctx, ids); err != nil {
+		return 0, err
+	}
+
+	// Announcements sharing one file are extracted once per batch
+	extracted := make(map[string][]string)
+
+	done := 0
+	for ctx.Err() == nil {
+		batch, err := claims.Next(ctx, ids)
+		if err != nil {
+			return done, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		clear(extracted)
+
+		for _, id := range batch {
+			if ctx.Err() != nil {
+				break
+			}
+
+			a := byID[id]
+			log := log.WithField(utils.FieldAnnID, a.AnnID)
+
+			var err error
+			pages, ok := extracted[a.SHA256]
+			if !ok {
+				pages, err = services.ExtractPDFText(filepath.Join(cfg.DownloadDir, a.StoragePath))
+				metrics.ParseResult("attachment_text", err)
+			}
+			if err == nil {
+				extracted[a.SHA256] = pages
+				err = db.SaveAttachmentText(ctx, database, a, pages)
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				// A failed save counts as an attempt too, so an attachment
+				// whose text cannot be stored is not retried forever.
+				if serr := db.RecordAttachmentTextFailure(ctx, database, a, err.Error()); serr != nil {
+					log.Errorf("[Error] Failed to record extraction failure: %v", serr)
+				}
+				log.Errorf("[Error] Failed to extract text of %s: %v", a.StoragePath, err)
+				run.Failed(fmt.Errorf("ann_id %d: extract %s: %w", a.AnnID, a.StoragePath, err))
+				claims.Finish(ctx, id)
+				continue
+			}
+
+			log.Infof("Extracted %d pages of %s", len(pages), a.StoragePath)
+			run.Parsed(1)
+			claims.Finish(ctx, id)
+			done++
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return done, err
+	}
+
+	log.Infof("Completed. Extracted %d attachments.", done)
+	return done, nil
+}
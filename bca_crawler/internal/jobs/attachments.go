@@ -0,0 +1,230 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// DownloadAttachments downloads the attachments of the recent announcements
+// this worker claims into the sharded layout of buildAttachmentPath, records
+// each file in the announcement_attachments manifest and returns how many
+// announcements were done. Each claimed batch is downloaded at once on the
+// worker pool of services.Downloader; files already stored are not fetched
+// again.
+func DownloadAttachments(ctx context.Context, log logrus.FieldLogger, run *Run, cfg *utils.Config, database *sqlx.DB) (int, error) {
+	downloader, err := services.NewDownloader(cfg, log)
+	if err != nil {
+		return 0, err
+	}
+	defer downloader.Close()
+
+	claims, err := OpenClaims(ctx, log, database, cfg, QueueAttachments)
+	if err != nil {
+		return 0, err
+	}
+	defer claims.Close()
+
+	data, err := db.FetchAnnouncementsByCategory(ctx, database, "attachments")
+	if err != nil {
+		return 0, fmt.Errorf("fetch attachments: %w", err)
+	}
+
+	// Partial downloads are kept here and resumed on the next run
+	partDir := filepath.Join(cfg.DownloadDir, ".partial")
+	if err := os.MkdirAll(partDir, 0755); err != nil {
+		return 0, fmt.Errorf("create directory %s: %w", partDir, err)
+	}
+
+	updated := 0
+	err = claims.eachBatch(ctx, data, func(batch []*models.Announcement) error {
+		// Announcements linking the same file share one download
+		wanted := make(map[string][]*models.Announcement)
+		var reqs []services.DownloadRequest
+
+		for _, ann := range batch {
+			log := log.WithField(utils.FieldAnnID, ann.AnnID)
+
+			for _, url := range attachmentURLs(cfg, ann) {
+				stored, err := reuseAttachment(ctx, cfg, database, ann, url)
+				if err != nil {
+					log.Errorf("[Error] Failed to look up %s: %v", url, err)
+					run.Failed(fmt.Errorf("ann_id %d: look up %s: %w", ann.AnnID, url, err))
+					continue
+				}
+				if stored {
+					run.Skipped(1)
+					continue
+				}
+
+				if _, ok := wanted[url]; !ok {
+					reqs = append(reqs, services.DownloadRequest{URL: url, Path: services.PartPath(partDir, url), Log: log})
+				}
+				wanted[url] = append(wanted[url], ann)
+			}
+		}
+
+		downloader.DownloadAll(ctx, reqs, func(res *services.Download) {
+			if res.Err != nil && ctx.Err() != nil {
+				return
+			}
+
+			for _, ann := range wanted[res.URL] {
+				log := log.WithField(utils.FieldAnnID, ann.AnnID)
+
+				err := res.Err
+				if err == nil {
+					err = storeAttachment(ctx, cfg, database, ann, res)
+				} else {
+					failed := &models.Attachment{AnnID: ann.AnnID, URL: res.URL, Status: models.AttachmentFailed, LastError: utils.PtrString(err.Error())}
+					if serr := db.SaveAttachment(ctx, database, failed); serr != nil {
+						log.Errorf("[Error] Failed to record attachment failure: %v", serr)
+					}
+				}
+				if err != nil {
+					log.Errorf("[Error] Failed to download %s: %v", res.URL, err)
+					run.Failed(fmt.Errorf("ann_id %d: download %s: %w", ann.AnnID, res.URL, err))
+					continue
+				}
+				run.Fetched(1)
+			}
+		})
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		log.Infof("Downloaded %d attachments for %d announcements", len(reqs), len(batch))
+
+		updated += len(batch)
+		return nil
+	})
+	if err != nil {
+		return updated, err
+	}
+
+	log.Infof("Completed. Processed %d records.", updated)
+	return updated, nil
+}
+
+// attachmentURLs returns the absolute attachment URLs of ann.
+func attachmentURLs(cfg *utils.Config, ann *models.Announcement) []string {
+	var urls []string
+	for _, attURL := range ann.Attachments {
+		if attURL == "" {
+			continue
+		}
+
+		if !strings.Contains(attURL, "http") {
+			urls = append(urls, cfg.DetailDomain+attURL)
+		} else {
+			urls = append(urls, attURL)
+		}
+	}
+	return urls
+}
+
+// reuseAttachment reports whether the file at url is already stored, for ann
+// or another announcement. A copy stored for another announcement is recorded
+// against ann as well.
+func reuseAttachment(ctx context.Context, cfg *utils.Config, database *sqlx.DB, ann *models.Announcement, url string) (bool, error) {
+	stored, err := db.FetchStoredAttachment(ctx, database, ann.AnnID, url)
+	if err != nil {
+		return false, err
+	}
+	if stored == nil || !fileExists(filepath.Join(cfg.DownloadDir, stored.StoragePath)) {
+		return false, nil
+	}
+	if stored.AnnID == ann.AnnID {
+		return true, nil
+	}
+
+	att := *stored
+	att.AnnID = ann.AnnID
+	return true, db.SaveAttachment(ctx, database, &att)
+}
+
+// storeAttachment moves the finished download res into the attachment
+// directory of ann and records it in the manifest. A file whose content is
+// already stored is recorded against the existing copy instead, which is also
+// how the other announcements sharing one download find its file.
+func storeAttachment(ctx context.Context, cfg *utils.Config, database *sqlx.DB, ann *models.Announcement, res *services.Download) error {
+	att := &models.Attachment{
+		AnnID:    ann.AnnID,
+		URL:      res.URL,
+		Filename: res.Filename,
+		MIME:     res.MIME,
+		Size:     res.Size,
+		SHA256:   res.SHA256,
+		Status:   models.AttachmentDownloaded,
+	}
+
+	dup, err := db.FetchAttachmentBySHA256(ctx, database, res.SHA256)
+	if err != nil {
+		return err
+	}
+	if dup != nil && fileExists(filepath.Join(cfg.DownloadDir, dup.StoragePath)) {
+		os.Remove(res.Path)
+		att.StoragePath = dup.StoragePath
+	} else {
+		dir := buildAttachmentPath("", ann.AnnID, ann.DatePosted)
+		if err := os.MkdirAll(filepath.Join(cfg.DownloadDir, dir), 0755); err != nil {
+			return fmt.Errorf("create directory %s: %w", dir, err)
+		}
+
+		// Two attachments of one announcement may share a name
+		att.StoragePath = filepath.Join(dir, res.Filename)
+		if fileExists(filepath.Join(cfg.DownloadDir, att.StoragePath)) {
+			ext := filepath.Ext(res.Filename)
+			att.StoragePath = filepath.Join(dir, strings.TrimSuffix(res.Filename, ext)+"-"+res.SHA256[:8]+ext)
+		}
+
+		// The part file is on the same filesystem, so the move is atomic
+		if err := os.Rename(res.Path, filepath.Join(cfg.DownloadDir, att.StoragePath)); err != nil {
+			return fmt.Errorf("move file: %w", err)
+		}
+	}
+
+	return db.SaveAttachment(ctx, database, att)
+}
+
+func fileExists(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// buildAttachmentPath returns the directory of an announcement's attachments,
+// sharded by month and the leading digits of the ann_id, e.g.
+// base/2024-05/12/34/123456.
+func buildAttachmentPath(base string, annID int, annDate time.Time) string {
+	id := strconv.Itoa(annID)
+
+	// zfill(4)
+	if len(id) < 4 {
+		id = strings.Repeat("0", 4-len(id)) + id
+	}
+
+	shard1 := id[:2]
+	shard2 := id[2:4]
+
+	month := annDate.Format("2006-01")
+
+	return filepath.Join(
+		base,
+		month,
+		shard1,
+		shard2,
+		strconv.Itoa(annID),
+	)
+}
@@ -0,0 +1,150 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"bca_crawler/internal/db"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Backfill selects explicit ann_ids to crawl instead of resuming after the
+// highest ID in the crawl ledger.
+type Backfill struct {
+	From      int
+	To        int
+	IDsFile   string
+	SinceDate string
+	Force     bool
+}
+
+// RegisterFlags registers the backfill flags on fs.
+func (b *Backfill) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&b.From, "from", 0, "Backfill: first ann_id of the range")
+	fs.IntVar(&b.To, "to", 0, "Backfill: last ann_id of the range (default: latest on Bursa)")
+	fs.StringVar(&b.IDsFile, "ids", "", "Backfill: file of ann_ids, one per line")
+	fs.StringVar(&b.SinceDate, "since-date", "", "Backfill: every ann_id from the first posted on this date (YYYY-MM-DD)")
+	fs.BoolVar(&b.Force, "force", false, "Backfill: re-fetch ann_ids that are already stored")
+}
+
+func (b Backfill) Enabled() bool {
+	return b.From > 0 || b.To > 0 || b.IDsFile != "" || b.SinceDate != ""
+}
+
+// resolve returns the ann_ids to crawl in ascending order. latest is only
+// called when the range has no -to. Unless force is set, ann_ids that are
+// already stored are dropped.
+func (b Backfill) resolve(ctx context.Context, database *sqlx.DB, latest func() (int, error)) ([]int, error) {
+	wanted := make(map[int]bool)
+
+	if b.IDsFile != "" {
+		ids, err := readIDFile(b.IDsFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			wanted[id] = true
+		}
+	}
+
+	if b.From > 0 || b.To > 0 || b.SinceDate != "" {
+		if b.From > 0 && b.SinceDate != "" {
+			return nil, fmt.Errorf("[Error] use either -from or -since-date, not both")
+		}
+
+		from := b.From
+		if b.SinceDate != "" {
+			since, err := time.Parse("2006-01-02", b.SinceDate)
+			if err != nil {
+				return nil, fmt.Errorf("[Error] invalid -since-date %q: %w", b.SinceDate, err)
+			}
+			if from, err = db.GetFirstAnnIDSince(ctx, database, since); err != nil {
+				return nil, err
+			}
+			if from == 0 {
+				return nil, fmt.Errorf("[Error] no stored announcements posted since %s", b.SinceDate)
+			}
+		}
+		if from == 0 {
+			return nil, fmt.Errorf("[Error] -to needs -from or -since-date")
+		}
+
+		to := b.To
+		if to == 0 {
+			var err error
+			if to, err = latest(); err != nil {
+				return nil, err
+			}
+		}
+		if from > to {
+			return nil, fmt.Errorf("[Error] empty range %d..%d", from, to)
+		}
+
+		for id := from; id <= to; id++ {
+			wanted[id] = true
+		}
+	}
+
+	ids := make([]int, 0, len(wanted))
+	for id := range wanted {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	if b.Force || len(ids) == 0 {
+		return ids, nil
+	}
+
+	stored, err := db.FetchStoredAnnIDs(ctx, database, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := ids[:0]
+	for _, id := range ids {
+		if !stored[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
+// readIDFile reads ann_ids separated by newlines, commas or spaces. Blank
+// lines and lines starting with # are ignored.
+func readIDFile(path string) ([]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("[Error] open ids file: %w", err)
+	}
+	defer f.Close()
+
+	var ids []int
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			id, err := strconv.Atoi(field)
+			if err != nil || id <= 0 {
+				return nil, fmt.Errorf("[Error] %s:%d: invalid ann_id %q", path, line, field)
+			}
+			ids = append(ids, id)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("[Error] read ids file: %w", err)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,339 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// Work queues shared by every host running the crawler and parsers.
+const (
+	QueueCrawl        = "crawl"
+	QueueParse        = "parse"
+	QueueBoardroom    = "parse-board"
+	QueueShareholding = "parse-sholder"
+	QueueAttachments  = "attachments"
+	QueueText         = "attachment-text"
+	QueueTables       = "attachment-tables"
+	QueueAnnual       = "ext-annual"
+)
+
+// releaseTimeout bounds handing unfinished items back when claims close,
+// which happens even after the run's context was cancelled.
+const releaseTimeout = 10 * time.Second
+
+// Claims hands this process its share of one work queue, so several hosts can
+// work against the same database without doing an item twice. Items are
+// leased with SKIP LOCKED and a heartbeat renews the leases while the process
+// is alive; the items of a worker that crashed return to the pool once their
+// lease expires.
+type Claims struct {
+	log      logrus.FieldLogger
+	work     workQueue
+	store    services.CrawlStore
+	queue    string
+	worker   string
+	lease    time.Duration
+	batch    int
+	listedAt time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// OpenClaims starts working on queue. Open it before selecting the items to
+// enqueue: an item another worker finishes after that point is not queued
+// again from this worker's older selection.
+func OpenClaims(ctx context.Context, log logrus.FieldLogger, database *sqlx.DB, cfg *utils.Config, queue string) (*Claims, error) {
+	listedAt, err := db.Now(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newClaims(log, dbWorkQueue{DB: database}, cfg, queue, workerID(), listedAt)
+	c.store = services.DBCrawlStore{DB: database}
+	return c, nil
+}
+
+// newClaims starts worker on queue in work.
+func newClaims(log logrus.FieldLogger, work workQueue, cfg *utils.Config, queue, worker string, listedAt time.Time) *Claims {
+	c := &Claims{
+		log:      log,
+		work:     work,
+		queue:    queue,
+		worker:   worker,
+		lease:    cfg.ClaimLease,
+		batch:    cfg.ClaimBatch,
+		listedAt: listedAt,
+		stop:     make(chan struct{}),
+	}
+
+	c.wg.Add(1)
+	go c.heartbeat()
+
+	return c
+}
+
+// workQueue is the shared work_queue table Claims leases items from.
+type workQueue interface {
+	Enqueue(ctx context.Context, queue string, ids []int, listedAt time.Time) (int64, error)
+	Claim(ctx context.Context, queue, worker string, ids []int, n int, lease time.Duration) ([]int, error)
+	Extend(ctx context.Context, queue, worker string, lease time.Duration) (int64, error)
+	Finish(ctx context.Context, queue, worker string, ids []int) error
+	Release(ctx context.Context, queue, worker string) (int64, error)
+}
+
+// dbWorkQueue is the workQueue in the database.
+type dbWorkQueue struct {
+	DB *sqlx.DB
+}
+
+func (q dbWorkQueue) Enqueue(ctx context.Context, queue string, ids []int, listedAt time.Time) (int64, error) {
+	return db.EnqueueWork(ctx, q.DB, queue, ids, listedAt)
+}
+
+func (q dbWorkQueue) Claim(ctx context.Context, queue, worker string, ids []int, n int, lease time.Duration) ([]int, error) {
+	return db.ClaimWork(ctx, q.DB, queue, worker, ids, n, lease)
+}
+
+func (q dbWorkQueue) Extend(ctx context.Context, queue, worker string, lease time.Duration) (int64, error) {
+	return db.ExtendWorkLeases(ctx, q.DB, queue, worker, lease)
+}
+
+func (q dbWorkQueue) Finish(ctx context.Context, queue, worker string, ids []int) error {
+	return db.FinishWork(ctx, q.DB, queue, worker, ids)
+}
+
+func (q dbWorkQueue) Release(ctx context.Context, queue, worker string) (int64, error) {
+	return db.ReleaseWork(ctx, q.DB, queue, worker)
+}
+
+// workerID names this process in the work queue.
+func workerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s/%d/%s", host, os.Getpid(), utils.RunID)
+}
+
+// heartbeat renews the held leases three times per lease period.
+func (c *Claims) heartbeat() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), c.lease/3)
+			if _, err := c.work.Extend(ctx, c.queue, c.worker, c.lease); err != nil {
+				c.log.Errorf("[Error] Failed to renew %s leases: %v", c.queue, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Enqueue adds ids to the queue.
+func (c *Claims) Enqueue(ctx context.Context, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	n, err := c.work.Enqueue(ctx, c.queue, ids, c.listedAt)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		c.log.Infof("Queued %d new %s items", n, c.queue)
+	}
+	return nil
+}
+
+// Next claims the next batch of unfinished items among ids, in the order of
+// ids. It returns none once every one of them is done or leased to another
+// worker.
+func (c *Claims) Next(ctx context.Context, ids []int) ([]int, error) {
+	return c.work.Claim(ctx, c.queue, c.worker, ids, c.batch, c.lease)
+}
+
+// Finish marks ids done. A failure only means the items are redone once
+// their lease expires, so it is logged rather than returned.
+func (c *Claims) Finish(ctx context.Context, ids ...int) {
+	if len(ids) == 0 {
+		return
+	}
+	if err := c.work.Finish(ctx, c.queue, c.worker, ids); err != nil {
+		c.log.Errorf("[Error] Failed to finish %s items: %v", c.queue, err)
+	}
+}
+
+// Close stops the heartbeat and hands the items claimed but not finished
+// back to the pool.
+func (c *Claims) Close() {
+	close(c.stop)
+	c.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	n, err := c.work.Release(ctx, c.queue, c.worker)
+	if err != nil {
+		c.log.Errorf("[Error] Failed to release %s items: %v", c.queue, err)
+		return
+	}
+	if n > 0 {
+		c.log.Infof("Released %d unfinished %s items", n, c.queue)
+	}
+}
+
+// eachAnnouncement queues the announcements and calls fn on each one this
+// worker claims, in the order of anns, finishing it once fn returns nil. An error
+// from fn stops the loop.
+func (c *Claims) eachAnnouncement(ctx context.Context, anns []*models.Announcement, fn func(ann *models.Announcement) error) error {
+	return c.claimAnnouncements(ctx, anns, func(batch []*models.Announcement) error {
+		for _, ann := range batch {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(ann); err != nil {
+				return err
+			}
+			if ctx.Err() == nil {
+				c.Finish(ctx, ann.AnnID)
+			}
+		}
+		return nil
+	})
+}
+
+// eachBatch is eachAnnouncement for work done a whole claimed batch at a
+// time; the batch is finished once fn returns nil.
+func (c *Claims) eachBatch(ctx context.Context, anns []*models.Announcement, fn func(batch []*models.Announcement) error) error {
+	return c.claimAnnouncements(ctx, anns, func(batch []*models.Announcement) error {
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if ctx.Err() == nil {
+			ids := make([]int, len(batch))
+			for i, ann := range batch {
+				ids[i] = ann.AnnID
+			}
+			c.Finish(ctx, ids...)
+		}
+		return nil
+	})
+}
+
+// claimAnnouncements queues the ann_ids of anns and hands fn each batch of
+// them this worker claims until none are left.
+func (c *Claims) claimAnnouncements(ctx context.Context, anns []*models.Announcement, fn func(batch []*models.Announcement) error) error {
+	byID := make(map[int]*models.Announcement, len(anns))
+	ids := make([]int, 0, len(anns))
+	for _, ann := range anns {
+		if _, dup := byID[ann.AnnID]; !dup {
+			ids = append(ids, ann.AnnID)
+		}
+		byID[ann.AnnID] = ann
+	}
+
+	if err := c.Enqueue(ctx, ids); err != nil {
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		claimed, err := c.Next(ctx, ids)
+		if err != nil {
+			return err
+		}
+		if len(claimed) == 0 {
+			return nil
+		}
+
+		batch := make([]*models.Announcement, len(claimed))
+		for i, id := range claimed {
+			batch[i] = byID[id]
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+}
+
+// Crawl queues ids and crawls the ones this worker claims, a batch at a time
+// in the order of ids.
+// Every id whose attempt was recorded is finished, including those committed
+// after ctx was cancelled. When the circuit breaker halts the crawl no more
+// batches are claimed and retry.ErrCircuitOpen is returned.
+func (c *Claims) Crawl(ctx context.Context, run *Run, fetchers []services.Fetcher, cfg *utils.Config, ids []int) error {
+	if err := c.Enqueue(ctx, ids); err != nil {
+		return err
+	}
+
+	store := &recordedStore{CrawlStore: run.CrawlStore(c.store)}
+	for ctx.Err() == nil {
+		batch, err := c.Next(ctx, ids)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		_, err = services.CrawlAnnouncements(ctx, c.log, fetchers, cfg, batch, store)
+		c.Finish(context.WithoutCancel(ctx), store.take()...)
+		if err != nil {
+			// A halted breaker fails every later batch as well; the rest of
+			// the queue is left to the next run.
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// recordedStore collects the ann_ids whose crawl attempt was recorded.
+type recordedStore struct {
+	services.CrawlStore
+
+	mu  sync.Mutex
+	ids []int
+}
+
+func (s *recordedStore) RecordCrawlAttempt(ctx context.Context, a *models.CrawlAttempt) error {
+	if err := s.CrawlStore.RecordCrawlAttempt(ctx, a); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids = append(s.ids, a.AnnID)
+	return nil
+}
+
+// take returns the ids recorded since the last call.
+func (s *recordedStore) take() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := slices.Clone(s.ids)
+	s.ids = s.ids[:0]
+	return ids
+}
@@ -0,0 +1,355 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/retry"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+)
+
+// memQueue is a workQueue in memory with the semantics of the work_queue
+// table: a claim skips items done or leased to another worker, as SKIP LOCKED
+// and the lease check do, and takes over items whose lease expired.
+type memQueue struct {
+	mu    sync.Mutex
+	now   time.Time
+	items map[int]*memItem
+}
+
+type memItem struct {
+	worker     string
+	leaseUntil time.Time
+	done       bool
+	claims     int
+}
+
+func newMemQueue() *memQueue {
+	return &memQueue{now: time.Date(2025, 10, 17, 9, 0, 0, 0, time.UTC), items: make(map[int]*memItem)}
+}
+
+func (q *memQueue) advance(d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.now = q.now.Add(d)
+}
+
+func (q *memQueue) leased(it *memItem) bool {
+	return it.worker != "" && !it.leaseUntil.Before(q.now)
+}
+
+func (q *memQueue) Enqueue(_ context.Context, _ string, ids []int, _ time.Time) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var n int64
+	for _, id := range ids {
+		if _, ok := q.items[id]; !ok {
+			q.items[id] = &memItem{}
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (q *memQueue) Claim(_ context.Context, _, worker string, ids []int, n int, lease time.Duration) ([]int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var claimed []int
+	for _, id := range ids {
+		it, ok := q.items[id]
+		if len(claimed) == n {
+			break
+		}
+		if !ok || it.done || q.leased(it) || slices.Contains(claimed, id) {
+			continue
+		}
+		it.worker, it.leaseUntil = worker, q.now.Add(lease)
+		it.claims++
+		claimed = append(claimed, id)
+	}
+	return claimed, nil
+}
+
+func (q *memQueue) Extend(_ context.Context, _, worker string, lease time.Duration) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var n int64
+	for _, it := range q.items {
+		if it.worker == worker && !it.done && !it.leaseUntil.IsZero() {
+			it.leaseUntil = q.now.Add(lease)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (q *memQueue) Finish(_ context.Context, _, worker string, ids []int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, id := range ids {
+		if it, ok := q.items[id]; ok && it.worker == worker {
+			it.done, it.leaseUntil = true, time.Time{}
+		}
+	}
+	return nil
+}
+
+func (q *memQueue) Release(_ context.Context, _, worker string) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var n int64
+	for _, it := range q.items {
+		if it.worker == worker && !it.done && !it.leaseUntil.IsZero() {
+			it.worker, it.leaseUntil = "", time.Time{}
+			n++
+		}
+	}
+	return n, nil
+}
+
+func testClaims(q *memQueue, worker string, batch int) *Claims {
+	cfg := &utils.Config{ClaimLease: time.Minute, ClaimBatch: batch}
+	return newClaims(utils.Logger, q, cfg, QueueCrawl, worker, q.now)
+}
+
+func TestClaimsOrder(t *testing.T) {
+	q := newMemQueue()
+	c := testClaims(q, "a", 2)
+	defer c.Close()
+
+	// Listed ids come in priority order, not ann_id order
+	ids := []int{50, 10, 40, 20, 30}
+	if err := c.Enqueue(context.Background(), ids); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []int
+	for {
+		batch, err := c.Next(context.Background(), ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if len(batch) > 2 {
+			t.Fatalf("claimed %v, more than the batch size", batch)
+		}
+		got = append(got, batch...)
+		c.Finish(context.Background(), batch...)
+	}
+	if !slices.Equal(got, ids) {
+		t.Errorf("claimed %v, want %v", got, ids)
+	}
+}
+
+func TestClaimsLeaseExpiry(t *testing.T) {
+	q := newMemQueue()
+	ids := []int{1, 2, 3, 4}
+
+	// Worker a claims a batch and stops without finishing or releasing it
+	a := testClaims(q, "a", 2)
+	defer close(a.stop)
+	if err := a.Enqueue(context.Background(), ids); err != nil {
+		t.Fatal(err)
+	}
+	held, _ := a.Next(context.Background(), ids)
+	if !slices.Equal(held, []int{1, 2}) {
+		t.Fatalf("a claimed %v, want [1 2]", held)
+	}
+
+	// While the lease holds, b skips a's items
+	b := testClaims(q, "b", 10)
+	defer b.Close()
+	if got, _ := b.Next(context.Background(), ids); !slices.Equal(got, []int{3, 4}) {
+		t.Fatalf("b claimed %v while a's lease held, want [3 4]", got)
+	}
+	b.Finish(context.Background(), 3, 4)
+
+	// Once it expires b takes them over, and a finishing late changes nothing
+	q.advance(time.Minute + time.Second)
+	if got, _ := b.Next(context.Background(), ids); !slices.Equal(got, []int{1, 2}) {
+		t.Fatalf("b claimed %v after a's lease expired, want [1 2]", got)
+	}
+	a.Finish(context.Background(), 1, 2)
+	if q.items[1].done || q.items[2].done {
+		t.Error("a finished items leased to b")
+	}
+	b.Finish(context.Background(), 1, 2)
+	for _, id := range ids {
+		if !q.items[id].done {
+			t.Errorf("item %d not done", id)
+		}
+	}
+	if q.items[1].claims != 2 || q.items[3].claims != 1 {
+		t.Errorf("claims = %d and %d, want 2 and 1", q.items[1].claims, q.items[3].claims)
+	}
+}
+
+func TestClaimsRelease(t *testing.T) {
+	q := newMemQueue()
+	ids := []int{1, 2, 3}
+
+	a := testClaims(q, "a", 3)
+	if err := a.Enqueue(context.Background(), ids); err != nil {
+		t.Fatal(err)
+	}
+	held, _ := a.Next(context.Background(), ids)
+	a.Finish(context.Background(), held[0])
+
+	// Closing hands the unfinished items back at once, without waiting for
+	// the lease to expire
+	a.Close()
+	b := testClaims(q, "b", 3)
+	defer b.Close()
+	if got, _ := b.Next(context.Background(), ids); !slices.Equal(got, []int{2, 3}) {
+		t.Errorf("b claimed %v after a closed, want [2 3]", got)
+	}
+}
+
+func TestClaimsHandoff(t *testing.T) {
+	// Workers sharing a queue each do a disjoint share of it, and together
+	// all of it, in the order of anns.
+	q := newMemQueue()
+	anns := make([]*models.Announcement, 200)
+	for i := range anns {
+		anns[i] = &models.Announcement{AnnID: 1000 - i}
+	}
+
+	var (
+		mu   sync.Mutex
+		done = make(map[int]string)
+		wg   sync.WaitGroup
+	)
+	for w := range 4 {
+		c := testClaims(q, fmt.Sprintf("w%d", w), 7)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer c.Close()
+
+			last := -1
+			err := c.eachAnnouncement(context.Background(), anns, func(ann *models.Announcement) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if prev, dup := done[ann.AnnID]; dup {
+					t.Errorf("%s redid %d after %s", c.worker, ann.AnnID, prev)
+				}
+				done[ann.AnnID] = c.worker
+
+				pos := slices.Index(anns, ann)
+				if pos < last {
+					t.Errorf("%s did %d out of order", c.worker, ann.AnnID)
+				}
+				last = pos
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(done) != len(anns) {
+		t.Errorf("%d of %d items done", len(done), len(anns))
+	}
+	for id, it := range q.items {
+		if !it.done || it.claims != 1 {
+			t.Errorf("item %d: done %t after %d claims", id, it.done, it.claims)
+		}
+	}
+}
+
+// haltingFetcher serves allow pages, then fails like a halted breaker.
+type haltingFetcher struct {
+	mu      sync.Mutex
+	allow   int
+	fetches int
+}
+
+func (f *haltingFetcher) Fetch(ctx context.Context, targetURL string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetches++
+	if f.fetches > f.allow {
+		return "", fmt.Errorf("fetch %s: %w", targetURL, retry.ErrCircuitOpen)
+	}
+	return "<html><body>Announcement</body></html>", nil
+}
+
+func (f *haltingFetcher) Reset() error { return nil }
+
+func (f *haltingFetcher) Close() {}
+
+// ledgerStore keeps the crawl ledger in memory.
+type ledgerStore struct {
+	mu       sync.Mutex
+	attempts []*models.CrawlAttempt
+}
+
+func (s *ledgerStore) SaveAnnouncement(ctx context.Context, a *models.Announcement) error {
+	return nil
+}
+
+func (s *ledgerStore) RecordCrawlAttempt(ctx context.Context, a *models.CrawlAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = append(s.attempts, a)
+	return nil
+}
+
+func TestClaimsCrawlHalted(t *testing.T) {
+	q := newMemQueue()
+	c := testClaims(q, "a", 5)
+	store := &ledgerStore{}
+	c.store = store
+
+	ids := make([]int, 20)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+
+	// The breaker halts on the third ID of the second batch
+	f := &haltingFetcher{allow: 7}
+	cfg := &utils.Config{DetailDomain: "https://disclosure.example", DetailURL: "/view?e=", RetryMaxAttempts: 1}
+	run := &Run{log: utils.Logger}
+
+	err := c.Crawl(context.Background(), run, []services.Fetcher{f}, cfg, ids)
+	if !errors.Is(err, retry.ErrCircuitOpen) {
+		t.Fatalf("Crawl = %v, want ErrCircuitOpen", err)
+	}
+	c.Close()
+
+	if f.fetches != 8 {
+		t.Errorf("fetched %d pages, want 8", f.fetches)
+	}
+	if len(store.attempts) != 7 || run.rec.Fetched != 7 {
+		t.Errorf("recorded %d attempts, %d fetched, want 7", len(store.attempts), run.rec.Fetched)
+	}
+	for _, id := range ids {
+		it := q.items[id]
+		switch {
+		case id <= 7:
+			if !it.done {
+				t.Errorf("item %d not done", id)
+			}
+		case id <= 10:
+			// The rest of the halted batch goes back to the pool
+			if it.done || it.worker != "" {
+				t.Errorf("item %d: done %t, worker %q, want released", id, it.done, it.worker)
+			}
+		default:
+			if it.claims != 0 {
+				t.Errorf("item %d claimed %d times after the breaker halted", id, it.claims)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/retry"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// Crawl fetches new announcements, or the ann_ids selected by bf when it is
+// enabled, and stores them. The ids are shared through the crawl queue with
+// any other host crawling at the same time.
+func Crawl(ctx context.Context, log logrus.FieldLogger, run *Run, cfg *utils.Config, database *sqlx.DB, bf Backfill) error {
+	// Load Bursa main page
+	fetchers, err := services.NewFetchers(cfg, log)
+	if err != nil {
+		return fmt.Errorf("create fetchers: %w", err)
+	}
+	defer services.CloseFetchers(fetchers)
+
+	claims, err := OpenClaims(ctx, log, database, cfg, QueueCrawl)
+	if err != nil {
+		return err
+	}
+	defer claims.Close()
+
+	var ids []int
+	if bf.Enabled() {
+		ids, err = bf.resolve(ctx, database, func() (int, error) {
+			return services.DiscoverMaxAnnID(ctx, fetchers[0], cfg)
+		})
+		if err != nil {
+			return fmt.Errorf("resolve backfill IDs: %w", err)
+		}
+
+		log.Infof("Backfilling %d announcement IDs (force=%t)", len(ids), bf.Force)
+	} else if ids, err = incrementalIDs(ctx, log, cfg, database, fetchers[0]); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	crawlErr := claims.Crawl(ctx, run, fetchers, cfg, ids)
+
+	log.Infof("Fetch outcomes: %s", retry.Metrics)
+	for _, b := range retry.Breakers() {
+		log.Infof("Circuit breaker: %s", b)
+	}
+	if crawlErr != nil {
+		return crawlErr
+	}
+	log.Info("Done scraping all announcements.")
+	return nil
+}
+
+// incrementalIDs returns the ann_ids between the highest one in the crawl
+// ledger and the latest one listed on Bursa.
+func incrementalIDs(ctx context.Context, log logrus.FieldLogger, cfg *utils.Config, database *sqlx.DB, f services.Fetcher) ([]int, error) {
+	maxID, err := services.DiscoverMaxAnnID(ctx, f, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("load start page: %w", err)
+	}
+
+	log.Info("Page loaded successfully, parsing announcements...")
+	if maxID == 0 {
+		log.Warn("No announcements found. Exiting.")
+		return nil, nil
+	}
+
+	log.Infof("Parsed announcements. Max ann_id: %d", maxID)
+
+	// Resume after the highest ann_id in the crawl ledger; lower ids that were
+	// never attempted are left to crawler-backup
+	if synced, err := db.SyncCrawlLedger(ctx, database); err != nil {
+		log.Errorf("[Error] Failed to sync crawl ledger: %v", err)
+	} else if synced > 0 {
+		log.Infof("Added %d stored announcements to the crawl ledger", synced)
+	}
+
+	// Without the ledger there is no safe place to start; guessing 1 would
+	// recrawl the whole ID space
+	data, err := db.GetLedgerMaxAnnID(ctx, database)
+	if err != nil {
+		return nil, fmt.Errorf("fetch max ann_id from crawl ledger: %w", err)
+	}
+	if data >= maxID {
+		log.Info("Database is already up-to-date. No new announcements to scrape.")
+		return nil, nil
+	}
+
+	startID := data + 1
+
+	log.Infof("Starting from ann_id: %d", startID)
+
+	ids := make([]int, 0, maxID-startID+1)
+	for i := startID; i <= maxID; i++ {
+		ids = append(ids, i)
+	}
+	return ids, nil
+}
@@ -0,0 +1,161 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// ParseAnnouncements parses the stored page of every unparsed announcement
+// this worker claims and returns how many were updated.
+func ParseAnnouncements(ctx context.Context, log logrus.FieldLogger, run *Run, cfg *utils.Config, database *sqlx.DB) (int, error) {
+	claims, err := OpenClaims(ctx, log, database, cfg, QueueParse)
+	if err != nil {
+		return 0, err
+	}
+	defer claims.Close()
+
+	data, err := db.FetchUnparsedAnnouncements(ctx, database)
+	if err != nil {
+		return 0, fmt.Errorf("fetch unparsed announcements: %w", err)
+	}
+
+	if len(data) == 0 {
+		log.Info("⚠️ No unparsed announcements found. Exiting.")
+		return 0, nil
+	}
+
+	updated := 0
+	err = claims.eachAnnouncement(ctx, data, func(ann *models.Announcement) error {
+		annID := strconv.Itoa(ann.AnnID)
+		log := log.WithField(utils.FieldAnnID, ann.AnnID)
+		log.Infof("Processing ann_id %s", annID)
+
+		err := services.ParseAnnouncementHTML(ann)
+		metrics.ParseResult("announcement", err)
+		if err != nil {
+			log.Warnf("⚠️ Parse failed for ann_id %s: %v", annID, err)
+			run.Failed(fmt.Errorf("ann_id %s: parse: %w", annID, err))
+			return nil
+		}
+
+		if err := db.UpdateAnnouncement(ctx, log, database, ann); err != nil {
+			log.Errorf("❌ Update failed for ann_id %s: %v", annID, err)
+			run.Failed(fmt.Errorf("ann_id %s: update: %w", annID, err))
+			return nil
+		}
+
+		updated++
+		run.Parsed(1)
+		return nil
+	})
+	if err != nil {
+		return updated, err
+	}
+
+	log.Infof("🏁 Done. Updated %d records.", updated)
+	return updated, nil
+}
+
+// ParseBoardroomChanges parses the "Change in Boardroom" announcements this
+// worker claims, including those amended since they were parsed, links each
+// person to an entity and returns how many changes were updated.
+func ParseBoardroomChanges(ctx context.Context, log logrus.FieldLogger, run *Run, cfg *utils.Config, database *sqlx.DB) (int, error) {
+	claims, err := OpenClaims(ctx, log, database, cfg, QueueBoardroom)
+	if err != nil {
+		return 0, err
+	}
+	defer claims.Close()
+
+	data, err := db.FetchAnnouncementsByCategory(ctx, database, "Change in Boardroom")
+	if err != nil {
+		return 0, fmt.Errorf("fetch change in boardroom announcements: %w", err)
+	}
+
+	// Announcements amended since they were parsed
+	flagged, err := db.FetchBoardroomReparseAnnouncements(ctx, database)
+	if err != nil {
+		return 0, fmt.Errorf("fetch boardroom changes flagged for reparse: %w", err)
+	}
+
+	seen := make(map[int]bool, len(data))
+	for _, ann := range data {
+		seen[ann.AnnID] = true
+	}
+	for _, ann := range flagged {
+		if !seen[ann.AnnID] {
+			data = append(data, ann)
+		}
+	}
+
+	if len(data) == 0 {
+		log.Info("⚠️ No change in boardroom announcements found. Exiting.")
+		return 0, nil
+	}
+
+	updated := 0
+	err = claims.eachAnnouncement(ctx, data, func(ann *models.Announcement) error {
+		annID := strconv.Itoa(ann.AnnID)
+		log := log.WithField(utils.FieldAnnID, ann.AnnID)
+
+		change, err := services.ParseBoardroomChangeHTML(ann)
+		metrics.ParseResult("change_in_boardroom", err)
+		if err != nil {
+			log.Warnf("⚠️ Parse failed for ann_id %s: %v", annID, err)
+			run.Failed(fmt.Errorf("ann_id %s: parse: %w", annID, err))
+			return nil
+		}
+
+		log = log.WithField(utils.FieldStockCode, utils.StringValue(change.StockCode))
+
+		title, name := utils.SplitTitle(utils.StringValue(change.PersonName))
+
+		entity := &models.Entity{
+			DisplayName: utils.PtrString(strings.TrimSpace(title + " " + name)),
+			OriName:     change.PersonName,
+			Name:        &name,
+			Salutation:  &title,
+			StockCode:   change.StockCode,
+			BirthYear:   change.PersonBirthYear,
+			Gender:      change.PersonGender,
+			Nationality: change.PersonNationality,
+			CreatedAt:   *change.DateAnnounced,
+		}
+
+		permID, err := services.GetOrCreateEntity(ctx, log, database, entity, &change.Background)
+		if err != nil {
+			log.Errorf("❌ Entity lookup/creation failed for ann_id %s: %v", annID, err)
+			run.Failed(fmt.Errorf("ann_id %s: entity: %w", annID, err))
+			return nil
+		}
+
+		change.RelatedPerm = permID
+		change.PersonTitle = &title
+		change.PersonName = &name
+
+		err = db.UpdateBoardroomChange(ctx, database, change)
+		if err != nil {
+			log.Errorf("❌ Boardroom change update failed for ann_id %s: %v", annID, err)
+			run.Failed(fmt.Errorf("ann_id %s: update: %w", annID, err))
+			return nil
+		}
+
+		updated++
+		run.Parsed(1)
+
+		log.Infof("🏁 Done. Updated %d records.", updated)
+		return nil
+	})
+
+	return updated, err
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"bca_crawler/internal/people"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// ImportPeople ingests the people and corporate profile CSVs in dir and
+// persists them.
+func ImportPeople(ctx context.Context, log logrus.FieldLogger, run *Run, database *sqlx.DB, dir string) error {
+	store := &people.DataStore{}
+
+	log.Infof("🚀 Starting data ingestion from: %s", dir)
+	if err := store.Ingest(dir); err != nil {
+		return fmt.Errorf("ingestion failed: %w", err)
+	}
+
+	log.Infof("💾 Starting database persistence...")
+	if err := store.Persist(ctx, database); err != nil {
+		return fmt.Errorf("persistence failed: %w", err)
+	}
+
+	run.Parsed(store.Len())
+	log.Infof("✨ Process complete.")
+	store.PrintSummary()
+	return nil
+}
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// ReconcileBoardRoles rebuilds entity roles from the boardroom changes of
+// every entity group sharing a primary_perm_id.
+func ReconcileBoardRoles(ctx context.Context, log logrus.FieldLogger, run *Run, database *sqlx.DB) error {
+	data, err := db.FetchEntity(ctx, database)
+	if err != nil {
+		return fmt.Errorf("fetch entities: %w", err)
+	}
+	if len(data) == 0 {
+		log.Info("⚠️ No entities found. Exiting.")
+		return nil
+	}
+
+	// -------------------------------------------------------------------------
+	// 3️⃣ Filter entities with null primary_perm_id, then group by primary_perm_id
+	// -------------------------------------------------------------------------
+	grouped := make(map[int][]models.Entity)
+	for _, entity := range data {
+		if entity.PrimaryPermID == nil {
+			continue
+		}
+		grouped[*entity.PrimaryPermID] = append(grouped[*entity.PrimaryPermID], entity)
+	}
+	log.Infof("Grouped %d entities into %d primary perm ID groups", len(data), len(grouped))
+
+	// -------------------------------------------------------------------------
+	// 4️⃣ Fetch board changes and index by related_perm
+	// -------------------------------------------------------------------------
+	boardChanges, err := db.FetchBoardChanges(ctx, database)
+	if err != nil {
+		return fmt.Errorf("fetch board changes: %w", err)
+	}
+
+	changesByPerm := make(map[int][]models.BoardroomChange)
+	for _, bc := range boardChanges {
+		if bc.RelatedPerm != nil {
+			changesByPerm[*bc.RelatedPerm] = append(changesByPerm[*bc.RelatedPerm], bc)
+		}
+	}
+
+	// -------------------------------------------------------------------------
+	// 5️⃣ For each primary perm id group, build entity roles
+	// -------------------------------------------------------------------------
+	for primaryPermID, entities := range grouped {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Collect all board changes linked to any entity in the group
+		var allChanges []models.BoardroomChange
+		for _, entity := range entities {
+			allChanges = append(allChanges, changesByPerm[entity.SecondaryPermID]...)
+		}
+
+		// Group changes by stock_code to produce one EntityRole per company
+		// Convert map to slice
+		// Sort changes by date to ensure chronological processing
+		sort.Slice(allChanges, func(i, j int) bool {
+			ti := utils.TimeValue(allChanges[i].DateOfChange)
+			tj := utils.TimeValue(allChanges[j].DateOfChange)
+			if !ti.Equal(tj) {
+				return ti.Before(tj)
+			}
+			// Tie-breaker by announcement ID if dates are same
+			return utils.IntValue(allChanges[i].AnnID) < utils.IntValue(allChanges[j].AnnID)
+		})
+
+		var rolePtrs []*models.EntityRole
+		currentRoleTracker := make(map[string]*models.EntityRole)
+
+		for _, bc := range allChanges {
+			input := models.RoleChangeInput{
+				PermID:           primaryPermID,
+				StockCode:        utils.StringValue(bc.StockCode),
+				CompanyName:      utils.StringValue(bc.CompanyName),
+				Designation:      utils.StringValue(bc.Designation),
+				PreviousPosition: utils.StringValue(bc.PreviousPosition),
+				TypeOfChange:     utils.StringValue(bc.TypeOfChange),
+				DateOfChange:     bc.DateOfChange,
+				Category:         "DIRECTOR",
+			}
+			newRoles := services.ProcessSingleRoleChange(input, currentRoleTracker)
+			rolePtrs = append(rolePtrs, newRoles...)
+		}
+
+		var roles []models.EntityRole
+		for _, r := range rolePtrs {
+			roles = append(roles, *r)
+		}
+
+		if len(roles) == 0 {
+			log.Warnf("⚠️ No roles found for primary_perm_id=%d, skipping", primaryPermID)
+			run.Skipped(1)
+			continue
+		}
+
+		// Insert roles into database
+		if err := db.InsertEntityRoles(ctx, database, roles); err != nil {
+			return fmt.Errorf("insert entity roles for primary_perm_id=%d: %w", primaryPermID, err)
+		}
+		run.Parsed(len(roles))
+	}
+
+	return nil
+}
@@ -0,0 +1,275 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// maxErrorSummary caps the error summary stored on a run.
+const maxErrorSummary = 1000
+
+// finishTimeout bounds recording the end of a run, which happens even after
+// the run's context was cancelled.
+const finishTimeout = 10 * time.Second
+
+// Run records one command invocation in the job_runs ledger and counts the
+// items it fetched, parsed, failed on and skipped. The counters are safe for
+// concurrent use. When the ledger cannot be written the run is only logged.
+type Run struct {
+	ctx      context.Context
+	log      logrus.FieldLogger
+	database *sqlx.DB
+
+	mu       sync.Mutex
+	rec      models.JobRun
+	firstErr string
+	fatal    string
+	finished bool
+}
+
+// StartRun records the start of command with its args. A fatal log entry
+// before Finish marks the latest started run as failed with that message, or
+// as cancelled once ctx is.
+func StartRun(ctx context.Context, log logrus.FieldLogger, database *sqlx.DB, command string, args []string) *Run {
+	r := &Run{
+		ctx:      ctx,
+		log:      log,
+		database: database,
+		rec: models.JobRun{
+			RunID:   utils.RunID,
+			Command: command,
+			Args:    joinArgs(args),
+		},
+	}
+
+	if err := db.StartJobRun(ctx, database, &r.rec); err != nil {
+		log.Errorf("[Error] Failed to record job run: %v", err)
+	}
+
+	watchFatal(r)
+	return r
+}
+
+// fatalRun is the run a fatal log entry fails: the latest one started and
+// not yet finished. One hook and exit handler serve every run of the process.
+var (
+	fatalMu   sync.Mutex
+	fatalRun  *Run
+	fatalOnce sync.Once
+)
+
+func watchFatal(r *Run) {
+	fatalOnce.Do(func() {
+		utils.Logger.AddHook(fatalHook{})
+		logrus.RegisterExitHandler(finishFatal)
+	})
+
+	fatalMu.Lock()
+	defer fatalMu.Unlock()
+	fatalRun = r
+}
+
+func currentRun() *Run {
+	fatalMu.Lock()
+	defer fatalMu.Unlock()
+	return fatalRun
+}
+
+// finishFatal finishes the current run as the process exits on a fatal log
+// entry.
+func finishFatal() {
+	r := currentRun()
+	if r == nil {
+		return
+	}
+	err := errors.New(r.fatalMessage())
+	if r.ctx.Err() != nil {
+		err = fmt.Errorf("%w: %s", r.ctx.Err(), err)
+	}
+	r.Finish(err)
+}
+
+// joinArgs joins args for the ledger with secrets redacted, quoting those
+// with spaces. A flag value is redacted on its own, whether it follows the
+// flag after "=" or as the next argument.
+func joinArgs(args []string) string {
+	out := make([]string, len(args))
+	secretNext := false
+	for i, a := range args {
+		switch name, value, ok := splitFlag(a); {
+		case secretNext:
+			a = utils.RedactDSN(a)
+			secretNext = false
+		case ok:
+			a = a[:len(a)-len(value)] + utils.RedactDSN(value)
+		case name != "":
+			secretNext = secretFlag(name)
+		default:
+			a = utils.RedactDSN(a)
+		}
+		if strings.ContainsAny(a, " \t\"") {
+			a = strconv.Quote(a)
+		}
+		out[i] = a
+	}
+	return strings.Join(out, " ")
+}
+
+// splitFlag splits a "-name=value" or "--name=value" argument. For a flag
+// without a value it returns only the name, and nothing for other
+// arguments.
+func splitFlag(arg string) (name, value string, ok bool) {
+	if len(arg) < 2 || arg[0] != '-' || arg == "--" {
+		return "", "", false
+	}
+	name = strings.TrimPrefix(arg[1:], "-")
+	name, value, ok = strings.Cut(name, "=")
+	return name, value, ok
+}
+
+// secretFlag reports whether flag name takes a connection string.
+func secretFlag(name string) bool {
+	return name == "dsn" || utils.IsSecretSetting(name)
+}
+
+// Fetched counts n pages or files fetched.
+func (r *Run) Fetched(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rec.Fetched += n
+}
+
+// Parsed counts n records parsed and stored.
+func (r *Run) Parsed(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rec.Parsed += n
+}
+
+// Skipped counts n items passed over on purpose.
+func (r *Run) Skipped(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rec.Skipped += n
+}
+
+// Failed counts one item that failed. The first error goes into the error
+// summary.
+func (r *Run) Failed(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rec.Failed++
+	if r.firstErr == "" && err != nil {
+		r.firstErr = err.Error()
+	}
+}
+
+// Finish records how the run ended: cancelled when err is a context
+// cancellation, failed for any other err, succeeded otherwise, even with
+// failed items. Only the first call has an effect.
+func (r *Run) Finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return
+	}
+	r.finished = true
+
+	fatalMu.Lock()
+	if fatalRun == r {
+		fatalRun = nil
+	}
+	fatalMu.Unlock()
+
+	var summary []string
+	r.rec.Status = models.JobRunSucceeded
+	switch {
+	case errors.Is(err, context.Canceled):
+		r.rec.Status = models.JobRunCancelled
+		summary = append(summary, err.Error())
+	case err != nil:
+		r.rec.Status = models.JobRunFailed
+		summary = append(summary, err.Error())
+	}
+	if r.rec.Failed > 0 {
+		summary = append(summary, fmt.Sprintf("%d items failed, first: %s", r.rec.Failed, r.firstErr))
+	}
+	if len(summary) > 0 {
+		r.rec.ErrorSummary = utils.PtrString(utils.Truncate(strings.Join(summary, "; "), maxErrorSummary))
+	}
+
+	r.log.Infof("Run %s %s: fetched=%d parsed=%d failed=%d skipped=%d",
+		r.rec.Command, r.rec.Status, r.rec.Fetched, r.rec.Parsed, r.rec.Failed, r.rec.Skipped)
+
+	if r.rec.ID == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.ctx), finishTimeout)
+	defer cancel()
+
+	if err := db.FinishJobRun(ctx, r.database, &r.rec); err != nil {
+		r.log.Errorf("[Error] Failed to record job run: %v", err)
+	}
+}
+
+func (r *Run) fatalMessage() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fatal == "" {
+		return "exited with a fatal error"
+	}
+	return r.fatal
+}
+
+// fatalHook keeps the message of a fatal log entry on the current run for
+// the exit handler.
+type fatalHook struct{}
+
+func (fatalHook) Levels() []logrus.Level { return []logrus.Level{logrus.FatalLevel} }
+
+func (fatalHook) Fire(e *logrus.Entry) error {
+	r := currentRun()
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fatal = e.Message
+	return nil
+}
+
+// CrawlStore wraps store to count the crawl outcomes: saved pages as
+// fetched, not found and withdrawn ids as skipped.
+func (r *Run) CrawlStore(store services.CrawlStore) services.CrawlStore {
+	return countingStore{CrawlStore: store, run: r}
+}
+
+type countingStore struct {
+	services.CrawlStore
+	run *Run
+}
+
+func (s countingStore) RecordCrawlAttempt(ctx context.Context, a *models.CrawlAttempt) error {
+	switch a.Status {
+	case models.CrawlStatusSaved:
+		s.run.Fetched(1)
+	case models.CrawlStatusNotFound, models.CrawlStatusWithdrawn:
+		s.run.Skipped(1)
+	default:
+		s.run.Failed(fmt.Errorf("ann_id %d: %s", a.AnnID, utils.StringValue(a.LastError)))
+	}
+	return s.CrawlStore.RecordCrawlAttempt(ctx, a)
+}
@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestJoinArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{
+			[]string{"-db-path=postgresql://root:K3D_2025@h:5432/bursa", "-restart"},
+			"-db-path=postgresql://root:xxxxx@h:5432/bursa -restart",
+		},
+		{
+			[]string{"--db-path", "postgresql://root:K3D_2025@h:5432/bursa", "-max-pages", "5"},
+			"--db-path postgresql://root:xxxxx@h:5432/bursa -max-pages 5",
+		},
+		{
+			[]string{"-dsn", "host=h user=root password=K3D_2025 dbname=bursa"},
+			`-dsn "host=h user=root password=xxxxx dbname=bursa"`,
+		},
+		{
+			[]string{"-dsn=host=h password=K3D_2025"},
+			`"-dsn=host=h password=xxxxx"`,
+		},
+		{
+			[]string{"-db-path=bca.db", "-stock-code=1155", "-log-level", "debug", "a b"},
+			`-db-path=bca.db -stock-code=1155 -log-level debug "a b"`,
+		},
+	}
+
+	for _, tt := range tests {
+		got := joinArgs(tt.args)
+		if got != tt.want {
+			t.Errorf("joinArgs(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+		if strings.Contains(got, "K3D_2025") {
+			t.Errorf("joinArgs(%q) leaks the password: %s", tt.args, got)
+		}
+	}
+}
+
+func TestFatalHookCurrentRun(t *testing.T) {
+	start := func(command string) *Run {
+		r := &Run{ctx: context.Background(), log: utils.Logger, rec: models.JobRun{Command: command}}
+		watchFatal(r)
+		return r
+	}
+
+	first := start("parser")
+	first.Finish(nil)
+	second := start("parser-board")
+	third := start("parser-att")
+	third.Finish(nil)
+
+	hooks := 0
+	for _, h := range utils.Logger.Hooks[logrus.FatalLevel] {
+		if _, ok := h.(fatalHook); ok {
+			hooks++
+		}
+	}
+	if hooks != 1 {
+		t.Errorf("got %d fatal hooks after three runs, want 1", hooks)
+	}
+
+	// No run is current once the latest finished, so the fatal entry and
+	// exit leave every run as it was
+	if err := utils.Logger.Hooks.Fire(logrus.FatalLevel, &logrus.Entry{Message: "lost the database"}); err != nil {
+		t.Fatal(err)
+	}
+	finishFatal()
+	for _, r := range []*Run{first, second, third} {
+		if r.fatal != "" {
+			t.Errorf("run %s kept fatal message %q", r.rec.Command, r.fatal)
+		}
+	}
+	if second.finished {
+		t.Errorf("run %s was finished by a fatal entry after a later run started", second.rec.Command)
+	}
+
+	fourth := start("parser-sholder")
+	if err := utils.Logger.Hooks.Fire(logrus.FatalLevel, &logrus.Entry{Message: "lost the database"}); err != nil {
+		t.Fatal(err)
+	}
+	finishFatal()
+	if fourth.rec.Status != models.JobRunFailed || fourth.rec.ErrorSummary == nil || *fourth.rec.ErrorSummary != "lost the database" {
+		t.Errorf("run %s = %s %v, want failed with the fatal message", fourth.rec.Command, fourth.rec.Status, fourth.rec.ErrorSummary)
+	}
+	for _, r := range []*Run{first, third} {
+		if r.rec.Status != models.JobRunSucceeded {
+			t.Errorf("finished run %s = %s, want succeeded", r.rec.Command, r.rec.Status)
+		}
+	}
+}
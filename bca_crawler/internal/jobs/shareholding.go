@@ -0,0 +1,241 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/services"
+	"bca_crawler/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// ParseShareholdingChanges parses the shareholding change announcements this
+// worker claims and returns how many were stored.
+func ParseShareholdingChanges(ctx context.Context, log logrus.FieldLogger, run *Run, cfg *utils.Config, database *sqlx.DB) (int, error) {
+	claims, err := OpenClaims(ctx, log, database, cfg, QueueShareholding)
+	if err != nil {
+		return 0, err
+	}
+	defer claims.Close()
+
+	data, err := db.FetchAnnouncementsByShareholder(ctx, database)
+	if err != nil {
+		return 0, fmt.Errorf("fetch shareholder announcements: %w", err)
+	}
+
+	if len(data) == 0 {
+		log.Info("⚠️ No shareholder announcements found. Exiting.")
+		return 0, nil
+	}
+
+	updated := 0
+	err = claims.eachAnnouncement(ctx, data, func(ann *models.Announcement) error {
+		annID := strconv.Itoa(ann.AnnID)
+		log := log.WithField(utils.FieldAnnID, ann.AnnID)
+
+		change, err := services.ParseShareholdingChange(ann)
+		if err != nil {
+			log.Warnf("⚠️ Parse failed for ann_id %s: %v", annID, err)
+			run.Failed(fmt.Errorf("ann_id %s: parse: %w", annID, err))
+			return nil
+		}
+
+		// insert into db
+		if err := db.UpdateShareholdingChange(ctx, database, change); err != nil {
+			log.Warnf("⚠️ DB update failed for ann_id %s: %v", annID, err)
+			run.Failed(fmt.Errorf("ann_id %s: update: %w", annID, err))
+			return nil
+		}
+
+		log.Infof("🏁 Done. Processed %d records.", updated)
+		updated++
+		run.Parsed(1)
+		return nil
+	})
+
+	return updated, err
+}
+
+// LinkShareholders links every individual shareholder to an entity and
+// prints the distinct companies found.
+func LinkShareholders(ctx context.Context, log logrus.FieldLogger, run *Run, database *sqlx.DB) error {
+	data, err := db.FetchShareHoldingChanges(ctx, database)
+	if err != nil {
+		return fmt.Errorf("fetch shareholding changes: %w", err)
+	}
+
+	if len(data) == 0 {
+		log.Info("⚠️ No shareholder announcements found. Exiting.")
+		return nil
+	}
+
+	uniqueCompanies := make(map[string]struct{})
+	for i := range data {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ann := data[i]
+		annID := strconv.Itoa(ann.AnnID)
+		log := log.WithField(utils.FieldAnnID, ann.AnnID)
+
+		entityType := "Individual"
+
+		layouts := []string{
+			"BHD",
+			"BERHAD",
+			"LTD",
+			"LIMITED",
+			"LP",
+			"L.P.",
+			"PRIVATED",
+			"PERKESO",
+			"FUND",
+			"TRUST",
+			"TABUNG",
+			"LEMBAGA",
+			"AMANAH",
+			"PERBADANAN",
+			"PEMERBADANAN",
+			"PERTUBUHAN",
+			"ASSET",
+			"GROUP",
+			"KUMPULAN",
+			"KWSP",
+			"ASIA",
+			"CORP",
+			"COMPANY",
+			"COMPANIES",
+			"EKONOMI",
+			"ECONOMY",
+			"FOUNDATION",
+			"FINANCE",
+			"FINANCIAL",
+			"STATE",
+			"SECRETARY",
+			"HOLDING",
+			"PROSPERITY",
+			"ASSOCIATION",
+			"ASSOCIATE",
+			"AUTHORITY",
+			"FEDERAL",
+			"SYSTEM",
+			"DEVELOPMENT",
+			"PLC",
+			"P L C",
+			"PLT",
+			"LLC",
+			"L L C",
+			"UCITS",
+			"BANK",
+			"YAYASAN",
+			"B.V.",
+			"BV",
+			"PT",
+			"ANSTALT",
+			"SCHAFT",
+			"PRIVATSTIFTUNG",
+			"GMBH",
+			"REALTY",
+			"SETTLEMENT",
+			"SECRETARY",
+			"CREDIT",
+			"EQUITY",
+			"EQUITIES",
+			"CAPITAL",
+			"ESTATE",
+			"BOARD",
+			"EMPLOYEE",
+			"NOMINEES",
+			"ASSURANCE",
+			"R.L.",
+			"INVEST",
+			"INTERNATIONAL",
+			"INTL",
+			"NASIONAL",
+			"ULC",
+			"UBS",
+			"INC",
+			"SZA",
+			"AKTIEBOLAG",
+			"ALLIANZ",
+			"JP MORGAN",
+			"JPMORGAN",
+			"NIPPON",
+			"ARICINQ",
+			"ANIMA",
+			"AXA",
+			"BTS",
+			"CYC",
+			"CARLSBERG",
+			"DEUTSCHE",
+			"FINANCIERE",
+			"LAFARGE",
+			"NESTL",
+			"PACIFIC",
+			"OFFSHORE",
+			"SKAGEN",
+			"SOFIMA",
+			"SOFIMO",
+			"SOCIETE",
+			"STATE",
+			"TECH",
+			"TELENOR",
+		}
+
+		for _, layout := range layouts {
+			if strings.Contains(utils.StringValue(ann.PersonName), layout) {
+				entityType = "Company"
+
+				uniqueCompanies[utils.StringValue(ann.PersonName)] = struct{}{}
+				run.Skipped(1)
+
+				break
+			}
+		}
+
+		if entityType == "Individual" {
+			title, name := utils.SplitTitle(utils.StringValue(ann.PersonName))
+
+			entity := &models.Entity{
+				DisplayName: utils.PtrString(strings.TrimSpace(title + " " + name)),
+				OriName:     ann.PersonName,
+				Name:        &name,
+				Salutation:  &title,
+				Nationality: ann.PersonNationality,
+				CreatedAt:   time.Now(),
+			}
+
+			permID, err := services.GetOrCreateEntity(ctx, log, database, entity, nil)
+			if err != nil {
+				log.Errorf("❌ Entity lookup/creation failed for ann_id %s: %v", annID, err)
+				run.Failed(fmt.Errorf("ann_id %s: entity: %w", annID, err))
+				continue
+			}
+
+			// update into db
+			if err := db.UpdateShareholdingChangePerm(ctx, database, ann.ID, *permID); err != nil {
+				log.Errorf("❌ Failed to update shareholding change %d with permID %v: %v", ann.ID, permID, err)
+				run.Failed(fmt.Errorf("ann_id %s: link: %w", annID, err))
+			} else {
+				run.Parsed(1)
+			}
+
+			log.Infof("Processing ann_id %s | Title: %s | Name: %s", annID, title, name)
+		}
+	}
+
+	fmt.Println("Distinct Companies Found:")
+	for c := range uniqueCompanies {
+		fmt.Println("-", c)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"bca_crawler/internal/utils"
+)
+
+const namespace = "bca"
+
+var (
+	// PageDuration times one page load: RunPage for Chrome, one request for
+	// the plain HTTP fetcher.
+	PageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "page_duration_seconds",
+		Help:      "Duration of one page load by fetcher.",
+		Buckets:   prometheus.ExponentialBuckets(0.25, 2, 10),
+	}, []string{"fetcher"})
+
+	// FetchOutcomes counts classified fetch attempts, e.g. cooldown/challenge
+	// for a Cloudflare page.
+	FetchOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fetch_outcomes_total",
+		Help:      "Fetch attempts by outcome class and reason.",
+	}, []string{"class", "reason"})
+
+	BreakerTrips = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "breaker_trips_total",
+		Help:      "Times the circuit breaker paused the crawl.",
+	})
+
+	// BreakerState holds the number of circuit breakers in each state
+	// (closed, open, half_open, halted); a crawler has one breaker.
+	BreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "breaker_state",
+		Help:      "Circuit breakers by state.",
+	}, []string{"state"})
+
+	// CrawlAttempts counts ann_ids committed to the crawl ledger by status;
+	// status="saved" is the number of announcements stored.
+	CrawlAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "crawl_attempts_total",
+		Help:      "Announcement IDs recorded in the crawl ledger by status.",
+	}, []string{"status"})
+
+	ParseResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parse_total",
+		Help:      "Parsed announcements by announcement type and result.",
+	}, []string{"type", "result"})
+
+	Entities = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "entities_total",
+		Help:      "Entity lookups by result (matched or created).",
+	}, []string{"result"})
+
+	DBWriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_write_duration_seconds",
+		Help:      "Duration of database writes by operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"op"})
+)
+
+// ObservePage records a page load by fetcher started at start.
+func ObservePage(fetcher string, start time.Time) {
+	PageDuration.WithLabelValues(fetcher).Observe(time.Since(start).Seconds())
+}
+
+// ObserveDBWrite records a database write started at start; use it as
+// defer metrics.ObserveDBWrite("op", time.Now()).
+func ObserveDBWrite(op string, start time.Time) {
+	DBWriteDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+// ParseResult counts the outcome of parsing one announcement of type typ.
+func ParseResult(typ string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	ParseResults.WithLabelValues(typ, result).Inc()
+}
+
+// Serve exposes /metrics on addr in the background. An empty addr leaves the
+// endpoint disabled.
+func Serve(addr string) {
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		utils.Logger.Infof("Serving metrics on %s/metrics", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			utils.Logger.Errorf("[Error] Metrics endpoint stopped: %v", err)
+		}
+	}()
+}
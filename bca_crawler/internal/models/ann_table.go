@@ -25,6 +25,7 @@ type BoardroomChange struct {
 	RelatedPerm       *int       `json:"related_perm,omitempty" db:"related_perm"`
 	SecondaryPermID   *int       `json:"secondary_perm_id,omitempty" db:"secondary_perm_id"`
 	CreatedAt         time.Time  `json:"created_at,omitempty" db:"created_at"`
+	NeedsReparse      bool       `json:"needs_reparse,omitempty" db:"needs_reparse"`
 }
 
 type ShareholdingChange struct {
@@ -61,4 +62,5 @@ type ShareholdingChange struct {
 	Remarks                 *string    `json:"remarks,omitempty" db:"remarks"`
 	CreatedAt               time.Time  `json:"created_at,omitempty" db:"created_at"`
 	RelatedPerm             *int       `json:"related_perm,omitempty" db:"related_perm"`
+	NeedsReparse            bool       `json:"needs_reparse,omitempty" db:"needs_reparse"`
 }
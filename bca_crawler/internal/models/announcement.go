@@ -17,6 +17,9 @@ type Announcement struct {
 	RefNumber   string    `json:"ref_number,omitempty"`
 	Content     string    `json:"content,omitempty"`
 	Attachments []string  `json:"attachments,omitempty"`
+	// ContentSHA256 points at the page in the raw archive when Content is
+	// not stored in the database.
+	ContentSHA256 string `json:"content_sha256,omitempty"`
 }
 
 type AnnouncementDB struct {
@@ -31,4 +34,6 @@ type AnnouncementDB struct {
 	RefNumber   sql.NullString `db:"ref_number"`
 	Content     sql.NullString `db:"content"`
 	Attachments sql.NullString `db:"attachments"`
+
+	ContentSHA256 sql.NullString `db:"content_sha256"`
 }
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// AnnualReport is an annual report announcement whose attachment text is
+// ready for cmd/ext-annual, which records it in annual_reports once its
+// records are extracted. DatePosted is nil when the announcement has no
+// posting date.
+type AnnualReport struct {
+	AnnID       int        `json:"ann_id" db:"ann_id"`
+	CompanyName string     `json:"company_name" db:"company_name"`
+	DatePosted  *time.Time `json:"date_posted,omitempty" db:"date_posted"`
+}
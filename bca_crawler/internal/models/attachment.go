@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Attachment download statuses
+const (
+	AttachmentDownloaded = "downloaded"
+	AttachmentFailed     = "failed"
+)
+
+// Attachment text extraction statuses
+const (
+	TextExtracted = "extracted"
+	TextFailed    = "failed"
+)
+
+// Attachment table parse statuses
+const (
+	TablesParsed = "parsed"
+	TablesFailed = "failed"
+)
+
+// Attachment is one file linked from an announcement, as recorded in the
+// announcement_attachments manifest. StoragePath is relative to the download
+// directory; announcements linking identical content share one file.
+type Attachment struct {
+	ID           int        `json:"id" db:"id"`
+	AnnID        int        `json:"ann_id" db:"ann_id"`
+	URL          string     `json:"url" db:"url"`
+	Filename     string     `json:"filename" db:"filename"`
+	MIME         string     `json:"mime" db:"mime"`
+	Size         int64      `json:"size" db:"size"`
+	SHA256       string     `json:"sha256" db:"sha256"`
+	StoragePath  string     `json:"storage_path" db:"storage_path"`
+	Status       string     `json:"status" db:"status"`
+	Attempts     int        `json:"attempts" db:"attempts"`
+	LastError    *string    `json:"last_error,omitempty" db:"last_error"`
+	DownloadedAt *time.Time `json:"downloaded_at,omitempty" db:"downloaded_at"`
+	CreatedAt    time.Time  `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// AttachmentPage is the text of one page of a downloaded attachment, as
+// stored in attachment_text. File is the attachment's storage path.
+type AttachmentPage struct {
+	ID        int       `json:"id" db:"id"`
+	AnnID     int       `json:"ann_id" db:"ann_id"`
+	File      string    `json:"file" db:"file"`
+	PageNo    int       `json:"page_no" db:"page_no"`
+	Text      string    `json:"text" db:"text"`
+	CreatedAt time.Time `json:"created_at,omitempty" db:"created_at"`
+}
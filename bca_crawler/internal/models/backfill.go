@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Stock backfill statuses
+const (
+	BackfillListing  = "listing"
+	BackfillFetching = "fetching"
+	BackfillDone     = "done"
+	BackfillFailed   = "failed"
+)
+
+// StockBackfill tracks the historical backfill of one stock: how far the
+// company announcement search was paged and how many of the ann_ids found
+// have been fetched.
+type StockBackfill struct {
+	StockCode  string     `json:"stock_code" db:"stock_code"`
+	Status     string     `json:"status" db:"status"`
+	LastPage   int        `json:"last_page" db:"last_page"`
+	Listed     int        `json:"listed" db:"listed"`
+	Fetched    int        `json:"fetched" db:"fetched"`
+	LastError  *string    `json:"last_error,omitempty" db:"last_error"`
+	StartedAt  time.Time  `json:"started_at" db:"started_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+}
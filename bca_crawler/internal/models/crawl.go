@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// Crawl ledger statuses
+const (
+	CrawlStatusSaved     = "saved"
+	CrawlStatusFailed    = "failed"
+	CrawlStatusNotFound  = "not_found"
+	CrawlStatusWithdrawn = "withdrawn"
+)
+
+type CrawlAttempt struct {
+	AnnID       int        `json:"ann_id" db:"ann_id"`
+	Status      string     `json:"status" db:"status"`
+	HTTPStatus  *int       `json:"http_status,omitempty" db:"http_status"`
+	Attempts    int        `json:"attempts" db:"attempts"`
+	Misses      int        `json:"misses" db:"misses"`
+	LastError   *string    `json:"last_error,omitempty" db:"last_error"`
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty" db:"next_retry_at"`
+	DeadAt      *time.Time `json:"dead_at,omitempty" db:"dead_at"`
+	CreatedAt   time.Time  `json:"created_at,omitempty" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at,omitempty" db:"updated_at"`
+}
+
+// DeadAnnouncement is a confirmed dead ann_id with the posting date of the
+// nearest stored announcement below it, as an approximation of its own date.
+type DeadAnnouncement struct {
+	AnnID      int        `json:"ann_id" db:"ann_id"`
+	Status     string     `json:"status" db:"status"`
+	Attempts   int        `json:"attempts" db:"attempts"`
+	DeadAt     time.Time  `json:"dead_at" db:"dead_at"`
+	ApproxDate *time.Time `json:"approx_date,omitempty" db:"approx_date"`
+}
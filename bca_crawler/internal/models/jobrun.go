@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Job run statuses
+const (
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+	JobRunCancelled = "cancelled"
+)
+
+// JobRun is one invocation of a command in the job_runs ledger, with how many
+// items it fetched, parsed, failed on and skipped.
+type JobRun struct {
+	ID           int        `json:"id" db:"id"`
+	RunID        string     `json:"run_id" db:"run_id"`
+	Command      string     `json:"command" db:"command"`
+	Args         string     `json:"args" db:"args"`
+	StartedAt    time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+	Status       string     `json:"status" db:"status"`
+	Fetched      int        `json:"fetched" db:"fetched"`
+	Parsed       int        `json:"parsed" db:"parsed"`
+	Failed       int        `json:"failed" db:"failed"`
+	Skipped      int        `json:"skipped" db:"skipped"`
+	ErrorSummary *string    `json:"error_summary,omitempty" db:"error_summary"`
+}
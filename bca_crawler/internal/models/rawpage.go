@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RawPage records one distinct version of an announcement page kept in the
+// raw archive.
+type RawPage struct {
+	ID         int       `db:"id"`
+	AnnID      int       `db:"ann_id"`
+	SHA256     string    `db:"sha256"`
+	Size       int       `db:"size"`
+	HTTPStatus *int      `db:"http_status"`
+	FetchedAt  time.Time `db:"fetched_at"`
+	LastSeenAt time.Time `db:"last_seen_at"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// TableSource points a record back at the spreadsheet row it was read from.
+type TableSource struct {
+	Sheet string `json:"sheet"`
+	Line  int    `json:"line"`
+}
+
+// ShareBuyBack is one day of a share buy-back schedule.
+type ShareBuyBack struct {
+	TableSource
+	DateOfBuyBack      *time.Time `json:"date_of_buy_back,omitempty"`
+	Description        string     `json:"description,omitempty"`
+	SharesPurchased    *int64     `json:"shares_purchased,omitempty"`
+	MinimumPrice       *float64   `json:"minimum_price,omitempty"`
+	MaximumPrice       *float64   `json:"maximum_price,omitempty"`
+	TotalConsideration *float64   `json:"total_consideration,omitempty"`
+	SharesRetained     *int64     `json:"shares_retained,omitempty"`
+	SharesCancelled    *int64     `json:"shares_cancelled,omitempty"`
+}
+
+// Dealing is one dealing of a director or principal officer in a dealing
+// schedule.
+type Dealing struct {
+	TableSource
+	Name          string     `json:"name"`
+	DateOfDealing *time.Time `json:"date_of_dealing,omitempty"`
+	Nature        string     `json:"nature,omitempty"`
+	Shares        *int64     `json:"shares,omitempty"`
+	Price         *float64   `json:"price,omitempty"`
+}
+
+// MarketStat is one security's line in a market statistics file.
+type MarketStat struct {
+	TableSource
+	Date      *time.Time `json:"date,omitempty"`
+	StockCode string     `json:"stock_code,omitempty"`
+	StockName string     `json:"stock_name,omitempty"`
+	Volume    *int64     `json:"volume,omitempty"`
+	Value     *float64   `json:"value,omitempty"`
+}
+
+// TableRecords holds what the mappers read from one tabular attachment.
+type TableRecords struct {
+	BuyBacks    []*ShareBuyBack `json:"buy_backs,omitempty"`
+	Dealings    []*Dealing      `json:"dealings,omitempty"`
+	MarketStats []*MarketStat   `json:"market_stats,omitempty"`
+}
+
+// Len returns how many records r holds.
+func (r *TableRecords) Len() int {
+	return len(r.BuyBacks) + len(r.Dealings) + len(r.MarketStats)
+}
+
+// TableAttachment is a downloaded spreadsheet or CSV attachment with the
+// category of its announcement, which picks the mapper of its tables.
+type TableAttachment struct {
+	Attachment
+	Category string `json:"category" db:"category"`
+}
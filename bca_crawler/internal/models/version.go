@@ -0,0 +1,62 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// AnnouncementVersion is one parsed state of an announcement. A new version
+// is recorded whenever a re-parse yields different fields or content.
+type AnnouncementVersion struct {
+	ID            int        `json:"id" db:"id"`
+	AnnID         int        `json:"ann_id" db:"ann_id"`
+	Version       int        `json:"version" db:"version"`
+	Title         string     `json:"title" db:"title"`
+	CompanyName   string     `json:"company_name" db:"company_name"`
+	StockName     string     `json:"stock_name" db:"stock_name"`
+	DatePosted    *time.Time `json:"date_posted,omitempty" db:"date_posted"`
+	Category      string     `json:"category" db:"category"`
+	RefNumber     string     `json:"ref_number" db:"ref_number"`
+	Attachments   string     `json:"attachments" db:"attachments"`
+	ContentSHA256 string     `json:"content_sha256" db:"content_sha256"`
+	// ChangedFields lists the columns that differ from the previous version,
+	// comma separated. It is empty for the first version.
+	ChangedFields string    `json:"changed_fields" db:"changed_fields"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// Diff returns the names of the fields that differ between prev and v.
+func (v *AnnouncementVersion) Diff(prev *AnnouncementVersion) []string {
+	var changed []string
+	add := func(name string, differs bool) {
+		if differs {
+			changed = append(changed, name)
+		}
+	}
+
+	add("title", v.Title != prev.Title)
+	add("company_name", v.CompanyName != prev.CompanyName)
+	add("stock_name", v.StockName != prev.StockName)
+	add("date_posted", !sameTime(v.DatePosted, prev.DatePosted))
+	add("category", v.Category != prev.Category)
+	add("ref_number", v.RefNumber != prev.RefNumber)
+	add("attachments", v.Attachments != prev.Attachments)
+	add("content", v.ContentSHA256 != prev.ContentSHA256)
+
+	return changed
+}
+
+// Changes splits ChangedFields back into field names.
+func (v *AnnouncementVersion) Changes() []string {
+	if v.ChangedFields == "" {
+		return nil
+	}
+	return strings.Split(v.ChangedFields, ",")
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
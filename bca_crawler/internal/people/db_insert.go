@@ -1,6 +1,7 @@
-package main
+package people
 
 import (
+	"context"
 	"fmt"
 
 	"bca_crawler/internal/utils"
@@ -8,8 +9,24 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
-// Persist saves all data in the DataStore to the database
-func (s *DataStore) Persist(db *sqlx.DB) error {
+// Persist saves all data in the DataStore to the database in one
+// transaction, so a failed or cancelled run leaves nothing half-imported.
+func (s *DataStore) Persist(ctx context.Context, db *sqlx.DB) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.PersistTx(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PersistTx saves all data in the DataStore within tx, for callers that
+// record more in the same transaction.
+func (s *DataStore) PersistTx(ctx context.Context, tx *sqlx.Tx) error {
 	log := utils.Logger
 
 	// Define tasks for batch insertion
@@ -18,6 +35,7 @@ func (s *DataStore) Persist(db *sqlx.DB) error {
 		table string
 		data  interface{}
 	}{
+		{"People", "ext_people_profiles", s.People},
 		{"CoSec", "ext_cosec", s.CompanySecretaries},
 		{"Advisers", "ext_adviser", s.Advisers},
 		{"Subsidiaries", "ext_subsidiaries_associates", s.Subsidiaries},
@@ -29,7 +47,7 @@ func (s *DataStore) Persist(db *sqlx.DB) error {
 	}
 
 	for _, t := range tasks {
-		if err := s.batchInsert(db, t.table, t.data); err != nil {
+		if err := s.batchInsert(ctx, tx, t.table, t.data); err != nil {
 			log.Errorf("❌ Failed to insert into %s: %v", t.table, err)
 			return err
 		}
@@ -39,7 +57,7 @@ func (s *DataStore) Persist(db *sqlx.DB) error {
 	return nil
 }
 
-func (s *DataStore) batchInsert(db *sqlx.DB, table string, data interface{}) error {
+func (s *DataStore) batchInsert(ctx context.Context, tx *sqlx.Tx, table string, data interface{}) error {
 	// Check if data is empty
 	switch v := data.(type) {
 	case []IPODetail:
@@ -100,7 +118,7 @@ func (s *DataStore) batchInsert(db *sqlx.DB, table string, data interface{}) err
 	}
 
 	query := fmt.Sprintf("INSERT INTO %s %s", table, cols)
-	_, err := db.NamedExec(query, data)
+	_, err := tx.NamedExecContext(ctx, query, data)
 	return err
 }
 
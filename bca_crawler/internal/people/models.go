@@ -1,4 +1,4 @@
-package main
+package people
 
 // IPODetail represents data from ext_0_ipo_details.csv
 type IPODetail struct {
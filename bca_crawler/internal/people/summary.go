@@ -0,0 +1,27 @@
+package people
+
+import "fmt"
+
+// Len returns the total number of records in the store.
+func (s *DataStore) Len() int {
+	return len(s.IPOs) + len(s.People) + len(s.CorporateDirectory) + len(s.CorporateInfo) +
+		len(s.CompanySecretaries) + len(s.Advisers) + len(s.Subsidiaries) + len(s.SubShareholders) +
+		len(s.PropertiesOwned) + len(s.PropertiesRented) + len(s.Relationships) + len(s.MajorPartners)
+}
+
+func (s *DataStore) PrintSummary() {
+	fmt.Printf("\n--- In-Memory Data Store Summary ---\n")
+	fmt.Printf("IPOs:                  %d\n", len(s.IPOs))
+	fmt.Printf("People Profiles:       %d\n", len(s.People))
+	fmt.Printf("Corporate Directory:   %d\n", len(s.CorporateDirectory))
+	fmt.Printf("Corporate Info:        %d\n", len(s.CorporateInfo))
+	fmt.Printf("Company Secretaries:   %d\n", len(s.CompanySecretaries))
+	fmt.Printf("Advisers:              %d\n", len(s.Advisers))
+	fmt.Printf("Subsidiaries:          %d\n", len(s.Subsidiaries))
+	fmt.Printf("Sub Shareholders:      %d\n", len(s.SubShareholders))
+	fmt.Printf("Properties Owned:      %d\n", len(s.PropertiesOwned))
+	fmt.Printf("Properties Rented:     %d\n", len(s.PropertiesRented))
+	fmt.Printf("Relationships:         %d\n", len(s.Relationships))
+	fmt.Printf("Major Partners:        %d\n", len(s.MajorPartners))
+	fmt.Printf("------------------------------------\n")
+}
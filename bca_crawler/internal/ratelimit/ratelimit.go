@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket that refills at rate tokens per second up to burst.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// New returns a full bucket. A rate <= 0 disables limiting.
+func New(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available and takes it, or until ctx is
+// cancelled.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	for {
+		d := l.reserve()
+		if d == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve takes a token if one is available, otherwise returns how long to
+// wait before trying again.
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// HostLimiter keeps one Limiter per host so every worker hitting the same
+// host shares its budget.
+type HostLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	byHost map[string]*Limiter
+}
+
+func NewHostLimiter(rate float64, burst int) *HostLimiter {
+	return &HostLimiter{
+		rate:   rate,
+		burst:  burst,
+		byHost: make(map[string]*Limiter),
+	}
+}
+
+// Wait blocks until the host of rawURL has a token available, or until ctx
+// is cancelled.
+func (h *HostLimiter) Wait(ctx context.Context, rawURL string) error {
+	return h.limiter(host(rawURL)).Wait(ctx)
+}
+
+func (h *HostLimiter) limiter(host string) *Limiter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	l, ok := h.byHost[host]
+	if !ok {
+		l = New(h.rate, h.burst)
+		h.byHost[host] = l
+	}
+	return l
+}
+
+func host(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host
+}
@@ -0,0 +1,237 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCircuitOpen is returned once the breaker has tripped too many times in a
+// row and the crawl should stop.
+var ErrCircuitOpen = errors.New("circuit breaker open: too many consecutive blocks")
+
+// Breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+	BreakerHalted   = "halted"
+)
+
+// Breaker pauses every fetch that shares it once Threshold cooldown-class
+// outcomes (challenges, blocks, maintenance) are seen within Window. When the
+// pause ends the breaker is half-open: the next OK fetch closes it, while a
+// single further detection trips it again. Each consecutive trip doubles the
+// pause, from Cooldown up to MaxCooldown; after MaxTrips consecutive trips it
+// halts and Allow returns ErrCircuitOpen.
+type Breaker struct {
+	Threshold   int
+	Window      time.Duration
+	Cooldown    time.Duration
+	MaxCooldown time.Duration
+	MaxTrips    int
+	// Log receives trip and close messages; nil means utils.Logger.
+	Log logrus.FieldLogger
+
+	mu          sync.Mutex
+	hits        []time.Time
+	openUntil   time.Time
+	consecutive int
+	halted      bool
+	trips       int64
+	detections  int64
+	generation  int
+	state       string
+
+	// now is the clock, replaced in tests
+	now func() time.Time
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   []*Breaker
+)
+
+// NewBreaker builds a Breaker from the breaker settings in cfg and registers
+// it for Breakers. It returns nil when the breaker is disabled.
+func NewBreaker(cfg *utils.Config) *Breaker {
+	if cfg.BreakerThreshold <= 0 {
+		return nil
+	}
+	b := &Breaker{
+		Threshold:   cfg.BreakerThreshold,
+		Window:      cfg.BreakerWindow,
+		Cooldown:    cfg.BreakerCooldown,
+		MaxCooldown: cfg.BreakerMaxCooldown,
+		MaxTrips:    cfg.BreakerMaxTrips,
+		state:       BreakerClosed,
+		now:         time.Now,
+	}
+	metrics.BreakerState.WithLabelValues(BreakerClosed).Inc()
+
+	breakersMu.Lock()
+	breakers = append(breakers, b)
+	breakersMu.Unlock()
+
+	return b
+}
+
+// Breakers returns every breaker created so far, for reporting.
+func Breakers() []*Breaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	return append([]*Breaker(nil), breakers...)
+}
+
+// Allow blocks while the breaker is open, or until ctx is cancelled.
+func (b *Breaker) Allow(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		if b.halted {
+			b.mu.Unlock()
+			return ErrCircuitOpen
+		}
+		wait := b.openUntil.Sub(b.now())
+		b.updateState()
+		b.mu.Unlock()
+
+		if wait <= 0 {
+			return nil
+		}
+		if err := utils.Sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// Record feeds one fetch outcome to the breaker and reports whether it
+// tripped the breaker.
+func (b *Breaker) Record(o Outcome) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	defer b.updateState()
+
+	now := b.now()
+
+	if o.Class != Cooldown {
+		if o.Class == OK && b.consecutive > 0 && !now.Before(b.openUntil) {
+			b.log().Infof("Circuit breaker closed after %d trip(s)", b.consecutive)
+			b.consecutive = 0
+		}
+		return false
+	}
+
+	b.detections++
+	b.hits = append(b.hits, now)
+
+	// Forget detections that fell out of the window
+	keep := b.hits[:0]
+	for _, t := range b.hits {
+		if now.Sub(t) <= b.Window {
+			keep = append(keep, t)
+		}
+	}
+	b.hits = keep
+
+	if now.Before(b.openUntil) {
+		return false
+	}
+	// Half-open: the first detection after a pause trips again
+	if len(b.hits) < b.Threshold && b.consecutive == 0 {
+		return false
+	}
+
+	detections := len(b.hits)
+	b.hits = b.hits[:0]
+	b.trips++
+	metrics.BreakerTrips.Inc()
+	b.consecutive++
+	b.generation++
+
+	if b.MaxTrips > 0 && b.consecutive > b.MaxTrips {
+		b.halted = true
+		b.log().Errorf("[Error] Circuit breaker halted after %d consecutive trips (last: %s)", b.MaxTrips, o.Reason)
+		return false
+	}
+
+	cooldown := b.Cooldown
+	for i := 1; i < b.consecutive && cooldown < b.MaxCooldown; i++ {
+		cooldown *= 2
+	}
+	if b.MaxCooldown > 0 && cooldown > b.MaxCooldown {
+		cooldown = b.MaxCooldown
+	}
+	b.openUntil = now.Add(cooldown)
+
+	b.log().Warnf("Circuit breaker open for %s after %d %s detections (trip %d)",
+		cooldown, detections, o.Reason, b.consecutive)
+	return true
+}
+
+func (b *Breaker) log() logrus.FieldLogger {
+	if b.Log == nil {
+		return utils.Logger
+	}
+	return b.Log
+}
+
+// Generation increases on every trip, so fetchers can tell when to recreate
+// their browser or client.
+func (b *Breaker) Generation() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.generation
+}
+
+// BreakerStats is a point-in-time view of a Breaker for logs and metrics.
+type BreakerStats struct {
+	State      string
+	Trips      int64
+	Detections int64
+	OpenUntil  time.Time
+}
+
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return BreakerStats{
+		State:      b.updateState(),
+		Trips:      b.trips,
+		Detections: b.detections,
+		OpenUntil:  b.openUntil,
+	}
+}
+
+// updateState works out the current state and moves the breaker between the
+// metrics.BreakerState series when it changed. b.mu must be held.
+func (b *Breaker) updateState() string {
+	state := BreakerClosed
+	switch {
+	case b.halted:
+		state = BreakerHalted
+	case b.now().Before(b.openUntil):
+		state = BreakerOpen
+	case b.consecutive > 0:
+		state = BreakerHalfOpen
+	}
+
+	if state != b.state {
+		metrics.BreakerState.WithLabelValues(b.state).Dec()
+		metrics.BreakerState.WithLabelValues(state).Inc()
+		b.state = state
+	}
+	return state
+}
+
+func (b *Breaker) String() string {
+	s := b.Stats()
+	return fmt.Sprintf("state=%s trips=%d detections=%d", s.State, s.Trips, s.Detections)
+}
@@ -0,0 +1,203 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/utils"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeClock is a manually advanced clock for Breaker.now.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(t *testing.T, maxTrips int) (*Breaker, *fakeClock) {
+	t.Helper()
+	b := NewBreaker(&utils.Config{
+		BreakerThreshold:   3,
+		BreakerWindow:      time.Minute,
+		BreakerCooldown:    10 * time.Second,
+		BreakerMaxCooldown: 30 * time.Second,
+		BreakerMaxTrips:    maxTrips,
+	})
+	clock := &fakeClock{t: time.Date(2025, 10, 16, 9, 0, 0, 0, time.UTC)}
+	b.now = clock.Now
+	return b, clock
+}
+
+var (
+	challenge = Outcome{Cooldown, ReasonCloudflare}
+	ok        = Outcome{OK, ReasonOK}
+)
+
+func wantState(t *testing.T, b *Breaker, want string) {
+	t.Helper()
+	if got := b.Stats().State; got != want {
+		t.Fatalf("state = %s, want %s", got, want)
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	if b := NewBreaker(&utils.Config{}); b != nil {
+		t.Errorf("NewBreaker with no threshold = %v, want nil", b)
+	}
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	b, clock := newTestBreaker(t, 0)
+	wantState(t, b, BreakerClosed)
+
+	// Detections spread wider than the window never trip
+	for i := 0; i < 4; i++ {
+		if b.Record(challenge) {
+			t.Fatalf("tripped on spread-out detection %d", i+1)
+		}
+		clock.Advance(40 * time.Second)
+	}
+	wantState(t, b, BreakerClosed)
+	clock.Advance(time.Minute)
+
+	// Threshold detections within the window open it for Cooldown
+	b.Record(challenge)
+	b.Record(Outcome{Retryable, ReasonSocket})
+	b.Record(challenge)
+	if !b.Record(challenge) {
+		t.Fatal("did not trip at the threshold")
+	}
+	wantState(t, b, BreakerOpen)
+	if s := b.Stats(); s.Trips != 1 || !s.OpenUntil.Equal(clock.Now().Add(10*time.Second)) {
+		t.Errorf("after trip: trips=%d open until %s", s.Trips, s.OpenUntil)
+	}
+
+	// Detections and OK pages from fetches still in flight change nothing
+	if b.Record(challenge) {
+		t.Error("tripped again while open")
+	}
+	b.Record(ok)
+	wantState(t, b, BreakerOpen)
+
+	clock.Advance(10 * time.Second)
+	wantState(t, b, BreakerHalfOpen)
+
+	// One detection while half-open trips again with a doubled pause
+	if !b.Record(challenge) {
+		t.Fatal("half-open breaker did not trip on a detection")
+	}
+	wantState(t, b, BreakerOpen)
+	if s := b.Stats(); !s.OpenUntil.Equal(clock.Now().Add(20 * time.Second)) {
+		t.Errorf("second pause ends %s, want %s", s.OpenUntil, clock.Now().Add(20*time.Second))
+	}
+
+	// The pause is capped at MaxCooldown
+	clock.Advance(20 * time.Second)
+	b.Record(challenge)
+	if s := b.Stats(); !s.OpenUntil.Equal(clock.Now().Add(30 * time.Second)) {
+		t.Errorf("third pause ends %s, want %s", s.OpenUntil, clock.Now().Add(30*time.Second))
+	}
+
+	// An OK page once half-open closes it and resets the pause
+	clock.Advance(30 * time.Second)
+	wantState(t, b, BreakerHalfOpen)
+	b.Record(ok)
+	wantState(t, b, BreakerClosed)
+
+	for i := 0; i < 3; i++ {
+		b.Record(challenge)
+	}
+	if s := b.Stats(); s.State != BreakerOpen || !s.OpenUntil.Equal(clock.Now().Add(10*time.Second)) {
+		t.Errorf("after close and trip: %s until %s, want open for 10s", s.State, s.OpenUntil)
+	}
+	if s := b.Stats(); s.Trips != 4 || s.Detections != 13 {
+		t.Errorf("trips=%d detections=%d, want 4 and 13", s.Trips, s.Detections)
+	}
+}
+
+func TestBreakerHalts(t *testing.T) {
+	b, clock := newTestBreaker(t, 2)
+
+	for i := 0; i < 3; i++ {
+		b.Record(challenge)
+	}
+	clock.Advance(10 * time.Second)
+	b.Record(challenge)
+	wantState(t, b, BreakerOpen)
+
+	clock.Advance(20 * time.Second)
+	b.Record(challenge)
+	wantState(t, b, BreakerHalted)
+
+	if err := b.Allow(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Allow when halted = %v, want ErrCircuitOpen", err)
+	}
+
+	// Halted is final
+	clock.Advance(time.Hour)
+	b.Record(ok)
+	wantState(t, b, BreakerHalted)
+}
+
+func TestBreakerAllow(t *testing.T) {
+	b, clock := newTestBreaker(t, 0)
+
+	if err := b.Allow(context.Background()); err != nil {
+		t.Fatalf("Allow when closed = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		b.Record(challenge)
+	}
+
+	// While open Allow waits, so it returns only when ctx ends
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Allow(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Allow when open = %v, want the context's error", err)
+	}
+
+	clock.Advance(10 * time.Second)
+	if err := b.Allow(context.Background()); err != nil {
+		t.Errorf("Allow when half-open = %v", err)
+	}
+}
+
+func TestBreakerStateMetric(t *testing.T) {
+	gauge := func(state string) float64 {
+		return testutil.ToFloat64(metrics.BreakerState.WithLabelValues(state))
+	}
+	before := map[string]float64{}
+	for _, s := range []string{BreakerClosed, BreakerOpen, BreakerHalfOpen, BreakerHalted} {
+		before[s] = gauge(s)
+	}
+	wantDelta := func(closed, open, halfOpen, halted float64) {
+		t.Helper()
+		for s, want := range map[string]float64{BreakerClosed: closed, BreakerOpen: open, BreakerHalfOpen: halfOpen, BreakerHalted: halted} {
+			if got := gauge(s) - before[s]; got != want {
+				t.Errorf("breaker_state{state=%q} moved by %v, want %v", s, got, want)
+			}
+		}
+	}
+
+	b, clock := newTestBreaker(t, 1)
+	wantDelta(1, 0, 0, 0)
+
+	for i := 0; i < 3; i++ {
+		b.Record(challenge)
+	}
+	wantDelta(0, 1, 0, 0)
+
+	// Open turns half-open with time alone; the gauge follows on the next look
+	clock.Advance(10 * time.Second)
+	b.Allow(context.Background())
+	wantDelta(0, 0, 1, 0)
+
+	// A second trip is one more than MaxTrips
+	b.Record(challenge)
+	wantDelta(0, 0, 0, 1)
+}
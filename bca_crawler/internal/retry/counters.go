@@ -0,0 +1,56 @@
+package retry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metrics collects outcomes from every Policy that has no Counters of its own.
+var Metrics = NewCounters()
+
+// Counters tallies outcomes by class and reason.
+type Counters struct {
+	mu     sync.Mutex
+	counts map[Outcome]int64
+}
+
+func NewCounters() *Counters {
+	return &Counters{counts: make(map[Outcome]int64)}
+}
+
+func (c *Counters) Add(o Outcome) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[o]++
+}
+
+// Snapshot returns the counts keyed by "class/reason".
+func (c *Counters) Snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make(map[string]int64, len(c.counts))
+	for o, n := range c.counts {
+		out[o.Class.String()+"/"+o.Reason] = n
+	}
+	return out
+}
+
+// String formats the counts in a stable order for log lines.
+func (c *Counters) String() string {
+	snap := c.Snapshot()
+
+	keys := make([]string, 0, len(snap))
+	for k := range snap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, snap[k]))
+	}
+	return strings.Join(parts, " ")
+}
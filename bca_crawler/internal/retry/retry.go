@@ -0,0 +1,217 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Class tells a crawler what to do with a fetch outcome.
+type Class int
+
+const (
+	// OK means the page is usable.
+	OK Class = iota
+	// Retryable failures are transient and retried with backoff.
+	Retryable
+	// Cooldown failures mean the site is pushing back (challenge, block,
+	// maintenance) and the next attempt should wait much longer.
+	Cooldown
+	// Terminal outcomes will not change by retrying in this run.
+	Terminal
+)
+
+func (c Class) String() string {
+	switch c {
+	case OK:
+		return "ok"
+	case Retryable:
+		return "retryable"
+	case Cooldown:
+		return "cooldown"
+	case Terminal:
+		return "terminal"
+	}
+	return "unknown"
+}
+
+// Reasons reported by Classify
+const (
+	ReasonOK          = "ok"
+	ReasonCloudflare  = "cloudflare"
+	ReasonBlocked     = "blocked"
+	ReasonMaintenance = "maintenance"
+	ReasonSocket      = "socket"
+	ReasonTimeout     = "timeout"
+	ReasonServerError = "server_error"
+	ReasonRateLimited = "rate_limited"
+	ReasonNotFound    = "not_found"
+	ReasonWithdrawn   = "withdrawn"
+	ReasonCircuitOpen = "circuit_open"
+	ReasonCanceled    = "canceled"
+	ReasonError       = "error"
+)
+
+// Outcome is the classification of one fetch.
+type Outcome struct {
+	Class  Class
+	Reason string
+}
+
+type rule struct {
+	fragment string
+	class    Class
+	reason   string
+}
+
+// rules are matched case-insensitively against the error text, or the page
+// body when there is no error. The first match wins.
+var rules = []rule{
+	{"verify you are human", Cooldown, ReasonCloudflare},
+	{"cloudflare verification detected", Cooldown, ReasonCloudflare},
+	{"just a moment", Cooldown, ReasonCloudflare},
+	{"you have been blocked", Cooldown, ReasonBlocked},
+	{"system maintenance notice", Cooldown, ReasonMaintenance},
+	{"net::err_socket_not_connected", Retryable, ReasonSocket},
+	{"net::err_connection", Retryable, ReasonSocket},
+	{"connection reset", Retryable, ReasonSocket},
+	{"ssl handshake failed", Retryable, ReasonSocket},
+	{"connection timed out", Retryable, ReasonTimeout},
+	{"a timeout occurred", Retryable, ReasonTimeout},
+	{"deadline exceeded", Retryable, ReasonTimeout},
+	{"web server is returning an unknown error", Retryable, ReasonServerError},
+	{"internal server error", Retryable, ReasonServerError},
+	{"html file is not found", Terminal, ReasonNotFound},
+	{"announcement has been withdrawn", Terminal, ReasonWithdrawn},
+}
+
+// Classify turns a fetch result into an Outcome. Errors carrying an HTTP
+// status (via a StatusCode method) are classified by code first.
+func Classify(err error, body string) Outcome {
+	text := body
+	if err != nil {
+		if errors.Is(err, ErrCircuitOpen) {
+			return Outcome{Terminal, ReasonCircuitOpen}
+		}
+
+		var coded interface{ StatusCode() int }
+		if errors.As(err, &coded) {
+			switch code := coded.StatusCode(); {
+			case code == 404:
+				return Outcome{Terminal, ReasonNotFound}
+			case code == 403:
+				return Outcome{Cooldown, ReasonBlocked}
+			case code == 429:
+				return Outcome{Cooldown, ReasonRateLimited}
+			case code >= 500:
+				return Outcome{Retryable, ReasonServerError}
+			}
+		}
+		text = err.Error()
+	}
+
+	lower := strings.ToLower(text)
+	for _, r := range rules {
+		if strings.Contains(lower, r.fragment) {
+			return Outcome{r.class, r.reason}
+		}
+	}
+
+	if err != nil {
+		return Outcome{Terminal, ReasonError}
+	}
+	return Outcome{OK, ReasonOK}
+}
+
+// Policy retries a fetch with exponential backoff and jitter.
+type Policy struct {
+	MaxAttempts   int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	CooldownDelay time.Duration
+	// Counters receives every outcome; nil means the package-level Metrics.
+	Counters *Counters
+	// Log receives the retry messages; nil means utils.Logger.
+	Log logrus.FieldLogger
+}
+
+// NewPolicy builds a Policy from the retry settings in cfg.
+func NewPolicy(cfg *utils.Config) Policy {
+	return Policy{
+		MaxAttempts:   cfg.RetryMaxAttempts,
+		BaseDelay:     cfg.RetryBaseDelay,
+		MaxDelay:      cfg.RetryMaxDelay,
+		CooldownDelay: cfg.RetryCooldown,
+	}
+}
+
+// Backoff returns the delay before the given retry (1-based): BaseDelay
+// doubled per attempt, capped at MaxDelay, with +/-50% jitter.
+func (p Policy) Backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
+
+// Do calls fetch until it succeeds, hits a terminal outcome or runs out of
+// attempts, and returns the last result with its classification. Once ctx is
+// cancelled it stops with the context's error, without counting the outcome.
+func (p Policy) Do(ctx context.Context, label string, fetch func() (string, error)) (string, Outcome, error) {
+	counters := p.Counters
+	if counters == nil {
+		counters = Metrics
+	}
+	log := p.Log
+	if log == nil {
+		log = utils.Logger
+	}
+
+	maxAttempts := max(p.MaxAttempts, 1)
+
+	var body string
+	var err error
+	var outcome Outcome
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		body, err = fetch()
+		if ctx.Err() != nil {
+			return "", Outcome{Terminal, ReasonCanceled}, ctx.Err()
+		}
+
+		outcome = Classify(err, body)
+		counters.Add(outcome)
+		metrics.FetchOutcomes.WithLabelValues(outcome.Class.String(), outcome.Reason).Inc()
+
+		if outcome.Class == OK || outcome.Class == Terminal || attempt == maxAttempts {
+			break
+		}
+
+		delay := p.Backoff(attempt)
+		if outcome.Class == Cooldown && p.CooldownDelay > delay {
+			delay = p.CooldownDelay
+		}
+
+		log.Warnf("Retrying %s after %s (%s, attempt %d/%d)...",
+			label, delay.Round(time.Millisecond), outcome.Reason, attempt, maxAttempts)
+		if err := utils.Sleep(ctx, delay); err != nil {
+			return "", Outcome{Terminal, ReasonCanceled}, err
+		}
+	}
+
+	return body, outcome, err
+}
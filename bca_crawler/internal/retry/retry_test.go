@@ -0,0 +1,137 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type statusErr int
+
+func (e statusErr) Error() string   { return fmt.Sprintf("unexpected status %d", int(e)) }
+func (e statusErr) StatusCode() int { return int(e) }
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		body string
+		want Outcome
+	}{
+		{"page", nil, "<html><h3>Change in Boardroom</h3></html>", Outcome{OK, ReasonOK}},
+		{"challenge page", nil, "<title>Just a moment...</title>", Outcome{Cooldown, ReasonCloudflare}},
+		{"challenge error", errors.New("[Error] cloudflare verification detected"), "", Outcome{Cooldown, ReasonCloudflare}},
+		{"blocked", nil, "Sorry, you have been blocked", Outcome{Cooldown, ReasonBlocked}},
+		{"maintenance", nil, "SYSTEM MAINTENANCE NOTICE", Outcome{Cooldown, ReasonMaintenance}},
+		{"socket", errors.New("page load error net::ERR_CONNECTION_RESET"), "", Outcome{Retryable, ReasonSocket}},
+		{"timeout", context.DeadlineExceeded, "", Outcome{Retryable, ReasonTimeout}},
+		{"server error page", nil, "The web server is returning an unknown error", Outcome{Retryable, ReasonServerError}},
+		{"not found page", nil, "<p>HTML file is not found</p>", Outcome{Terminal, ReasonNotFound}},
+		{"withdrawn", nil, "This announcement has been withdrawn", Outcome{Terminal, ReasonWithdrawn}},
+		{"circuit open", fmt.Errorf("fetch: %w", ErrCircuitOpen), "", Outcome{Terminal, ReasonCircuitOpen}},
+		{"404", statusErr(404), "", Outcome{Terminal, ReasonNotFound}},
+		{"403", statusErr(403), "", Outcome{Cooldown, ReasonBlocked}},
+		{"429", fmt.Errorf("get: %w", statusErr(429)), "", Outcome{Cooldown, ReasonRateLimited}},
+		{"503", statusErr(503), "", Outcome{Retryable, ReasonServerError}},
+		{"other status", statusErr(418), "", Outcome{Terminal, ReasonError}},
+		{"unknown error", errors.New("boom"), "", Outcome{Terminal, ReasonError}},
+		// The error wins over the body it came with
+		{"error over body", errors.New("connection reset by peer"), "HTML file is not found", Outcome{Retryable, ReasonSocket}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err, tt.body); got != tt.want {
+				t.Errorf("Classify(%v, %q) = %v, want %v", tt.err, tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{20, time.Second},
+	}
+
+	for _, tt := range tests {
+		lo, hi := tt.base/2, tt.base/2+tt.base
+		for i := 0; i < 200; i++ {
+			if d := p.Backoff(tt.attempt); d < lo || d >= hi {
+				t.Fatalf("Backoff(%d) = %s, want in [%s, %s)", tt.attempt, d, lo, hi)
+			}
+		}
+	}
+
+	if d := (Policy{}).Backoff(3); d != 0 {
+		t.Errorf("Backoff without a base delay = %s, want 0", d)
+	}
+}
+
+func TestPolicyDo(t *testing.T) {
+	p := Policy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Counters: NewCounters()}
+
+	tests := []struct {
+		name     string
+		results  []error
+		calls    int
+		want     Outcome
+		wantBody string
+	}{
+		{"ok", []error{nil}, 1, Outcome{OK, ReasonOK}, "page"},
+		{"retried then ok", []error{errors.New("connection reset"), errors.New("connection timed out"), nil}, 3, Outcome{OK, ReasonOK}, "page"},
+		{"terminal", []error{statusErr(404)}, 1, Outcome{Terminal, ReasonNotFound}, ""},
+		{"gives up", []error{statusErr(500), statusErr(500), statusErr(500), statusErr(500), nil}, 4, Outcome{Retryable, ReasonServerError}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			body, outcome, _ := p.Do(context.Background(), tt.name, func() (string, error) {
+				err := tt.results[calls]
+				calls++
+				if err != nil {
+					return "", err
+				}
+				return "page", nil
+			})
+
+			if calls != tt.calls {
+				t.Errorf("fetch called %d times, want %d", calls, tt.calls)
+			}
+			if outcome != tt.want || body != tt.wantBody {
+				t.Errorf("Do = %q, %v, want %q, %v", body, outcome, tt.wantBody, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyDoCancelled(t *testing.T) {
+	p := Policy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour, Counters: NewCounters()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	_, outcome, err := p.Do(ctx, "cancelled", func() (string, error) {
+		calls++
+		cancel()
+		return "", errors.New("connection reset")
+	})
+
+	if calls != 1 || !errors.Is(err, context.Canceled) || outcome.Reason != ReasonCanceled {
+		t.Errorf("Do after cancel = %d calls, %v, %v; want 1 call, canceled", calls, outcome, err)
+	}
+	if snap := p.Counters.Snapshot(); len(snap) != 0 {
+		t.Errorf("cancelled attempt was counted: %v", snap)
+	}
+}
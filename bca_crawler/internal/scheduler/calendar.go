@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Bursa trades on Malaysia time, which has no daylight saving.
+var Location = time.FixedZone("MYT", 8*60*60)
+
+// Calendar knows which days Bursa is open: weekdays that are not listed
+// public holidays.
+type Calendar struct {
+	holidays map[string]string
+}
+
+// LoadCalendar reads holidays from path, one "YYYY-MM-DD [name]" per line;
+// blank lines and lines starting with # are ignored. An empty path gives a
+// calendar of plain weekdays.
+func LoadCalendar(path string) (*Calendar, error) {
+	c := &Calendar{holidays: make(map[string]string)}
+	if path == "" {
+		return c, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open holiday calendar: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		date, name, _ := strings.Cut(text, " ")
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid date %q", path, line, date)
+		}
+		c.holidays[date] = strings.TrimSpace(name)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read holiday calendar: %w", err)
+	}
+
+	return c, nil
+}
+
+// IsTradingDay reports whether Bursa is open on the day of t (Malaysia time).
+func (c *Calendar) IsTradingDay(t time.Time) bool {
+	t = t.In(Location)
+	if wd := t.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+	_, holiday := c.holidays[t.Format("2006-01-02")]
+	return !holiday
+}
@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeHolidays(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "holidays.txt")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCalendarTradingDays(t *testing.T) {
+	c, err := LoadCalendar(writeHolidays(t, `# Bursa Malaysia 2025
+2025-03-31 Hari Raya Aidilfitri
+2025-04-01 Hari Raya Aidilfitri (second day)
+
+2025-10-20 Deepavali
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		when time.Time
+		want bool
+	}{
+		{myt("2025-10-17 09:00"), true},  // Friday
+		{myt("2025-10-18 09:00"), false}, // Saturday
+		{myt("2025-10-19 09:00"), false}, // Sunday
+		{myt("2025-10-20 09:00"), false}, // Deepavali
+		{myt("2025-10-21 00:00"), true},
+		{myt("2025-03-31 09:00"), false},
+		{myt("2025-04-01 09:00"), false},
+		{myt("2025-04-02 09:00"), true},
+		// The day is taken in Malaysia time: 17:00 UTC on the Tuesday after
+		// Deepavali is already Wednesday, 16:00 UTC on Sunday is Monday's
+		// Deepavali and 16:30 UTC on Friday is already Saturday.
+		{time.Date(2025, 10, 21, 17, 0, 0, 0, time.UTC), true},
+		{time.Date(2025, 10, 19, 16, 0, 0, 0, time.UTC), false},
+		{time.Date(2025, 10, 17, 16, 30, 0, 0, time.UTC), false},
+		{time.Date(2025, 10, 17, 15, 59, 0, 0, time.UTC), true},
+	}
+
+	for _, tt := range tests {
+		if got := c.IsTradingDay(tt.when); got != tt.want {
+			t.Errorf("IsTradingDay(%s) = %t, want %t", tt.when, got, tt.want)
+		}
+	}
+}
+
+func TestLoadCalendar(t *testing.T) {
+	c, err := LoadCalendar("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsTradingDay(myt("2025-10-20 09:00")) {
+		t.Error("a calendar without holidays closed on a Monday")
+	}
+
+	_, err = LoadCalendar(writeHolidays(t, "2025-10-20 Deepavali\n20/10/2025 Deepavali\n"))
+	if err == nil || !strings.Contains(err.Error(), ":2: invalid date") {
+		t.Errorf("LoadCalendar with a bad date = %v, want an error on line 2", err)
+	}
+
+	if _, err := LoadCalendar(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadCalendar of a missing file succeeded")
+	}
+}
+
+func TestScheduleOnTradingDays(t *testing.T) {
+	// A trading-days-only stage on a daily schedule runs on the next trading
+	// day: the schedule gives every day, the calendar skips the closed ones.
+	c, err := LoadCalendar(writeHolidays(t, "2025-10-20 Deepavali\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ParseSchedule("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := myt("2025-10-17 09:00")
+	for !c.IsTradingDay(next) || next.Equal(myt("2025-10-17 09:00")) {
+		next = s.Next(next)
+	}
+	if !next.Equal(myt("2025-10-21 09:00")) {
+		t.Errorf("next trading-day run after Friday = %s, want Tuesday 09:00", next)
+	}
+}
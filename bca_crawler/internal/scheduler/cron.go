@@ -0,0 +1,182 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed five-field cron expression:
+// minute hour day-of-month month day-of-week.
+type Schedule struct {
+	expr   string
+	minute []bool
+	hour   []bool
+	dom    []bool
+	month  []bool
+	dow    []bool
+	// As in cron, when both day fields are restricted a day matches if
+	// either of them does.
+	domAny bool
+	dowAny bool
+}
+
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // Sunday may be written as 0 or 7
+}
+
+// ParseSchedule parses a cron expression such as "*/15 9-18 * * 1-5". Each
+// field accepts "*", numbers, ranges "a-b", lists "a,b" and steps "/n".
+func ParseSchedule(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron %q: want %d fields, got %d", expr, len(cronFields), len(fields))
+	}
+
+	sets := make([][]bool, len(fields))
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %s: %w", expr, cronFields[i].name, err)
+		}
+		sets[i] = set
+	}
+
+	dow := sets[4]
+	dow[0] = dow[0] || dow[7]
+	sets[4] = dow[:7]
+
+	return &Schedule{
+		expr:   expr,
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return nil, fmt.Errorf("invalid value %q", a)
+			}
+			if hi, err = strconv.Atoi(b); err != nil {
+				return nil, fmt.Errorf("invalid value %q", b)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", rangePart)
+			}
+			lo, hi = n, n
+			if hasStep {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+
+	return set, nil
+}
+
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Matches reports whether t falls on the schedule, to the minute.
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.month[int(t.Month())] && s.matchesDay(t) && s.hour[t.Hour()] && s.minute[t.Minute()]
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// Next returns the first minute after t that matches the schedule, or the
+// zero time if none does within five years. In a zone with daylight saving a
+// run in the skipped hour is skipped and one in the repeated hour runs once.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute)
+	from := wallClock(t)
+	t = t.Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	loc := t.Location()
+
+	for t.Before(limit) {
+		switch {
+		case !s.month[int(t.Month())]:
+			t = advance(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+		case !s.matchesDay(t):
+			t = advance(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+		case !s.hour[t.Hour()]:
+			t = advance(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc))
+		case !s.minute[t.Minute()] || !wallClock(t).After(from):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// advance returns next, or the start of the hour after t when next is not
+// later: time.Date moves a time in a daylight saving gap back before t.
+func advance(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+}
+
+// wallClock returns t's date and time of day without its zone, to compare
+// wall clock times across a daylight saving change.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
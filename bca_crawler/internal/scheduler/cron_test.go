@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func myt(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, Location)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+	} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		// The default crawler schedule
+		{"*/10 7-23 * * *", "2025-10-16 09:03", "2025-10-16 09:10"},
+		{"*/10 7-23 * * *", "2025-10-16 09:10", "2025-10-16 09:20"},
+		{"*/10 7-23 * * *", "2025-10-16 23:55", "2025-10-17 07:00"},
+		{"30 2 * * *", "2025-12-31 03:00", "2026-01-01 02:30"},
+		// Steps from a start value and lists
+		{"5/20 * * * *", "2025-10-16 09:26", "2025-10-16 09:45"},
+		{"0 9,13,17 * * *", "2025-10-16 13:00", "2025-10-16 17:00"},
+		// Sunday is 0 or 7
+		{"0 8 * * 7", "2025-10-16 00:00", "2025-10-19 08:00"},
+		{"0 8 * * 0", "2025-10-16 00:00", "2025-10-19 08:00"},
+		{"0 8 * * 1-5", "2025-10-17 08:00", "2025-10-20 08:00"},
+		// Leap days and short months
+		{"0 0 29 2 *", "2025-03-01 00:00", "2028-02-29 00:00"},
+		{"0 0 31 * *", "2025-04-01 00:00", "2025-05-31 00:00"},
+		// With both day fields restricted either one matches
+		{"0 0 1 * 1", "2025-10-16 00:00", "2025-10-20 00:00"},
+		{"0 0 1 * 1", "2025-10-28 00:00", "2025-11-01 00:00"},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) = %v", tt.expr, err)
+		}
+		if got := s.Next(myt(tt.from)); !got.Equal(myt(tt.want)) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.from, got.Format("2006-01-02 15:04 Mon"), tt.want)
+		}
+	}
+
+	// Seconds are dropped before looking for the next minute
+	s, _ := ParseSchedule("* * * * *")
+	if got := s.Next(myt("2025-10-16 09:03").Add(59 * time.Second)); !got.Equal(myt("2025-10-16 09:04")) {
+		t.Errorf("every minute after 09:03:59 = %s, want 09:04", got)
+	}
+
+	// 30 February never comes
+	s, _ = ParseSchedule("0 0 30 2 *")
+	if got := s.Next(myt("2025-01-01 00:00")); !got.IsZero() {
+		t.Errorf("30 February = %s, want the zero time", got)
+	}
+}
+
+func TestScheduleTimeZones(t *testing.T) {
+	s, err := ParseSchedule("30 8 * * 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run compares in Malaysia time, so a host clock in another zone does not
+	// move the run: 00:45 UTC Friday is 08:45 MYT, past the 08:30 run.
+	from := time.Date(2025, 10, 17, 0, 45, 0, 0, time.UTC).In(Location)
+	if got := s.Next(from); !got.Equal(myt("2025-10-20 08:30")) {
+		t.Errorf("next after 00:45 UTC = %s, want Monday 08:30 MYT", got)
+	}
+
+	// Malaysia has no daylight saving: the same wall time all year, while
+	// the UTC offset of a DST zone moves under it.
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no zoneinfo: %v", err)
+	}
+	for _, day := range []string{"2025-03-07", "2025-03-10", "2025-11-03"} {
+		from := myt(day + " 00:00")
+		got := s.Next(from.In(ny).In(Location))
+		if got.Hour() != 8 || got.Minute() != 30 || got.Location() != Location {
+			t.Errorf("next after %s = %s, want 08:30 MYT", day, got)
+		}
+	}
+
+	// Next also works in a DST zone: a run in the skipped spring-forward hour
+	// is skipped, and one in the repeated fall-back hour runs once.
+	daily, _ := ParseSchedule("30 2 * * *")
+	if got := daily.Next(time.Date(2025, 3, 9, 0, 0, 0, 0, ny)); !got.Equal(time.Date(2025, 3, 10, 2, 30, 0, 0, ny)) {
+		t.Errorf("02:30 daily on spring-forward day = %s, want the next day", got)
+	}
+
+	early, _ := ParseSchedule("30 1 * * *")
+	first := early.Next(time.Date(2025, 11, 2, 0, 0, 0, 0, ny))
+	if want := time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC); !first.Equal(want) {
+		t.Fatalf("01:30 daily on fall-back day = %s, want %s", first, want)
+	}
+	if got := early.Next(first); !got.Equal(time.Date(2025, 11, 3, 1, 30, 0, 0, ny)) {
+		t.Errorf("01:30 daily after the first 01:30 = %s, want the next day", got)
+	}
+}
@@ -0,0 +1,349 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"bca_crawler/internal/utils"
+)
+
+// stopGrace is how long a stage has to shut down after SIGTERM, on shutdown
+// or timeout, before it is killed.
+const stopGrace = 30 * time.Second
+
+// Stage is one step of the pipeline, run as an external command.
+type Stage struct {
+	Name string `json:"name"`
+	// Schedule is a cron expression in Malaysia time; stages without one only
+	// run after the stages they depend on.
+	Schedule string `json:"schedule,omitempty"`
+	// DependsOn lists stages whose successful run triggers this one.
+	DependsOn []string `json:"depends_on,omitempty"`
+	Command   []string `json:"command"`
+	Dir       string   `json:"dir,omitempty"`
+	// OnNewData runs the stage whenever the scheduler's NewData check reports
+	// new announcements, whichever tool stored them, even while another stage
+	// is running.
+	OnNewData bool `json:"on_new_data,omitempty"`
+	// TradingDaysOnly skips the stage on weekends and Bursa holidays.
+	TradingDaysOnly bool `json:"trading_days_only,omitempty"`
+	// Timeout bounds one run, e.g. "2h"; empty means no limit.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// DefaultStages chains the crawler into the parsers, running the bca binary
+// in binDir.
+func DefaultStages(binDir string) []Stage {
+	bca := func(args ...string) []string { return append([]string{filepath.Join(binDir, "bca")}, args...) }
+
+	return []Stage{
+		{Name: "crawler", Schedule: "*/10 7-23 * * *", Command: bca("crawl"), TradingDaysOnly: true, Timeout: "2h"},
+		{Name: "parser", DependsOn: []string{"crawler"}, OnNewData: true, Command: bca("parse", "announcements"), Timeout: "1h"},
+		{Name: "parser-board", DependsOn: []string{"parser"}, Command: bca("parse", "board"), Timeout: "1h"},
+		{Name: "parser-sholder", DependsOn: []string{"parser"}, Command: bca("parse", "shareholding"), Timeout: "1h"},
+		{Name: "parser-att", DependsOn: []string{"parser"}, Command: bca("download", "attachments"), Timeout: "2h"},
+		{Name: "extract-tables", DependsOn: []string{"parser-att"}, Command: bca("extract", "tables"), Timeout: "1h"},
+		{Name: "crawler-backup", Schedule: "30 2 * * *", Command: []string{filepath.Join(binDir, "crawler-backup")}, Timeout: "4h"},
+	}
+}
+
+// LoadStages reads a JSON array of stages.
+func LoadStages(path string) ([]Stage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read stages: %w", err)
+	}
+
+	var stages []Stage
+	if err := json.Unmarshal(data, &stages); err != nil {
+		return nil, fmt.Errorf("parse stages %s: %w", path, err)
+	}
+	return stages, nil
+}
+
+type stageState struct {
+	Stage
+	schedule *Schedule
+	timeout  time.Duration
+	next     time.Time
+}
+
+// stageResult reports a finished stage run to the scheduler loop.
+type stageResult struct {
+	name string
+	ok   bool
+}
+
+// Scheduler runs stages one at a time, with one exception: an OnNewData stage
+// may start while another stage runs, so parsing starts as soon as new
+// announcements land instead of after the crawl that stores them. A stage
+// never overlaps itself. A stage becomes due on its schedule or when a stage
+// it depends on succeeds.
+type Scheduler struct {
+	stages   map[string]*stageState
+	order    []string
+	calendar *Calendar
+	queue    []string
+	running  map[string]bool
+
+	// NewData, when set, is polled every PollInterval and queues the
+	// OnNewData stages when it reports true.
+	NewData      func() (bool, error)
+	PollInterval time.Duration
+	nextPoll     time.Time
+}
+
+func New(stages []Stage, calendar *Calendar) (*Scheduler, error) {
+	s := &Scheduler{
+		stages:   make(map[string]*stageState, len(stages)),
+		calendar: calendar,
+		running:  make(map[string]bool),
+	}
+
+	for _, st := range stages {
+		if st.Name == "" || len(st.Command) == 0 {
+			return nil, fmt.Errorf("stage %q: name and command are required", st.Name)
+		}
+		if _, dup := s.stages[st.Name]; dup {
+			return nil, fmt.Errorf("stage %q defined twice", st.Name)
+		}
+
+		state := &stageState{Stage: st}
+		if st.Schedule != "" {
+			sched, err := ParseSchedule(st.Schedule)
+			if err != nil {
+				return nil, fmt.Errorf("stage %q: %w", st.Name, err)
+			}
+			state.schedule = sched
+		}
+		if st.Timeout != "" {
+			d, err := time.ParseDuration(st.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("stage %q: timeout: %w", st.Name, err)
+			}
+			state.timeout = d
+		}
+
+		s.stages[st.Name] = state
+		s.order = append(s.order, st.Name)
+	}
+
+	for _, name := range s.order {
+		for _, dep := range s.stages[name].DependsOn {
+			if _, ok := s.stages[dep]; !ok {
+				return nil, fmt.Errorf("stage %q depends on unknown stage %q", name, dep)
+			}
+		}
+	}
+	if err := s.checkCycles(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Scheduler) checkCycles() error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	mark := make(map[string]int)
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch mark[name] {
+		case visiting:
+			return fmt.Errorf("stage dependency cycle through %q", name)
+		case done:
+			return nil
+		}
+		mark[name] = visiting
+		for _, dep := range s.stages[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		mark[name] = done
+		return nil
+	}
+
+	for _, name := range s.order {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run schedules and runs stages until ctx is cancelled, then waits for the
+// running stages to shut down.
+func (s *Scheduler) Run(ctx context.Context) error {
+	log := utils.Logger
+
+	now := time.Now().In(Location)
+	for _, name := range s.order {
+		if st := s.stages[name]; st.schedule != nil {
+			st.next = st.schedule.Next(now)
+			log.Infof("Stage %s scheduled %q, next run %s", name, st.schedule, st.next.Format("2006-01-02 15:04"))
+		}
+	}
+
+	// Each stage runs at most once at a time, so done never blocks
+	done := make(chan stageResult, len(s.order))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		now = time.Now().In(Location)
+		for _, name := range s.order {
+			st := s.stages[name]
+			if st.schedule != nil && !st.next.IsZero() && !now.Before(st.next) {
+				st.next = st.schedule.Next(now)
+				s.enqueue(name, "schedule")
+			}
+		}
+		s.pollNewData(now)
+
+		for {
+			name, ok := s.dequeue()
+			if !ok {
+				break
+			}
+			s.running[name] = true
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				done <- stageResult{name: name, ok: s.runStage(ctx, name)}
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case r := <-done:
+			delete(s.running, r.name)
+			if r.ok {
+				for _, other := range s.order {
+					if slices.Contains(s.stages[other].DependsOn, r.name) {
+						s.enqueue(other, "after "+r.name)
+					}
+				}
+			}
+		case <-time.After(time.Until(s.nextWake(now))):
+		}
+	}
+}
+
+func (s *Scheduler) enqueue(name, reason string) {
+	if slices.Contains(s.queue, name) {
+		return
+	}
+	utils.Logger.WithField(utils.FieldStage, name).Infof("Stage %s queued (%s)", name, reason)
+	s.queue = append(s.queue, name)
+}
+
+// dequeue takes the first queued stage that may start now. None of its
+// dependencies may still be queued, so upstream stages always run first, and
+// it must not be running already. While any stage runs only OnNewData stages
+// may start.
+func (s *Scheduler) dequeue() (string, bool) {
+	for i, name := range s.queue {
+		if s.running[name] || (len(s.running) > 0 && !s.stages[name].OnNewData) {
+			continue
+		}
+
+		blocked := false
+		for _, dep := range s.stages[name].DependsOn {
+			if slices.Contains(s.queue, dep) {
+				blocked = true
+				break
+			}
+		}
+		if !blocked {
+			s.queue = slices.Delete(s.queue, i, i+1)
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (s *Scheduler) pollNewData(now time.Time) {
+	if s.NewData == nil || now.Before(s.nextPoll) {
+		return
+	}
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	s.nextPoll = now.Add(interval)
+
+	found, err := s.NewData()
+	if err != nil {
+		utils.Logger.Warnf("New data check failed: %v", err)
+		return
+	}
+	if !found {
+		return
+	}
+	for _, name := range s.order {
+		if s.stages[name].OnNewData {
+			s.enqueue(name, "new announcements")
+		}
+	}
+}
+
+func (s *Scheduler) nextWake(now time.Time) time.Time {
+	wake := now.Add(time.Hour)
+	if s.NewData != nil && s.nextPoll.Before(wake) {
+		wake = s.nextPoll
+	}
+	for _, st := range s.stages {
+		if !st.next.IsZero() && st.next.Before(wake) {
+			wake = st.next
+		}
+	}
+	return wake
+}
+
+// runStage runs one stage to completion and reports whether it succeeded.
+func (s *Scheduler) runStage(ctx context.Context, name string) bool {
+	log := utils.Logger.WithField(utils.FieldStage, name)
+	st := s.stages[name]
+
+	if st.TradingDaysOnly && !s.calendar.IsTradingDay(time.Now()) {
+		log.Infof("Stage %s skipped: not a trading day", name)
+		return false
+	}
+
+	runCtx := ctx
+	if st.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, st.timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(runCtx, st.Command[0], st.Command[1:]...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = stopGrace
+	cmd.Dir = st.Dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	log.Infof("Stage %s starting: %v", name, st.Command)
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		log.Errorf("[Error] Stage %s failed after %s: %v", name, time.Since(start).Round(time.Second), err)
+		return false
+	}
+
+	log.Infof("Stage %s finished in %s", name, time.Since(start).Round(time.Second))
+	return true
+}
@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestScheduler(t *testing.T, stages []Stage) *Scheduler {
+	t.Helper()
+	s, err := New(stages, &Calendar{holidays: map[string]string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNewRejectsInvalidStages(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages []Stage
+	}{
+		{"no command", []Stage{{Name: "a"}}},
+		{"duplicate", []Stage{{Name: "a", Command: []string{"true"}}, {Name: "a", Command: []string{"true"}}}},
+		{"unknown dependency", []Stage{{Name: "a", Command: []string{"true"}, DependsOn: []string{"b"}}}},
+		{"cycle", []Stage{
+			{Name: "a", Command: []string{"true"}, DependsOn: []string{"b"}},
+			{Name: "b", Command: []string{"true"}, DependsOn: []string{"a"}},
+		}},
+		{"bad schedule", []Stage{{Name: "a", Command: []string{"true"}, Schedule: "61 * * * *"}}},
+		{"bad timeout", []Stage{{Name: "a", Command: []string{"true"}, Timeout: "soon"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.stages, nil); err == nil {
+				t.Errorf("New accepted %+v", tt.stages)
+			}
+		})
+	}
+
+	if _, err := New(DefaultStages("bin"), nil); err != nil {
+		t.Errorf("New(DefaultStages) = %v", err)
+	}
+}
+
+func TestDequeue(t *testing.T) {
+	s := newTestScheduler(t, DefaultStages("bin"))
+
+	// Upstream stages go first
+	s.queue = []string{"parser-board", "parser", "crawler"}
+	if name, _ := s.dequeue(); name != "crawler" {
+		t.Fatalf("dequeue = %s, want crawler", name)
+	}
+	s.running["crawler"] = true
+
+	// While the crawler runs only the OnNewData parser may start
+	if name, _ := s.dequeue(); name != "parser" {
+		t.Fatalf("dequeue during crawl = %s, want parser", name)
+	}
+	s.running["parser"] = true
+	if name, ok := s.dequeue(); ok {
+		t.Fatalf("dequeue with two stages running = %s, want none", name)
+	}
+
+	// A running stage is not started twice
+	s.queue = append(s.queue, "parser")
+	delete(s.running, "crawler")
+	if name, ok := s.dequeue(); ok {
+		t.Fatalf("dequeue while parser runs = %s, want none", name)
+	}
+
+	delete(s.running, "parser")
+	for _, want := range []string{"parser", "parser-board"} {
+		name, _ := s.dequeue()
+		if name != want {
+			t.Fatalf("dequeue = %s, want %s", name, want)
+		}
+	}
+}
+
+func TestRunParsesDuringCrawl(t *testing.T) {
+	dir := t.TempDir()
+	sh := func(script string) []string { return []string{"sh", "-c", script} }
+
+	s := newTestScheduler(t, []Stage{
+		{Name: "crawler", Dir: dir, Command: sh("touch crawl.started; sleep 1; touch crawl.done")},
+		{Name: "parser", Dir: dir, DependsOn: []string{"crawler"}, OnNewData: true,
+			Command: sh(`if [ -e crawl.done ]; then echo after >> parser.log; else echo during >> parser.log; fi`)},
+	})
+
+	// New announcements are reported once, after the crawl started
+	var reported atomic.Bool
+	s.PollInterval = 10 * time.Millisecond
+	s.NewData = func() (bool, error) {
+		if _, err := os.Stat(filepath.Join(dir, "crawl.started")); err != nil {
+			return false, nil
+		}
+		return !reported.Swap(true), nil
+	}
+	s.enqueue("crawler", "test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- s.Run(ctx) }()
+
+	var log string
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		data, _ := os.ReadFile(filepath.Join(dir, "parser.log"))
+		if log = string(data); strings.Count(log, "\n") >= 2 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	if err := <-stopped; err != nil {
+		t.Fatalf("Run = %v", err)
+	}
+
+	// The parser ran on the new data during the crawl, and again after it
+	if log != "during\nafter\n" {
+		t.Errorf("parser runs = %q, want during then after", log)
+	}
+}
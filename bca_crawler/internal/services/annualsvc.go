@@ -0,0 +1,360 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/people"
+	"bca_crawler/internal/utils"
+)
+
+// Annual report sections read by ParseAnnualReport
+const (
+	sectionNone = iota
+	sectionProfiles
+	sectionCorporateInfo
+	sectionShareholders
+)
+
+// sourceAnnualReport is the source_of_data of every record read from an
+// annual report.
+const sourceAnnualReport = "Annual Report"
+
+var (
+	profileHeading       = regexp.MustCompile(`^(BOARD OF )?DIRECTORS'? PROFILES?$|^PROFILES? OF (THE )?(BOARD OF )?DIRECTORS$`)
+	corporateHeading     = regexp.MustCompile(`^CORPORATE INFORMATION$`)
+	shareholdersHeading  = regexp.MustCompile(`^(LIST OF |STATEMENT OF |REGISTER OF )?SUBSTANTIAL SHAREHOLDERS`)
+	otherSectionHeading  = regexp.MustCompile(`^(CHAIRMAN'S (STATEMENT|LETTER|MESSAGE)|MANAGEMENT DISCUSSION|KEY SENIOR MANAGEMENT|PROFILES? OF (THE )?KEY|CORPORATE GOVERNANCE|SUSTAINABILITY|AUDIT (AND RISK )?COMMITTEE REPORT|FINANCIAL STATEMENTS|DIRECTORS' REPORT|ANALYSIS OF (SHAREHOLDINGS|WARRANT)|(LIST OF )?(THIRTY|30|TOP 30) LARGEST|DIRECTORS' (SHAREHOLDINGS|INTERESTS)|LIST OF (TOP|THIRTY|30|PROPERTIES)|NOTICE OF|CORPORATE STRUCTURE|FIVE[- ]YEAR|(GROUP )?FINANCIAL HIGHLIGHTS|STATEMENT ON RISK|ADDITIONAL COMPLIANCE|STATEMENT OF DIRECTORS' RESPONSIBILITY)`)
+	continuedSuffix      = regexp.MustCompile(`\s*\((CONT'?D|CONTINUED)\.?\)$`)
+	pageNumberLine       = regexp.MustCompile(`^(PAGE\s+)?\d{1,3}$|^ANNUAL REPORT \d{4}$`)
+	corporateLabel       = regexp.MustCompile(`^(BOARD OF DIRECTORS|AUDIT( AND RISK( MANAGEMENT)?)? COMMITTEE|NOMINATION( AND REMUNERATION)? COMMITTEE|REMUNERATION COMMITTEE|RISK MANAGEMENT COMMITTEE|COMPANY SECRETAR(Y|IES)|JOINT COMPANY SECRETARIES|REGISTERED OFFICE|HEAD OFFICE|BUSINESS OFFICE|PRINCIPAL PLACE OF BUSINESS|CORPORATE OFFICE|SHARE REGISTRAR|AUDITORS?|EXTERNAL AUDITORS?|PRINCIPAL BANKERS?|STOCK EXCHANGE LISTING|STOCK NAME|STOCK CODE|SPONSOR|WEBSITE|INVESTOR RELATIONS)$`)
+	secretaryLabel       = regexp.MustCompile(`^(JOINT )?COMPANY SECRETAR(Y|IES)$`)
+	officeLabel          = regexp.MustCompile(`^REGISTERED OFFICE$`)
+	contactLine          = regexp.MustCompile(`(?i)^(tel|telephone|phone|fax|facsimile|e-?mail|website)\b`)
+	roleLine             = regexp.MustCompile(`(?i)\b(director|chairman|chairperson|chief executive|managing)\b`)
+	genderPattern        = regexp.MustCompile(`(?i)\b(male|female)\b`)
+	agePattern           = regexp.MustCompile(`(?i)\bage(?:d)?\s*:?\s*(\d{2})\b|\b(\d{2})\s*(?:years of age|years old)\b`)
+	nationalityPattern   = regexp.MustCompile(`\b(Malaysian|Singaporean|Indonesian|Australian|British|Chinese|Indian|Japanese|Thai|American|Canadian|Filipino|Taiwanese|Korean|Bruneian|German|French|Dutch|Swiss|New Zealander)\b`)
+	appointedPattern     = regexp.MustCompile(`(?i)(?:appointed (?:to|on) the board[^.]*?\bon|date of (?:first )?appointment\s*:?)\s*(\d{1,2}\s+[A-Za-z]+\s+\d{4})`)
+	academicPattern      = regexp.MustCompile(`(?i)\b(bachelor|master|degree|diploma|ph\.?d|doctor of|doctorate|mba|b\.?sc|m\.?sc|llb|b\.?a\.?\s*\(hons)`)
+	professionalPattern  = regexp.MustCompile(`(?i)\b(fellow|chartered|member of the|certified|cpa|acca|micpa|mia|maicsa|cima|cfa|advocate and solicitor)\b`)
+	directorshipsPattern = regexp.MustCompile(`(?i)directorships?\s+(?:in|of)\s+(?:other\s+)?public\s+(?:listed\s+)?compan(?:y|ies)[^:]*:?\s*(.*)`)
+	regNoPattern         = regexp.MustCompile(`\(([^)]*\d[^)]*)\)`)
+	shareholderRow       = regexp.MustCompile(`^(?:\d{1,2}\.?\s+)?(.*?[A-Za-z].*?)\s+([\d,]{4,}|-)\s+\*?([\d.]+|-)\*?(?:\s+([\d,]{4,}|-)\s+\*?([\d.]+|-)\*?)?$`)
+	shareholderHeader    = regexp.MustCompile(`(?i)\b(name|direct|indirect|deemed|no\. of shares)\b|%`)
+	sentenceEnd          = regexp.MustCompile(`[.;]\s+`)
+	rowNumber            = regexp.MustCompile(`^\d{1,2}\.?\s+`)
+)
+
+// reportLine is one line of report text with the page it was found on.
+type reportLine struct {
+	text string
+	page int
+}
+
+// ParseAnnualReport reads the directors' profiles, the corporate information
+// page and the substantial shareholder list from the page text of an annual
+// report into store, as the same records cmd/import-people loads from the
+// extraction CSVs. pages holds the text of the report's PDF attachments in
+// file and page order; sections the report does not have are left out.
+func ParseAnnualReport(report *models.AnnualReport, pages []*models.AttachmentPage, store *people.DataStore) {
+	sections := map[int][]reportLine{}
+	current := sectionNone
+
+	for _, p := range pages {
+		for _, line := range strings.Split(p.Text, "\n") {
+			line = strings.TrimSpace(line)
+			heading := normalizeHeading(line)
+			if line == "" || pageNumberLine.MatchString(heading) {
+				continue
+			}
+
+			switch {
+			case !isHeadingLine(line):
+			case profileHeading.MatchString(heading):
+				current = sectionProfiles
+				continue
+			case corporateHeading.MatchString(heading):
+				current = sectionCorporateInfo
+				continue
+			case shareholdersHeading.MatchString(heading):
+				current = sectionShareholders
+				continue
+			case otherSectionHeading.MatchString(heading):
+				current = sectionNone
+				continue
+			}
+
+			if current != sectionNone {
+				sections[current] = append(sections[current], reportLine{text: line, page: p.PageNo})
+			}
+		}
+	}
+
+	base := people.PeopleProfile{
+		CompanyName:  report.CompanyName,
+		DateOfSource: sourceDate(report),
+		SourceOfData: sourceAnnualReport,
+	}
+	store.People = append(store.People, parseDirectorProfiles(sections[sectionProfiles], base)...)
+	store.CompanySecretaries = append(store.CompanySecretaries, parseCompanySecretaries(sections[sectionCorporateInfo], report)...)
+	store.SubShareholders = append(store.SubShareholders, parseSubstantialShareholders(sections[sectionShareholders], report)...)
+}
+
+// sourceDate is the posting date of report, or empty when it is unknown.
+func sourceDate(report *models.AnnualReport) string {
+	if report.DatePosted == nil {
+		return ""
+	}
+	return report.DatePosted.Format("2006-01-02")
+}
+
+// normalizeHeading upper-cases line, straightens quotes and drops a
+// "(cont'd)" suffix so a heading repeated on every page still matches.
+func normalizeHeading(line string) string {
+	s := strings.ToUpper(strings.Join(strings.Fields(line), " "))
+	s = strings.NewReplacer("’", "'", "‘", "'", "`", "'").Replace(s)
+	return continuedSuffix.ReplaceAllString(s, "")
+}
+
+// isHeadingLine reports whether line is set like a heading, in capitals or
+// title case, rather than being a line of running text that happens to start
+// with the words of one.
+func isHeadingLine(line string) bool {
+	if len(line) > 70 || strings.HasSuffix(line, ".") || strings.HasSuffix(line, ",") {
+		return false
+	}
+	for _, word := range strings.Fields(line) {
+		if len(word) > 3 && unicode.IsLower([]rune(word)[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDirectorProfiles splits the profile section into one block per
+// director, each starting at an upper-case name line followed by the
+// director's role.
+func parseDirectorProfiles(lines []reportLine, base people.PeopleProfile) []people.PeopleProfile {
+	var profiles []people.PeopleProfile
+
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			profiles = append(profiles, parseDirectorProfile(lines[start:end], base))
+		}
+	}
+
+	for i := range lines {
+		if isNameLine(lines[i].text) && i+1 < len(lines) && roleLine.MatchString(lines[i+1].text) {
+			flush(i)
+			start = i
+		}
+	}
+	flush(len(lines))
+
+	return profiles
+}
+
+// isNameLine reports whether line looks like a director's name as printed
+// above a profile: two or more words and no lower-case letters.
+func isNameLine(line string) bool {
+	if strings.ToUpper(line) != line || len(strings.Fields(line)) < 2 || len(line) > 80 {
+		return false
+	}
+	if roleLine.MatchString(line) || strings.ContainsAny(line, "0123456789:") {
+		return false
+	}
+	return strings.IndexFunc(line, func(r rune) bool { return r >= 'A' && r <= 'Z' }) >= 0
+}
+
+func parseDirectorProfile(block []reportLine, base people.PeopleProfile) people.PeopleProfile {
+	p := base
+	p.Category = "Director"
+	p.DisplayName = strings.Join(strings.Fields(block[0].text), " ")
+	p.Salutation, p.FullLegalName = utils.SplitTitle(p.DisplayName)
+	p.PositionRole = strings.TrimSpace(block[1].text)
+	p.SourcePageReference = pageReference(block)
+
+	var body []string
+	for _, l := range block[2:] {
+		body = append(body, l.text)
+	}
+	text := strings.Join(body, " ")
+
+	// Qualifications are picked out by sentence, as lines wrap mid-sentence
+	var academic, professional []string
+	for _, sentence := range sentenceEnd.Split(text, -1) {
+		sentence = strings.TrimSuffix(strings.TrimSpace(sentence), ".")
+		if academicPattern.MatchString(sentence) {
+			academic = append(academic, sentence)
+		}
+		if professionalPattern.MatchString(sentence) {
+			professional = append(professional, sentence)
+		}
+	}
+
+	p.BiographyExperience = text
+	p.AcademicQualification = strings.Join(academic, "; ")
+	p.ProfessionalQualification = strings.Join(professional, "; ")
+
+	if m := genderPattern.FindStringSubmatch(text); m != nil {
+		p.Gender = strings.ToUpper(m[1][:1]) + strings.ToLower(m[1][1:])
+	}
+	if m := nationalityPattern.FindStringSubmatch(text); m != nil {
+		p.Nationality = m[1]
+	}
+	// Reports give the age at the date of the report, which puts the year of
+	// birth in one of two years; the age is kept rather than guessing.
+	if m := agePattern.FindStringSubmatch(text); m != nil {
+		p.RemarksNotes = "Age " + m[1] + m[2]
+		if p.DateOfSource != "" {
+			p.RemarksNotes += " as at " + p.DateOfSource
+		}
+	}
+	if m := appointedPattern.FindStringSubmatch(text); m != nil {
+		p.AppointmentDateToBoard = reportDate(m[1])
+	}
+	if m := directorshipsPattern.FindStringSubmatch(text); m != nil {
+		p.OtherDirectorshipPublicListedCo = strings.TrimSpace(m[1])
+	}
+
+	return p
+}
+
+// parseCompanySecretaries reads the company secretaries of the corporate
+// information page, with the registered office as their address.
+func parseCompanySecretaries(lines []reportLine, report *models.AnnualReport) []people.CompanySecretary {
+	var secretaries []people.CompanySecretary
+	var address, contact []string
+
+	label := ""
+	for _, l := range lines {
+		if heading := normalizeHeading(strings.TrimSuffix(l.text, ":")); corporateLabel.MatchString(heading) {
+			label = heading
+			continue
+		}
+
+		switch {
+		case secretaryLabel.MatchString(label):
+			name := strings.TrimSpace(regNoPattern.ReplaceAllString(l.text, ""))
+			regNo := ""
+			if m := regNoPattern.FindStringSubmatch(l.text); m != nil {
+				regNo = strings.TrimSpace(m[1])
+			}
+
+			// A registration number on a line of its own belongs to the
+			// secretary above it
+			if name == "" && len(secretaries) > 0 {
+				last := &secretaries[len(secretaries)-1]
+				last.CompanySecretaryRegNo = strings.TrimPrefix(last.CompanySecretaryRegNo+"; "+regNo, "; ")
+				continue
+			}
+
+			secretaries = append(secretaries, people.CompanySecretary{
+				SourceOfData:          sourceAnnualReport,
+				CompanyName:           report.CompanyName,
+				DateOfSource:          sourceDate(report),
+				CompanySecretaryName:  name,
+				CompanySecretaryRegNo: regNo,
+				SourcePageReference:   fmt.Sprintf("%d", l.page),
+			})
+		case officeLabel.MatchString(label):
+			if contactLine.MatchString(l.text) {
+				contact = append(contact, l.text)
+			} else {
+				address = append(address, strings.TrimSuffix(l.text, ","))
+			}
+		}
+	}
+
+	for i := range secretaries {
+		secretaries[i].CompanySecretaryAddress = strings.Join(address, ", ")
+		secretaries[i].CompanySecretaryContact = strings.Join(contact, "; ")
+	}
+	return secretaries
+}
+
+// parseSubstantialShareholders reads the rows of the substantial shareholder
+// table: name, direct shares and %, then optionally indirect shares and %. A
+// name wrapped over several lines is joined up.
+func parseSubstantialShareholders(lines []reportLine, report *models.AnnualReport) []people.SubsidiaryShareholder {
+	var holders []people.SubsidiaryShareholder
+	var pending []string
+
+	for _, l := range lines {
+		m := shareholderRow.FindStringSubmatch(l.text)
+		if m == nil {
+			if shareholderHeader.MatchString(l.text) {
+				// Column headings
+				pending = nil
+			} else {
+				pending = append(pending, l.text)
+			}
+			continue
+		}
+
+		name := rowNumber.ReplaceAllString(strings.Join(append(pending, m[1]), " "), "")
+		pending = nil
+
+		h := people.SubsidiaryShareholder{
+			SourceOfData:        sourceAnnualReport,
+			SubsidiaryName:      report.CompanyName,
+			CompanyName:         report.CompanyName,
+			DateOfSource:        sourceDate(report),
+			ShareholderName:     name,
+			NumberOfSharesOwned: dashEmpty(m[2]),
+			Ownership:           dashEmpty(m[3]),
+			SourcePageReference: fmt.Sprintf("%d", l.page),
+		}
+
+		// Direct and deemed interest add up to the effective ownership
+		direct := utils.ParseFloat(m[3])
+		indirect := utils.ParseFloat(m[5])
+		if direct != nil || indirect != nil {
+			total := 0.0
+			if direct != nil {
+				total += *direct
+			}
+			if indirect != nil {
+				total += *indirect
+			}
+			h.EffectiveEquityOwnership = fmt.Sprintf("%.2f", total)
+		}
+
+		holders = append(holders, h)
+	}
+	return holders
+}
+
+// pageReference returns the page, or page range, block spans.
+func pageReference(block []reportLine) string {
+	first, last := block[0].page, block[len(block)-1].page
+	if first == last {
+		return fmt.Sprintf("%d", first)
+	}
+	return fmt.Sprintf("%d-%d", first, last)
+}
+
+// reportDate turns a date such as "1 June 2018" into YYYY-MM-DD, or returns
+// it as found when it does not parse.
+func reportDate(s string) string {
+	if t := utils.ParseDate(s); t != nil {
+		return t.Format("2006-01-02")
+	}
+	if t, err := time.Parse("2 January 2006", s); err == nil {
+		return t.Format("2006-01-02")
+	}
+	return s
+}
+
+func dashEmpty(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
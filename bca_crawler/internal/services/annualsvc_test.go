@@ -0,0 +1,237 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/people"
+)
+
+// reportPages numbers the page texts from first, as the text of one PDF.
+func reportPages(first int, texts ...string) []*models.AttachmentPage {
+	pages := make([]*models.AttachmentPage, len(texts))
+	for i, text := range texts {
+		pages[i] = &models.AttachmentPage{AnnID: 1, File: "ar2024.pdf", PageNo: first + i, Text: text}
+	}
+	return pages
+}
+
+var reportPosted = time.Date(2025, 4, 30, 0, 0, 0, 0, time.UTC)
+
+var testReport = &models.AnnualReport{
+	AnnID:       1,
+	CompanyName: "HAP SENG PLANTATIONS HOLDINGS BERHAD",
+	DatePosted:  &reportPosted,
+}
+
+func TestParseAnnualReport(t *testing.T) {
+	pages := reportPages(12,
+		// A profile runs over onto the next page, under a repeated heading
+		`ANNUAL REPORT 2024
+DIRECTORS' PROFILES
+TAN SRI DATO' LIM KOK WING
+Independent Non-Executive Chairman
+Malaysian, Male, aged 68
+He was appointed to the Board on 1 June 2018. He holds a Bachelor of Economics
+from the University of Malaya. He is a Fellow of the Chartered Institute of`,
+		`DIRECTORS’ PROFILES (CONT'D)
+Management. Directorships in other public companies: Genting Berhad
+NUR AINA BINTI ABDULLAH
+Executive Director
+Malaysian, Female, aged 45
+Date of first appointment: 15 March 2020. She holds a Master of Business Administration.
+13`,
+		`CORPORATE INFORMATION
+BOARD OF DIRECTORS
+Tan Sri Dato' Lim Kok Wing
+COMPANY SECRETARIES
+Wong Mei Ling (MAICSA 7012345)
+Lee Chee Keong
+(SSM PC No. 202008001234)
+REGISTERED OFFICE
+Level 8, Menara Hap Seng,
+Jalan P. Ramlee,
+50250 Kuala Lumpur
+Tel: 03-2145 1234
+Fax: 03-2145 5678
+SHARE REGISTRAR
+Tricor Investor & Issuing House Services Sdn Bhd`,
+		// The shareholder table wraps a name and runs onto the next page,
+		// and stops at the next section
+		`ANALYSIS OF SHAREHOLDINGS
+Size of Holdings No. of Holders
+SUBSTANTIAL SHAREHOLDERS
+(As per the Register of Substantial Shareholders)
+No. Name of Shareholder Direct % Indirect %
+1. Lim Kok Wing Holdings Sdn Bhd 120,500,000 25.10 - -
+2. Tan Sri Dato' Lim Kok Wing - - 120,500,000 *25.10
+3. Employees Provident Fund
+Board 30,000,000 6.25`,
+		`SUBSTANTIAL SHAREHOLDERS (CONT'D)
+No. Name of Shareholder Direct % Indirect %
+4. Kumpulan Wang Persaraan (Diperbadankan) 21,000,000 4.38 1,000,000 0.21
+THIRTY LARGEST SHAREHOLDERS
+1. Citigroup Nominees (Tempatan) Sdn Bhd 50,000,000 10.42`,
+	)
+
+	store := &people.DataStore{}
+	ParseAnnualReport(testReport, pages, store)
+
+	if len(store.People) != 2 {
+		t.Fatalf("got %d directors, want 2: %+v", len(store.People), store.People)
+	}
+	lim, nur := store.People[0], store.People[1]
+	profiles := []struct {
+		field, got, want string
+	}{
+		{"name", lim.DisplayName, "TAN SRI DATO' LIM KOK WING"},
+		{"role", lim.PositionRole, "Independent Non-Executive Chairman"},
+		{"pages", lim.SourcePageReference, "12-13"},
+		{"gender", lim.Gender, "Male"},
+		{"nationality", lim.Nationality, "Malaysian"},
+		{"age", lim.RemarksNotes, "Age 68 as at 2025-04-30"},
+		{"appointed", lim.AppointmentDateToBoard, "2018-06-01"},
+		{"academic", lim.AcademicQualification, "He holds a Bachelor of Economics from the University of Malaya"},
+		{"professional", lim.ProfessionalQualification, "He is a Fellow of the Chartered Institute of Management"},
+		{"directorships", lim.OtherDirectorshipPublicListedCo, "Genting Berhad"},
+		{"source", lim.SourceOfData, "Annual Report"},
+		{"date", lim.DateOfSource, "2025-04-30"},
+		{"name", nur.DisplayName, "NUR AINA BINTI ABDULLAH"},
+		{"role", nur.PositionRole, "Executive Director"},
+		{"pages", nur.SourcePageReference, "13"},
+		{"gender", nur.Gender, "Female"},
+		{"appointed", nur.AppointmentDateToBoard, "2020-03-15"},
+		{"academic", nur.AcademicQualification, "She holds a Master of Business Administration"},
+	}
+	for _, p := range profiles {
+		if p.got != p.want {
+			t.Errorf("director %s = %q, want %q", p.field, p.got, p.want)
+		}
+	}
+	if strings.Contains(lim.BiographyExperience, "NUR AINA") {
+		t.Errorf("the first profile ran into the second: %q", lim.BiographyExperience)
+	}
+
+	wantSecretaries := []struct{ name, regNo string }{
+		{"Wong Mei Ling", "MAICSA 7012345"},
+		{"Lee Chee Keong", "SSM PC No. 202008001234"},
+	}
+	if len(store.CompanySecretaries) != len(wantSecretaries) {
+		t.Fatalf("got %d secretaries, want %d: %+v", len(store.CompanySecretaries), len(wantSecretaries), store.CompanySecretaries)
+	}
+	for i, want := range wantSecretaries {
+		s := store.CompanySecretaries[i]
+		if s.CompanySecretaryName != want.name || s.CompanySecretaryRegNo != want.regNo {
+			t.Errorf("secretary %d = %q (%q), want %q (%q)", i, s.CompanySecretaryName, s.CompanySecretaryRegNo, want.name, want.regNo)
+		}
+		if s.CompanySecretaryAddress != "Level 8, Menara Hap Seng, Jalan P. Ramlee, 50250 Kuala Lumpur" {
+			t.Errorf("secretary %d address = %q", i, s.CompanySecretaryAddress)
+		}
+		if s.CompanySecretaryContact != "Tel: 03-2145 1234; Fax: 03-2145 5678" {
+			t.Errorf("secretary %d contact = %q", i, s.CompanySecretaryContact)
+		}
+		if s.SourcePageReference != "14" {
+			t.Errorf("secretary %d page = %q, want 14", i, s.SourcePageReference)
+		}
+	}
+
+	wantHolders := []struct {
+		name, shares, ownership, effective, page string
+	}{
+		{"Lim Kok Wing Holdings Sdn Bhd", "120,500,000", "25.10", "25.10", "15"},
+		{"Tan Sri Dato' Lim Kok Wing", "", "", "25.10", "15"},
+		{"Employees Provident Fund Board", "30,000,000", "6.25", "6.25", "15"},
+		{"Kumpulan Wang Persaraan (Diperbadankan)", "21,000,000", "4.38", "4.59", "16"},
+	}
+	if len(store.SubShareholders) != len(wantHolders) {
+		t.Fatalf("got %d shareholders, want %d: %+v", len(store.SubShareholders), len(wantHolders), store.SubShareholders)
+	}
+	for i, want := range wantHolders {
+		h := store.SubShareholders[i]
+		if h.ShareholderName != want.name || h.NumberOfSharesOwned != want.shares || h.Ownership != want.ownership ||
+			h.EffectiveEquityOwnership != want.effective || h.SourcePageReference != want.page {
+			t.Errorf("shareholder %d = %q %q %q %q p%s, want %q %q %q %q p%s", i,
+				h.ShareholderName, h.NumberOfSharesOwned, h.Ownership, h.EffectiveEquityOwnership, h.SourcePageReference,
+				want.name, want.shares, want.ownership, want.effective, want.page)
+		}
+		if h.CompanyName != testReport.CompanyName {
+			t.Errorf("shareholder %d company = %q", i, h.CompanyName)
+		}
+	}
+}
+
+func TestParseAnnualReportMissingSections(t *testing.T) {
+	tests := []struct {
+		name                            string
+		pages                           []*models.AttachmentPage
+		directors, secretaries, holders int
+	}{
+		{"no pages", nil, 0, 0, 0},
+		{
+			// Running text that starts like a heading opens no section
+			"running text",
+			reportPages(3, `CHAIRMAN'S STATEMENT
+Substantial shareholders continued to support the Group in 2024.
+Directors' profiles are set out on our website.
+TAN SRI DATO' LIM KOK WING
+Chairman`),
+			0, 0, 0,
+		},
+		{
+			"corporate information only",
+			reportPages(2, `CORPORATE INFORMATION
+COMPANY SECRETARY
+Wong Mei Ling (MAICSA 7012345)
+AUDITORS
+Ernst & Young PLT`),
+			0, 1, 0,
+		},
+		{
+			"shareholders only",
+			reportPages(80, `LIST OF SUBSTANTIAL SHAREHOLDERS
+Name Direct % Deemed %
+Lim Kok Wing Holdings Sdn Bhd 120,500,000 25.10 - -`),
+			0, 0, 1,
+		},
+		{
+			// A heading with nothing under it before the next section
+			"empty profile section",
+			reportPages(10, "DIRECTORS' PROFILES\n11", "CORPORATE GOVERNANCE OVERVIEW STATEMENT\nThe Board is committed to good governance."),
+			0, 0, 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &people.DataStore{}
+			ParseAnnualReport(testReport, tt.pages, store)
+			if len(store.People) != tt.directors || len(store.CompanySecretaries) != tt.secretaries || len(store.SubShareholders) != tt.holders {
+				t.Errorf("got %d directors, %d secretaries, %d shareholders, want %d, %d, %d",
+					len(store.People), len(store.CompanySecretaries), len(store.SubShareholders),
+					tt.directors, tt.secretaries, tt.holders)
+			}
+		})
+	}
+}
+
+func TestParseAnnualReportUndated(t *testing.T) {
+	pages := reportPages(5, `DIRECTORS' PROFILES
+NUR AINA BINTI ABDULLAH
+Executive Director
+Malaysian, Female, aged 45`)
+
+	// Without a posting date no date is made up for the records
+	report := &models.AnnualReport{AnnID: 2, CompanyName: testReport.CompanyName}
+	store := &people.DataStore{}
+	ParseAnnualReport(report, pages, store)
+
+	if len(store.People) != 1 {
+		t.Fatalf("got %d directors, want 1: %+v", len(store.People), store.People)
+	}
+	p := store.People[0]
+	if p.DateOfSource != "" || p.RemarksNotes != "Age 45" {
+		t.Errorf("date %q remarks %q, want no date and \"Age 45\"", p.DateOfSource, p.RemarksNotes)
+	}
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"fmt"
+
+	"bca_crawler/internal/archive"
+	"bca_crawler/internal/models"
+)
+
+// AnnouncementContent returns the raw HTML of ann, loading it from the raw
+// archive when the database only holds its hash. Parsers should read pages
+// through here rather than ann.Content.
+func AnnouncementContent(ann *models.Announcement) (string, error) {
+	if ann.Content != "" || ann.ContentSHA256 == "" {
+		return ann.Content, nil
+	}
+
+	if archive.Default == nil {
+		return "", fmt.Errorf("[Error] ann_id %d is archived but ARCHIVE_DIR is not set", ann.AnnID)
+	}
+
+	data, err := archive.Default.Get(ann.ContentSHA256)
+	if err != nil {
+		return "", err
+	}
+
+	ann.Content = string(data)
+	return ann.Content, nil
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"bca_crawler/internal/utils"
+
+	"github.com/chromedp/chromedp"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrPoolExhausted is returned when no tab becomes free within the acquire
+// timeout.
+var ErrPoolExhausted = errors.New("[Error] browser pool: no tab available")
+
+// errPoolClosed is returned by Acquire after Close.
+var errPoolClosed = errors.New("[Error] browser pool closed")
+
+// BrowserPoolOptions tune a BrowserPool. Zero values disable the matching
+// limit.
+type BrowserPoolOptions struct {
+	// Size is the number of tabs handed out concurrently.
+	Size int
+	// MaxNavigations recycles a tab after this many pages.
+	MaxNavigations int
+	// AcquireTimeout bounds how long Acquire waits for a free tab.
+	AcquireTimeout time.Duration
+	// PageTimeout is the deadline of the context handed out with each tab.
+	PageTimeout time.Duration
+	// Log receives restart and recycling messages; nil means utils.Logger.
+	Log logrus.FieldLogger
+}
+
+// BrowserPool shares one headless Chrome between workers as a fixed set of
+// tabs. Tabs are recycled after MaxNavigations pages or when a navigation
+// fails; if the browser itself stops responding it is restarted and every tab
+// reopens on its next use.
+type BrowserPool struct {
+	ua   string
+	opts BrowserPoolOptions
+
+	mu      sync.Mutex
+	browser context.Context
+	cleanup func()
+	gen     int
+	closed  bool
+
+	idle chan *Tab
+}
+
+// Tab is a browser tab checked out of a BrowserPool.
+type Tab struct {
+	pool        *BrowserPool
+	ctx         context.Context
+	cancel      context.CancelFunc
+	gen         int
+	navigations int
+}
+
+func NewBrowserPool(ua string, opts BrowserPoolOptions) (*BrowserPool, error) {
+	opts.Size = max(opts.Size, 1)
+	if opts.Log == nil {
+		opts.Log = utils.Logger
+	}
+
+	p := &BrowserPool{
+		ua:   ua,
+		opts: opts,
+		idle: make(chan *Tab, opts.Size),
+	}
+	if err := p.start(); err != nil {
+		return nil, err
+	}
+
+	// Tabs are opened lazily on first Acquire
+	for i := 0; i < opts.Size; i++ {
+		p.idle <- &Tab{pool: p}
+	}
+
+	return p, nil
+}
+
+// start launches a browser; callers other than NewBrowserPool hold p.mu.
+func (p *BrowserPool) start() error {
+	ctx, cleanup := InitCtx(p.ua)
+
+	// The browser is started lazily; start it now so tabs attach to it
+	// instead of launching browsers of their own.
+	if err := chromedp.Run(ctx); err != nil {
+		cleanup()
+		return fmt.Errorf("start browser: %w", err)
+	}
+
+	p.browser, p.cleanup = ctx, cleanup
+	return nil
+}
+
+// Generation increases every time the browser is restarted.
+func (p *BrowserPool) Generation() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.gen
+}
+
+// Restart replaces the browser unless it was already restarted since gen.
+func (p *BrowserPool) Restart(gen int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || p.gen != gen {
+		return nil
+	}
+
+	p.opts.Log.Warn("Restarting Chrome.")
+	p.cleanup()
+	p.gen++
+	return p.start()
+}
+
+// Healthy reports whether the browser still answers a trivial script.
+func (p *BrowserPool) Healthy() bool {
+	p.mu.Lock()
+	browser := p.browser
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(browser, 10*time.Second)
+	defer cancel()
+
+	var n int
+	return chromedp.Run(ctx, chromedp.Evaluate(`1`, &n)) == nil
+}
+
+// Acquire waits up to AcquireTimeout for a free tab and returns it with a
+// context bounded by PageTimeout and cancelled along with ctx. The tab must be
+// handed back with Release.
+func (p *BrowserPool) Acquire(ctx context.Context) (*Tab, context.Context, context.CancelFunc, error) {
+	var timeout <-chan time.Time
+	if p.opts.AcquireTimeout > 0 {
+		timer := time.NewTimer(p.opts.AcquireTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var t *Tab
+	select {
+	case t = <-p.idle:
+	case <-timeout:
+		return nil, nil, nil, ErrPoolExhausted
+	case <-ctx.Done():
+		return nil, nil, nil, ctx.Err()
+	}
+
+	gen := p.Generation()
+	if err := t.ensureOpen(); err != nil {
+		p.idle <- t
+		if !errors.Is(err, errPoolClosed) && !p.Healthy() {
+			if rerr := p.Restart(gen); rerr != nil {
+				p.opts.Log.Errorf("[Error] Failed to restart Chrome: %v", rerr)
+			}
+		}
+		return nil, nil, nil, err
+	}
+
+	// The page context hangs off the tab, not ctx, as chromedp needs the
+	// tab's values; ctx only cancels it.
+	var pageCtx context.Context
+	var cancel context.CancelFunc
+	if p.opts.PageTimeout > 0 {
+		pageCtx, cancel = context.WithTimeout(t.ctx, p.opts.PageTimeout)
+	} else {
+		pageCtx, cancel = context.WithCancel(t.ctx)
+	}
+	stop := context.AfterFunc(ctx, cancel)
+
+	return t, pageCtx, func() { stop(); cancel() }, nil
+}
+
+// Release returns t to the pool. A failed navigation closes the tab and, if
+// the browser no longer responds, restarts it; a tab that reached
+// MaxNavigations is closed and reopened on its next use. A navigation
+// cancelled by the caller only closes the tab.
+func (p *BrowserPool) Release(t *Tab, err error) {
+	t.navigations++
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		t.close()
+	case err != nil && !errors.Is(err, ErrChallenge):
+		p.opts.Log.Warnf("Recycling tab after error: %v", err)
+		t.close()
+		if !p.Healthy() {
+			if err := p.Restart(t.gen); err != nil {
+				p.opts.Log.Errorf("[Error] Failed to restart Chrome: %v", err)
+			}
+		}
+	case p.opts.MaxNavigations > 0 && t.navigations >= p.opts.MaxNavigations:
+		p.opts.Log.Infof("Recycling tab after %d navigations", t.navigations)
+		t.close()
+	}
+
+	p.idle <- t
+}
+
+// Do runs fn in a pooled tab. Cancelling ctx aborts fn's navigation.
+func (p *BrowserPool) Do(ctx context.Context, fn func(ctx context.Context) (string, error)) (string, error) {
+	t, pageCtx, cancel, err := p.Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+
+	body, err := fn(pageCtx)
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	p.Release(t, err)
+	return body, err
+}
+
+// Close shuts down every tab and the browser.
+func (p *BrowserPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	for i := 0; i < p.opts.Size; i++ {
+		t := <-p.idle
+		t.close()
+	}
+
+	p.mu.Lock()
+	p.cleanup()
+	p.mu.Unlock()
+}
+
+// ensureOpen opens the tab if it was never opened, was recycled, belongs to
+// a browser that has since been restarted, or its target went away.
+func (t *Tab) ensureOpen() error {
+	p := t.pool
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return errPoolClosed
+	}
+	if t.ctx != nil && t.gen == p.gen && t.ctx.Err() == nil {
+		return nil
+	}
+
+	t.close()
+	t.ctx, t.cancel = chromedp.NewContext(p.browser)
+	if err := chromedp.Run(t.ctx); err != nil {
+		t.close()
+		return fmt.Errorf("open tab: %w", err)
+	}
+
+	t.gen = p.gen
+	t.navigations = 0
+	return nil
+}
+
+func (t *Tab) close() {
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.ctx, t.cancel = nil, nil
+}
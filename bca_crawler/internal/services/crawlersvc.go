@@ -2,16 +2,27 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"bca_crawler/internal/archive"
+	"bca_crawler/internal/db"
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/retry"
 	"bca_crawler/internal/utils"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
 )
 
 // InitCtx launches Chrome headless to scrape and return HTML
@@ -46,8 +57,8 @@ func InitCtx(ua string) (context.Context, func()) {
 	return ctx, cleanup
 }
 
-func RunPage(ctx context.Context, targetURL *string) (string, error) {
-	utils.Logger.Infof("Navigating to %s", *targetURL)
+func RunPage(ctx context.Context, log logrus.FieldLogger, targetURL *string) (string, error) {
+	log.Infof("Navigating to %s", *targetURL)
 	var body string
 
 	if err := chromedp.Run(ctx,
@@ -67,20 +78,19 @@ func RunPage(ctx context.Context, targetURL *string) (string, error) {
 		chromedp.OuterHTML("html", &body, chromedp.ByQuery),
 		LoadAndCaptureAction(&body),
 	); err != nil {
-		utils.Logger.Errorf("[Error] chromedp run error: %v", err)
+		log.Errorf("[Error] chromedp run error: %v", err)
 		return "", err
 	}
 
-	if strings.Contains(strings.ToLower(body), "verify you are human") {
-		utils.Logger.Warn("Cloudflare verification detected.")
-		return "", fmt.Errorf("[Error] cloudflare verification detected")
+	if err := checkChallenge(log, body); err != nil {
+		return "", err
 	}
 
 	return body, nil
 }
 
-func RunRocSearch(ctx context.Context, targetURL *string, searchTerm string) (string, error) {
-	utils.Logger.Infof("Navigating to %s and searching for '%s'", *targetURL, searchTerm)
+func RunRocSearch(ctx context.Context, log logrus.FieldLogger, targetURL *string, searchTerm string) (string, error) {
+	log.Infof("Navigating to %s and searching for '%s'", *targetURL, searchTerm)
 	var body string
 
 	if err := chromedp.Run(ctx,
@@ -101,13 +111,12 @@ func RunRocSearch(ctx context.Context, targetURL *string, searchTerm string) (st
 		chromedp.Sleep(3*time.Second), // Wait for search results
 		chromedp.OuterHTML("html", &body, chromedp.ByQuery),
 	); err != nil {
-		utils.Logger.Errorf("[Error] chromedp run error: %v", err)
+		log.Errorf("[Error] chromedp run error: %v", err)
 		return "", err
 	}
 
-	if strings.Contains(strings.ToLower(body), "verify you are human") {
-		utils.Logger.Warn("Cloudflare verification detected.")
-		return "", fmt.Errorf("[Error] cloudflare verification detected")
+	if err := checkChallenge(log, body); err != nil {
+		return "", err
 	}
 
 	return body, nil
@@ -155,3 +164,250 @@ func GetURLs(body string) ([]string, error) {
 
 	return urls, nil
 }
+
+// ErrAnnouncementNotFound is returned when Bursa serves its "HTML file is not
+// found" page for an ann_id. Not-found ids are retried on the ledger's
+// decaying schedule rather than in-run.
+var ErrAnnouncementNotFound = errors.New("announcement not found")
+
+// ErrAnnouncementWithdrawn is returned when the announcement was withdrawn by
+// the issuer.
+var ErrAnnouncementWithdrawn = errors.New("announcement withdrawn")
+
+// DiscoverMaxAnnID loads the announcements listing and returns the highest
+// ann_id shown on it.
+func DiscoverMaxAnnID(ctx context.Context, f Fetcher, cfg *utils.Config) (int, error) {
+	body, err := f.Fetch(ctx, cfg.StartURL)
+	if err != nil {
+		return 0, fmt.Errorf("load start page: %w", err)
+	}
+
+	return GetMaxAnnID(body), nil
+}
+
+// FetchAnnouncement loads a single announcement detail page, retrying
+// transient failures according to cfg's retry policy.
+func FetchAnnouncement(ctx context.Context, log logrus.FieldLogger, f Fetcher, cfg *utils.Config, annID int) (*models.Announcement, error) {
+	url := cfg.DetailDomain + cfg.DetailURL + strconv.Itoa(annID)
+
+	policy := retry.NewPolicy(cfg)
+	policy.Log = log
+	html, outcome, err := policy.Do(ctx, fmt.Sprintf("ID %d", annID), func() (string, error) {
+		return f.Fetch(ctx, url)
+	})
+
+	switch {
+	case outcome.Reason == retry.ReasonCanceled:
+		return nil, err
+	case outcome.Reason == retry.ReasonNotFound:
+		return nil, ErrAnnouncementNotFound
+	case outcome.Reason == retry.ReasonWithdrawn:
+		return nil, ErrAnnouncementWithdrawn
+	case err != nil:
+		return nil, err
+	case outcome.Class != retry.OK:
+		return nil, fmt.Errorf("[Error] page rejected: %s", outcome.Reason)
+	}
+
+	return &models.Announcement{
+		AnnID:   annID,
+		Link:    url,
+		Content: html,
+	}, nil
+}
+
+// CrawlStore receives crawl outcomes, always in ann_id order.
+type CrawlStore interface {
+	SaveAnnouncement(ctx context.Context, a *models.Announcement) error
+	RecordCrawlAttempt(ctx context.Context, a *models.CrawlAttempt) error
+}
+
+// DBCrawlStore saves announcements and ledger rows to the database. When the
+// raw archive is enabled the page goes to the archive and only its hash is
+// stored on the announcement.
+type DBCrawlStore struct {
+	DB *sqlx.DB
+}
+
+func (s DBCrawlStore) SaveAnnouncement(ctx context.Context, a *models.Announcement) error {
+	if archive.Default != nil {
+		sum, err := archive.Default.Put([]byte(a.Content))
+		if err != nil {
+			return err
+		}
+		a.ContentSHA256 = sum
+
+		if err := db.RecordRawPage(ctx, s.DB, &models.RawPage{
+			AnnID:      a.AnnID,
+			SHA256:     sum,
+			Size:       len(a.Content),
+			HTTPStatus: utils.PtrInt(200),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return db.SaveAnnouncement(ctx, s.DB, a)
+}
+
+func (s DBCrawlStore) RecordCrawlAttempt(ctx context.Context, a *models.CrawlAttempt) error {
+	return db.RecordCrawlAttempt(ctx, s.DB, a)
+}
+
+// crawlChunkSize is the number of consecutive ann_ids a worker claims at once.
+const crawlChunkSize = 10
+
+type crawlResult struct {
+	index int
+	ann   *models.Announcement
+	err   error
+}
+
+// CrawlAnnouncements fetches every ann_id in ids with one worker per fetcher
+// and hands each outcome to store. Workers claim consecutive chunks of ids, but
+// outcomes are committed in the order of ids, so an interrupted run never
+// leaves a recorded ann_id above an unrecorded one. If the circuit breaker
+// halts or ctx is cancelled, nothing from the first halted ann_id onwards is
+// recorded, so the next run resumes there; pages fetched before it are still
+// saved. It returns the number of announcements saved, and
+// retry.ErrCircuitOpen or ctx's error when the crawl halted.
+func CrawlAnnouncements(ctx context.Context, log logrus.FieldLogger, fetchers []Fetcher, cfg *utils.Config, ids []int, store CrawlStore) (int, error) {
+	chunks := (len(ids) + crawlChunkSize - 1) / crawlChunkSize
+	claims := make(chan int, chunks)
+	for c := 0; c < chunks; c++ {
+		claims <- c
+	}
+	close(claims)
+
+	// window bounds how far workers may run ahead of the committer, so a slow
+	// chunk cannot make the pending buffer grow without limit.
+	window := make(chan struct{}, 2*len(fetchers))
+	results := make(chan crawlResult, crawlChunkSize*len(fetchers))
+
+	// stop ends fetching once the breaker gives up; the remaining claims are
+	// drained without touching the network.
+	var stop atomic.Bool
+
+	var wg sync.WaitGroup
+	for _, f := range fetchers {
+		wg.Add(1)
+		go func(f Fetcher) {
+			defer wg.Done()
+			for {
+				// Take the window token before the claim: a worker waiting
+				// for a token must not hold the chunk the committer needs.
+				window <- struct{}{}
+				c, ok := <-claims
+				if !ok {
+					<-window
+					return
+				}
+				end := min((c+1)*crawlChunkSize, len(ids))
+				for i := c * crawlChunkSize; i < end; i++ {
+					if stop.Load() {
+						results <- crawlResult{index: i, err: retry.ErrCircuitOpen}
+						continue
+					}
+					if err := ctx.Err(); err != nil {
+						results <- crawlResult{index: i, err: err}
+						continue
+					}
+					log := log.WithField(utils.FieldAnnID, ids[i])
+					log.Infof("Processing announcement ID: %d", ids[i])
+					a, err := FetchAnnouncement(ctx, log, f, cfg, ids[i])
+					if errors.Is(err, retry.ErrCircuitOpen) {
+						stop.Store(true)
+					}
+					results <- crawlResult{index: i, ann: a, err: err}
+				}
+			}
+		}(f)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Pages already fetched are saved even after ctx is cancelled
+	commitCtx := context.WithoutCancel(ctx)
+
+	saved := 0
+	next := 0
+	var halted error
+	pending := make(map[int]crawlResult)
+
+	for r := range results {
+		pending[r.index] = r
+
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+
+			if halted == nil && errors.Is(r.err, retry.ErrCircuitOpen) {
+				log.Errorf("[Error] Crawl halted by circuit breaker at ID %d; later IDs are left for the next run.", ids[next])
+				halted = retry.ErrCircuitOpen
+			}
+			if halted == nil && r.err != nil && ctx.Err() != nil {
+				log.Warnf("Crawl interrupted at ID %d; later IDs are left for the next run.", ids[next])
+				halted = ctx.Err()
+			}
+
+			if halted == nil && commitResult(commitCtx, log.WithField(utils.FieldAnnID, ids[next]), ids[next], r, store) {
+				saved++
+			}
+
+			next++
+			if next%crawlChunkSize == 0 || next == len(ids) {
+				<-window
+			}
+		}
+	}
+
+	return saved, halted
+}
+
+// commitResult saves a successful fetch and records the outcome in the crawl
+// ledger.
+func commitResult(ctx context.Context, log logrus.FieldLogger, id int, r crawlResult, store CrawlStore) bool {
+	attempt := &models.CrawlAttempt{AnnID: id}
+
+	var statusErr *StatusError
+	switch {
+	case errors.Is(r.err, ErrAnnouncementNotFound):
+		log.Warnf("Announcement ID %d not found (404). Skipping.", id)
+		attempt.Status = models.CrawlStatusNotFound
+		attempt.HTTPStatus = utils.PtrInt(404)
+	case errors.Is(r.err, ErrAnnouncementWithdrawn):
+		log.Warnf("Announcement ID %d was withdrawn. Skipping.", id)
+		attempt.Status = models.CrawlStatusWithdrawn
+		attempt.HTTPStatus = utils.PtrInt(410)
+	case r.err != nil:
+		log.Errorf("[Error] Failed to load ID %d: %v", id, r.err)
+		attempt.Status = models.CrawlStatusFailed
+		attempt.LastError = utils.PtrString(r.err.Error())
+		if errors.As(r.err, &statusErr) {
+			attempt.HTTPStatus = utils.PtrInt(statusErr.Code)
+		}
+	default:
+		attempt.HTTPStatus = utils.PtrInt(200)
+		if err := store.SaveAnnouncement(ctx, r.ann); err != nil {
+			log.Errorf("[Error] Failed to save ID %d: %v", id, err)
+			attempt.Status = models.CrawlStatusFailed
+			attempt.LastError = utils.PtrString("save: " + err.Error())
+		} else {
+			log.Infof("Saved announcement ID %d", id)
+			attempt.Status = models.CrawlStatusSaved
+		}
+	}
+
+	if err := store.RecordCrawlAttempt(ctx, attempt); err != nil {
+		log.Errorf("[Error] Failed to record crawl attempt for ID %d: %v", id, err)
+	}
+	metrics.CrawlAttempts.WithLabelValues(attempt.Status).Inc()
+
+	return attempt.Status == models.CrawlStatusSaved
+}
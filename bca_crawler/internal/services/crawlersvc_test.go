@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/utils"
+)
+
+// memCrawlStore keeps crawl outcomes in memory, in the order they arrive.
+type memCrawlStore struct {
+	mu       sync.Mutex
+	saved    []*models.Announcement
+	attempts []*models.CrawlAttempt
+}
+
+func (s *memCrawlStore) SaveAnnouncement(ctx context.Context, a *models.Announcement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, a)
+	return nil
+}
+
+func (s *memCrawlStore) RecordCrawlAttempt(ctx context.Context, a *models.CrawlAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = append(s.attempts, a)
+	return nil
+}
+
+func replayConfig() *utils.Config {
+	return &utils.Config{
+		StartURL:         "https://www.bursamalaysia.com/market_information/announcements/company_announcement",
+		DetailDomain:     "https://disclosure.bursamalaysia.com",
+		DetailURL:        "/FileAccess/viewHtml?e=",
+		Fetcher:          "replay",
+		ReplayDir:        "testdata/replay",
+		Concurrency:      2,
+		RetryMaxAttempts: 1,
+	}
+}
+
+func TestDiscoverMaxAnnIDReplay(t *testing.T) {
+	cfg := replayConfig()
+	f, err := NewFetcher(cfg, utils.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	maxID, err := DiscoverMaxAnnID(context.Background(), f, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxID != 3 {
+		t.Errorf("DiscoverMaxAnnID = %d, want 3", maxID)
+	}
+}
+
+func TestCrawlAnnouncementsReplay(t *testing.T) {
+	cfg := replayConfig()
+	fetchers, err := NewFetchers(cfg, utils.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseFetchers(fetchers)
+
+	// 2 is Bursa's not-found page and 4 was never recorded
+	store := &memCrawlStore{}
+	saved, err := CrawlAnnouncements(context.Background(), utils.Logger, fetchers, cfg, []int{1, 2, 3, 4}, store)
+	if err != nil {
+		t.Fatalf("CrawlAnnouncements = %v", err)
+	}
+	if saved != 2 {
+		t.Errorf("saved = %d, want 2", saved)
+	}
+
+	wantSaved := []struct {
+		id        int
+		reference string
+	}{
+		{1, "GA1-15102021-00001"},
+		{3, "GA1-15102023-00003"},
+	}
+	if len(store.saved) != len(wantSaved) {
+		t.Fatalf("got %d saved announcements, want %d", len(store.saved), len(wantSaved))
+	}
+	for i, want := range wantSaved {
+		a := store.saved[i]
+		if a.AnnID != want.id {
+			t.Errorf("saved[%d].AnnID = %d, want %d", i, a.AnnID, want.id)
+		}
+		if link := cfg.DetailDomain + cfg.DetailURL + strconv.Itoa(want.id); a.Link != link {
+			t.Errorf("saved[%d].Link = %q, want %q", i, a.Link, link)
+		}
+		if !strings.Contains(a.Content, want.reference) {
+			t.Errorf("saved[%d].Content does not hold reference %s", i, want.reference)
+		}
+	}
+
+	wantAttempts := []struct {
+		id     int
+		status string
+		http   int
+	}{
+		{1, models.CrawlStatusSaved, 200},
+		{2, models.CrawlStatusNotFound, 404},
+		{3, models.CrawlStatusSaved, 200},
+		{4, models.CrawlStatusFailed, 0},
+	}
+	if len(store.attempts) != len(wantAttempts) {
+		t.Fatalf("got %d ledger rows, want %d", len(store.attempts), len(wantAttempts))
+	}
+	for i, want := range wantAttempts {
+		a := store.attempts[i]
+		if a.AnnID != want.id || a.Status != want.status {
+			t.Errorf("attempts[%d] = %d/%s, want %d/%s", i, a.AnnID, a.Status, want.id, want.status)
+		}
+		if want.http != 0 && (a.HTTPStatus == nil || *a.HTTPStatus != want.http) {
+			t.Errorf("attempts[%d].HTTPStatus = %v, want %d", i, a.HTTPStatus, want.http)
+		}
+	}
+	if last := store.attempts[3]; last.LastError == nil || !strings.Contains(*last.LastError, "no recording") {
+		t.Errorf("attempts[3].LastError = %v, want the missing recording", last.LastError)
+	}
+}
+
+func TestCrawlAnnouncementsCancelled(t *testing.T) {
+	cfg := replayConfig()
+	fetchers, err := NewFetchers(cfg, utils.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseFetchers(fetchers)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Nothing is recorded, so the next run resumes at the first id
+	store := &memCrawlStore{}
+	saved, err := CrawlAnnouncements(ctx, utils.Logger, fetchers, cfg, []int{1, 2, 3}, store)
+	if saved != 0 || !errors.Is(err, context.Canceled) {
+		t.Errorf("CrawlAnnouncements = %d, %v, want 0, context.Canceled", saved, err)
+	}
+	if len(store.attempts) != 0 {
+		t.Errorf("got %d ledger rows after cancel, want 0", len(store.attempts))
+	}
+}
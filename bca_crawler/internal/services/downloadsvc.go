@@ -0,0 +1,391 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"bca_crawler/internal/ratelimit"
+	"bca_crawler/internal/retry"
+	"bca_crawler/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Downloads refused by the size limit or the content type allow-list; they
+// are not retried.
+var (
+	ErrTooLarge      = errors.New("[Error] download exceeds the size limit")
+	ErrContentType   = errors.New("[Error] download content type not allowed")
+	errRangeMismatch = errors.New("partial file does not match; starting over")
+)
+
+// DownloadRequest asks for URL to be downloaded into Path. Whatever an
+// earlier attempt left at Path is resumed with a Range request. Log, when
+// set, carries the request's fields such as ann_id into the retry messages.
+type DownloadRequest struct {
+	URL  string
+	Path string
+	Log  logrus.FieldLogger
+}
+
+// Download is the result of one DownloadRequest. On success the whole file
+// is at Path, for the caller to move into place.
+type Download struct {
+	DownloadRequest
+	Filename string
+	MIME     string
+	Size     int64
+	SHA256   string
+	Err      error
+}
+
+// Downloader fetches files on a bounded worker pool. Each host gets at most
+// PerHost downloads at a time and shares the crawler's per-host rate limit;
+// failed downloads are retried with exponential backoff, resuming from where
+// the last attempt stopped.
+type Downloader struct {
+	client  *http.Client
+	ua      string
+	referer string
+	policy  retry.Policy
+	limiter *ratelimit.HostLimiter
+	log     logrus.FieldLogger
+
+	workers int
+	perHost int
+	maxSize int64
+	types   []string
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func NewDownloader(cfg *utils.Config, log logrus.FieldLogger) (*Downloader, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("create cookie jar: %w", err)
+	}
+
+	d := &Downloader{
+		client: &http.Client{
+			Timeout: cfg.HTTPTimeout,
+			Jar:     jar,
+		},
+		ua:      cfg.UserAgent,
+		referer: cfg.StartURL,
+		policy:  retry.NewPolicy(cfg),
+		log:     log,
+		workers: max(cfg.DownloadWorkers, 1),
+		perHost: max(cfg.DownloadPerHost, 1),
+		maxSize: int64(cfg.DownloadMaxMB) << 20,
+		hosts:   make(map[string]chan struct{}),
+	}
+	if d.log == nil {
+		d.log = utils.Logger
+	}
+	if cfg.RateLimit > 0 {
+		d.limiter = ratelimit.NewHostLimiter(cfg.RateLimit, cfg.RateBurst)
+	}
+	for _, t := range strings.Split(cfg.DownloadTypes, ",") {
+		if t = strings.TrimSpace(strings.ToLower(t)); t != "" {
+			d.types = append(d.types, t)
+		}
+	}
+
+	return d, nil
+}
+
+func (d *Downloader) Close() {
+	d.client.CloseIdleConnections()
+}
+
+// PartPath returns where the partial download of rawURL is kept in dir.
+func PartPath(dir, rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(dir, "."+hex.EncodeToString(sum[:8])+".part")
+}
+
+// DownloadAll downloads reqs on the worker pool and calls fn with each
+// result, in completion order, from the calling goroutine. Once ctx is
+// cancelled the requests not started yet are dropped.
+func (d *Downloader) DownloadAll(ctx context.Context, reqs []DownloadRequest, fn func(res *Download)) {
+	queue := make(chan DownloadRequest)
+	results := make(chan *Download)
+
+	var wg sync.WaitGroup
+	for i := 0; i < min(d.workers, len(reqs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range queue {
+				results <- d.Download(ctx, req)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(queue)
+		for _, req := range reqs {
+			select {
+			case queue <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for res := range results {
+		fn(res)
+	}
+}
+
+// Download fetches one file, retrying with backoff until it succeeds, is
+// refused, or runs out of attempts.
+func (d *Downloader) Download(ctx context.Context, req DownloadRequest) *Download {
+	res := &Download{DownloadRequest: req}
+
+	release, err := d.acquire(ctx, req.URL)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer release()
+
+	log := req.Log
+	if log == nil {
+		log = d.log
+	}
+
+	maxAttempts := max(d.policy.MaxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		if d.limiter != nil {
+			if res.Err = d.limiter.Wait(ctx, req.URL); res.Err != nil {
+				return res
+			}
+		}
+
+		res.Err = d.fetch(ctx, res)
+		if res.Err == nil || ctx.Err() != nil {
+			break
+		}
+		if !retryableDownload(res.Err) || attempt == maxAttempts {
+			res.Err = fmt.Errorf("failed after %d attempts: %w", attempt, res.Err)
+			return res
+		}
+
+		delay := d.policy.Backoff(attempt)
+		log.Warnf("Retrying download of %s after %s (attempt %d/%d): %v",
+			req.URL, delay.Round(time.Millisecond), attempt, maxAttempts, res.Err)
+		if err := utils.Sleep(ctx, delay); err != nil {
+			res.Err = err
+			return res
+		}
+	}
+	if ctx.Err() != nil {
+		res.Err = ctx.Err()
+		return res
+	}
+
+	res.Err = d.finish(res)
+	return res
+}
+
+// acquire waits for a free download slot of the host of rawURL.
+func (d *Downloader) acquire(ctx context.Context, rawURL string) (func(), error) {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+
+	d.mu.Lock()
+	slots, ok := d.hosts[host]
+	if !ok {
+		slots = make(chan struct{}, d.perHost)
+		d.hosts[host] = slots
+	}
+	d.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// retryableDownload reports whether err may go away on another attempt.
+func retryableDownload(err error) bool {
+	if errors.Is(err, ErrTooLarge) || errors.Is(err, ErrContentType) {
+		return false
+	}
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code == http.StatusRequestTimeout || se.Code == http.StatusTooManyRequests || se.Code >= 500
+	}
+	return true
+}
+
+// fetch makes one attempt at downloading res.URL into res.Path, appending to
+// what is already there.
+func (d *Downloader) fetch(ctx context.Context, res *Download) error {
+	var offset int64
+	if fi, err := os.Stat(res.Path); err == nil {
+		offset = fi.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", res.URL, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("User-Agent", d.ua)
+	req.Header.Set("Referer", d.referer)
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		flags |= os.O_TRUNC
+		offset = 0
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			os.Remove(res.Path)
+			return errRangeMismatch
+		}
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		os.Remove(res.Path)
+		return errRangeMismatch
+	default:
+		return &StatusError{URL: res.URL, Code: resp.StatusCode}
+	}
+
+	res.MIME, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !d.allowed(res.MIME) {
+		os.Remove(res.Path)
+		return fmt.Errorf("%w: %s", ErrContentType, res.MIME)
+	}
+	if d.maxSize > 0 && resp.ContentLength > 0 && offset+resp.ContentLength > d.maxSize {
+		os.Remove(res.Path)
+		return fmt.Errorf("%w: %d bytes", ErrTooLarge, offset+resp.ContentLength)
+	}
+	res.Filename = attachmentFilename(resp)
+
+	out, err := os.OpenFile(res.Path, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+
+	body := io.Reader(resp.Body)
+	if d.maxSize > 0 {
+		// One byte over the limit tells a body without Content-Length apart
+		body = io.LimitReader(resp.Body, d.maxSize-offset+1)
+	}
+	n, err := io.Copy(out, body)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	if d.maxSize > 0 && offset+n > d.maxSize {
+		os.Remove(res.Path)
+		return fmt.Errorf("%w: over %d bytes", ErrTooLarge, d.maxSize)
+	}
+
+	return nil
+}
+
+// allowed reports whether the content type is on the allow-list. A missing
+// type is treated as application/octet-stream.
+func (d *Downloader) allowed(contentType string) bool {
+	if len(d.types) == 0 {
+		return true
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	for _, t := range d.types {
+		if prefix, ok := strings.CutSuffix(t, "*"); ok {
+			if strings.HasPrefix(contentType, prefix) {
+				return true
+			}
+		} else if contentType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// attachmentFilename names the file after Content-Disposition, or the last
+// element of the URL path.
+func attachmentFilename(resp *http.Response) string {
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+	filename := ""
+	if err == nil {
+		filename = params["filename"]
+	}
+	if filename == "" {
+		filename = filepath.Base(resp.Request.URL.Path)
+	}
+	if filename == "" || filename == "." || filename == "/" {
+		filename = "attachment.bin"
+	}
+
+	// Sanitize filename (basic)
+	filename = filepath.Base(filename)
+	return strings.ReplaceAll(filename, "%20", "_")
+}
+
+// finish hashes the complete file, including any part resumed from an
+// earlier run, and sniffs its type when the server did not say.
+func (d *Downloader) finish(res *Download) error {
+	f, err := os.Open(res.Path)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if res.Size, err = io.Copy(h, f); err != nil {
+		return fmt.Errorf("hash file: %w", err)
+	}
+	res.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	if res.MIME == "" || res.MIME == "application/octet-stream" {
+		head := make([]byte, 512)
+		n, _ := f.ReadAt(head, 0)
+		res.MIME, _, _ = mime.ParseMediaType(http.DetectContentType(head[:n]))
+	}
+
+	return nil
+}
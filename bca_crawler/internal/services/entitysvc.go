@@ -1,9 +1,11 @@
 package services
 
 import (
+	"context"
 	"fmt"
 
 	"bca_crawler/internal/db"
+	"bca_crawler/internal/metrics"
 	"bca_crawler/internal/models"
 	"bca_crawler/internal/utils"
 
@@ -11,9 +13,9 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func GetOrCreateEntity(log *logrus.Logger, database *sqlx.DB, entity *models.Entity, background *models.Background) (*int, error) {
+func GetOrCreateEntity(ctx context.Context, log logrus.FieldLogger, database *sqlx.DB, entity *models.Entity, background *models.Background) (*int, error) {
 	// Step 1: Check if db contains records with the name/display_name
-	entities, err := db.FindEntitiesByNameOrDisplay(database, *entity.Name, *entity.OriName)
+	entities, err := db.FindEntitiesByNameOrDisplay(ctx, database, *entity.Name, *entity.OriName)
 	if err != nil {
 		return nil, fmt.Errorf("FindEntitiesByNameOrDisplay failed: %w", err)
 	}
@@ -21,26 +23,28 @@ func GetOrCreateEntity(log *logrus.Logger, database *sqlx.DB, entity *models.Ent
 	var permID int
 	if len(entities) > 0 {
 		log.Infof("Found entities: %s", utils.StringValue(entities[0].Name))
+		metrics.Entities.WithLabelValues("matched").Inc()
 
 		for _, perm := range entities {
 			permID = entities[0].SecondaryPermID
 
-			err = db.UpdatePrimaryPermID(database, perm.ID, permID)
+			err = db.UpdatePrimaryPermID(ctx, database, perm.ID, permID)
 			if err != nil {
 				return nil, fmt.Errorf("UpdatePrimaryPermID failed: %w", err)
 			}
 		}
 	} else {
-		permID, err = db.InsertEntity(database, entity)
+		permID, err = db.InsertEntity(ctx, database, entity)
 		if err != nil {
 			return nil, fmt.Errorf("InsertEntity failed: %w", err)
 		}
 		log.Infof("Inserted new entity: %s", *entity.Name)
+		metrics.Entities.WithLabelValues("created").Inc()
 	}
 
 	if background != nil {
 		// Update background information
-		if err = db.UpdateBackground(database, permID, background); err != nil {
+		if err = db.UpdateBackground(ctx, database, permID, background); err != nil {
 			return nil, fmt.Errorf("Qualifications update failed: %w", err)
 		}
 	}
@@ -0,0 +1,496 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/ratelimit"
+	"bca_crawler/internal/retry"
+	"bca_crawler/internal/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Fetcher loads a page and returns its HTML, giving up when ctx is
+// cancelled. Reset drops any session state (browser, cookies) so the next
+// Fetch starts fresh.
+type Fetcher interface {
+	Fetch(ctx context.Context, targetURL string) (string, error)
+	Reset() error
+	Close()
+}
+
+// NewFetcher builds the Fetcher selected by cfg.Fetcher. When cfg.RecordDir
+// is set every fetched page is also written there for later replay. The
+// browser pool and circuit breaker log to log.
+func NewFetcher(cfg *utils.Config, log logrus.FieldLogger) (Fetcher, error) {
+	f, err := newBaseFetcher(cfg, 1, log)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapFetcher(cfg, f, nil, newBreaker(cfg, log), log)
+}
+
+// NewFetchers builds cfg.Concurrency fetchers for the crawl workers. Chrome
+// workers share one browser pool with a tab per worker, HTTP workers share
+// one client and cookie jar, and all workers share a per-host rate limiter
+// when cfg.RateLimit is set and one circuit breaker.
+func NewFetchers(cfg *utils.Config, log logrus.FieldLogger) ([]Fetcher, error) {
+	base, err := newBaseFetcher(cfg, cfg.Concurrency, log)
+	if err != nil {
+		return nil, err
+	}
+
+	var limiter *ratelimit.HostLimiter
+	if cfg.RateLimit > 0 {
+		limiter = ratelimit.NewHostLimiter(cfg.RateLimit, cfg.RateBurst)
+	}
+	breaker := newBreaker(cfg, log)
+
+	fetchers := make([]Fetcher, 0, cfg.Concurrency)
+	for i := 0; i < cfg.Concurrency; i++ {
+		f := base
+		if i > 0 {
+			switch b := base.(type) {
+			case *ChromeFetcher:
+				f = b.Share()
+			case *HTTPFetcher:
+				f = b.Share()
+			}
+		}
+
+		if f, err = wrapFetcher(cfg, f, limiter, breaker, log); err != nil {
+			CloseFetchers(fetchers)
+			return nil, err
+		}
+		fetchers = append(fetchers, f)
+	}
+
+	return fetchers, nil
+}
+
+// CloseFetchers closes fetchers in reverse order, so the fetcher owning a
+// browser pool is closed last.
+func CloseFetchers(fetchers []Fetcher) {
+	for i := len(fetchers) - 1; i >= 0; i-- {
+		fetchers[i].Close()
+	}
+}
+
+func newBaseFetcher(cfg *utils.Config, tabs int, log logrus.FieldLogger) (Fetcher, error) {
+	switch cfg.Fetcher {
+	case "", "chrome":
+		return NewChromeFetcher(cfg, tabs, log)
+	case "http":
+		return NewHTTPFetcher(cfg.UserAgent, cfg.StartURL, cfg.HTTPTimeout, log)
+	case "replay":
+		return NewReplayFetcher(cfg.ReplayDir, log)
+	default:
+		return nil, fmt.Errorf("[Error] unknown fetcher %q", cfg.Fetcher)
+	}
+}
+
+func newBreaker(cfg *utils.Config, log logrus.FieldLogger) *retry.Breaker {
+	b := retry.NewBreaker(cfg)
+	if b != nil {
+		b.Log = log
+	}
+	return b
+}
+
+func wrapFetcher(cfg *utils.Config, f Fetcher, limiter *ratelimit.HostLimiter, breaker *retry.Breaker, log logrus.FieldLogger) (Fetcher, error) {
+	if cfg.RecordDir != "" {
+		rf, err := NewRecordingFetcher(f, cfg.RecordDir, log)
+		if err != nil {
+			return nil, err
+		}
+		f = rf
+	}
+
+	if limiter != nil {
+		f = &RateLimitedFetcher{next: f, limiter: limiter}
+	}
+
+	if breaker != nil {
+		f = &BreakerFetcher{next: f, breaker: breaker, log: log}
+	}
+
+	return f, nil
+}
+
+// ChromeFetcher renders pages in headless Chrome through RunPage, using a tab
+// from a BrowserPool for each page.
+type ChromeFetcher struct {
+	pool  *BrowserPool
+	owner bool
+	gen   int
+}
+
+// NewChromeFetcher starts a browser pool with size tabs.
+func NewChromeFetcher(cfg *utils.Config, size int, log logrus.FieldLogger) (*ChromeFetcher, error) {
+	pool, err := NewBrowserPool(cfg.UserAgent, BrowserPoolOptions{
+		Size:           size,
+		MaxNavigations: cfg.BrowserMaxNavigations,
+		AcquireTimeout: cfg.BrowserAcquireTimeout,
+		PageTimeout:    cfg.BrowserPageTimeout,
+		Log:            log,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ChromeFetcher{pool: pool, owner: true}, nil
+}
+
+// Share returns another fetcher drawing tabs from the same pool. Closing it
+// leaves the pool running.
+func (f *ChromeFetcher) Share() *ChromeFetcher {
+	return &ChromeFetcher{pool: f.pool}
+}
+
+func (f *ChromeFetcher) Fetch(ctx context.Context, targetURL string) (string, error) {
+	f.gen = f.pool.Generation()
+	return f.pool.Do(ctx, func(ctx context.Context) (string, error) {
+		defer metrics.ObservePage("chrome", time.Now())
+		return RunPage(ctx, f.pool.opts.Log, &targetURL)
+	})
+}
+
+// Reset restarts the shared browser, once for all fetchers on the pool.
+func (f *ChromeFetcher) Reset() error {
+	return f.pool.Restart(f.gen)
+}
+
+func (f *ChromeFetcher) Close() {
+	if f.owner {
+		f.pool.Close()
+	}
+}
+
+// HTTPFetcher fetches pages with a plain HTTP client, for pages that do not
+// need JavaScript to render.
+type HTTPFetcher struct {
+	session *httpSession
+	ua      string
+	referer string
+	log     logrus.FieldLogger
+	gen     int
+}
+
+// httpSession is the client and cookie jar shared by an HTTPFetcher and the
+// fetchers made by its Share.
+type httpSession struct {
+	mu     sync.Mutex
+	client *http.Client
+	gen    int
+}
+
+func NewHTTPFetcher(ua, referer string, timeout time.Duration, log logrus.FieldLogger) (*HTTPFetcher, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("create cookie jar: %w", err)
+	}
+
+	return &HTTPFetcher{
+		session: &httpSession{
+			client: &http.Client{
+				Timeout: timeout,
+				Jar:     jar,
+			},
+		},
+		ua:      ua,
+		referer: referer,
+		log:     log,
+	}, nil
+}
+
+// Share returns another fetcher on the same client and cookies.
+func (f *HTTPFetcher) Share() *HTTPFetcher {
+	return &HTTPFetcher{session: f.session, ua: f.ua, referer: f.referer, log: f.log}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, targetURL string) (string, error) {
+	f.log.Infof("Fetching %s", targetURL)
+	defer metrics.ObservePage("http", time.Now())
+
+	var client *http.Client
+	client, f.gen = f.session.current()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("User-Agent", f.ua)
+	req.Header.Set("Referer", f.referer)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{URL: targetURL, Code: resp.StatusCode}
+	}
+
+	body := string(data)
+	if err := checkChallenge(f.log, body); err != nil {
+		return "", err
+	}
+
+	return body, nil
+}
+
+// Reset drops idle connections and cookies, once for all fetchers on the
+// session.
+func (f *HTTPFetcher) Reset() error {
+	return f.session.reset(f.gen)
+}
+
+func (f *HTTPFetcher) Close() {
+	client, _ := f.session.current()
+	client.CloseIdleConnections()
+}
+
+func (s *httpSession) current() (*http.Client, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client, s.gen
+}
+
+// reset swaps in a client with a new cookie jar unless the session was
+// already reset since gen. Requests in flight finish on the old client.
+func (s *httpSession) reset(gen int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.gen != gen {
+		return nil
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return fmt.Errorf("create cookie jar: %w", err)
+	}
+	s.client.CloseIdleConnections()
+	s.client = &http.Client{
+		Transport: s.client.Transport,
+		Timeout:   s.client.Timeout,
+		Jar:       jar,
+	}
+	s.gen++
+	return nil
+}
+
+// StatusError is returned by HTTPFetcher for non-200 responses.
+type StatusError struct {
+	URL  string
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http %d: %s", e.Code, e.URL)
+}
+
+// StatusCode lets the retry package classify the error by HTTP status.
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
+// RateLimitedFetcher waits on a shared per-host limiter before each fetch.
+type RateLimitedFetcher struct {
+	next    Fetcher
+	limiter *ratelimit.HostLimiter
+}
+
+func (f *RateLimitedFetcher) Fetch(ctx context.Context, targetURL string) (string, error) {
+	if err := f.limiter.Wait(ctx, targetURL); err != nil {
+		return "", err
+	}
+	return f.next.Fetch(ctx, targetURL)
+}
+
+func (f *RateLimitedFetcher) Reset() error {
+	return f.next.Reset()
+}
+
+func (f *RateLimitedFetcher) Close() {
+	f.next.Close()
+}
+
+// BreakerFetcher feeds every fetch outcome to a shared retry.Breaker. While
+// the breaker is open all fetches wait; the fetch that trips it waits out the
+// cooldown, resets its session and tries the same URL again, so no ID is
+// skipped while blocked.
+type BreakerFetcher struct {
+	next    Fetcher
+	breaker *retry.Breaker
+	log     logrus.FieldLogger
+	gen     int
+}
+
+func (f *BreakerFetcher) Fetch(ctx context.Context, targetURL string) (string, error) {
+	for {
+		if err := f.breaker.Allow(ctx); err != nil {
+			return "", err
+		}
+
+		if gen := f.breaker.Generation(); gen != f.gen {
+			f.gen = gen
+			if err := f.next.Reset(); err != nil {
+				f.log.Warnf("[Error] Failed to reset fetcher: %v", err)
+			}
+		}
+
+		body, err := f.next.Fetch(ctx, targetURL)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if f.breaker.Record(retry.Classify(err, body)) {
+			continue
+		}
+		return body, err
+	}
+}
+
+func (f *BreakerFetcher) Reset() error {
+	return f.next.Reset()
+}
+
+func (f *BreakerFetcher) Close() {
+	f.next.Close()
+}
+
+// ReplayFetcher serves pages previously recorded into a directory, keyed by
+// ReplayKey. It never touches the network.
+type ReplayFetcher struct {
+	dir string
+	log logrus.FieldLogger
+}
+
+func NewReplayFetcher(dir string, log logrus.FieldLogger) (*ReplayFetcher, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("replay dir: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("replay dir %s is not a directory", dir)
+	}
+	return &ReplayFetcher{dir: dir, log: log}, nil
+}
+
+func (f *ReplayFetcher) Fetch(ctx context.Context, targetURL string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(f.dir, ReplayKey(targetURL))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("replay: no recording for %s", targetURL)
+		}
+		return "", fmt.Errorf("replay: read %s: %w", path, err)
+	}
+
+	body := string(data)
+	if err := checkChallenge(f.log, body); err != nil {
+		return "", err
+	}
+
+	return body, nil
+}
+
+func (f *ReplayFetcher) Reset() error { return nil }
+
+func (f *ReplayFetcher) Close() {}
+
+// RecordingFetcher wraps another Fetcher and saves each successful page under
+// its ReplayKey so the run can be replayed later.
+type RecordingFetcher struct {
+	next Fetcher
+	dir  string
+	log  logrus.FieldLogger
+}
+
+func NewRecordingFetcher(next Fetcher, dir string, log logrus.FieldLogger) (*RecordingFetcher, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	return &RecordingFetcher{next: next, dir: dir, log: log}, nil
+}
+
+func (f *RecordingFetcher) Fetch(ctx context.Context, targetURL string) (string, error) {
+	body, err := f.next.Fetch(ctx, targetURL)
+	if err != nil {
+		return body, err
+	}
+
+	path := filepath.Join(f.dir, ReplayKey(targetURL))
+	if err := utils.SaveToFile(path, []byte(body)); err != nil {
+		f.log.Warnf("[Error] Failed to record %s: %v", targetURL, err)
+	}
+
+	return body, nil
+}
+
+func (f *RecordingFetcher) Reset() error {
+	return f.next.Reset()
+}
+
+func (f *RecordingFetcher) Close() {
+	f.next.Close()
+}
+
+var replayKeyUnsafe = regexp.MustCompile(`[^A-Za-z0-9._=-]+`)
+
+// ReplayKey maps a URL to the file name used by the replay and recording
+// fetchers, e.g. ".../FileAccess/viewHtml?e=3600001" -> "viewHtml_e=3600001.html".
+func ReplayKey(targetURL string) string {
+	name := targetURL
+	if u, err := url.Parse(targetURL); err == nil {
+		name = filepath.Base(u.Path)
+		if u.RawQuery != "" {
+			name += "_" + u.RawQuery
+		}
+	}
+
+	name = strings.Trim(replayKeyUnsafe.ReplaceAllString(name, "_"), "_")
+	if name == "" || name == "." {
+		name = "index"
+	}
+
+	return name + ".html"
+}
+
+// ErrChallenge is returned when a page turns out to be a Cloudflare challenge.
+var ErrChallenge = errors.New("[Error] cloudflare verification detected")
+
+// checkChallenge reports an error when the page is a Cloudflare challenge.
+func checkChallenge(log logrus.FieldLogger, body string) error {
+	if strings.Contains(strings.ToLower(body), "verify you are human") {
+		log.Warn("Cloudflare verification detected.")
+		return ErrChallenge
+	}
+	return nil
+}
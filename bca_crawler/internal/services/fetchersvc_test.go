@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"bca_crawler/internal/utils"
+)
+
+func TestHTTPFetcherSharedReset(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+		}
+		w.Write([]byte("<html>ok</html>"))
+	}))
+	defer srv.Close()
+
+	base, err := NewHTTPFetcher("test", srv.URL, 5*time.Second, utils.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetchers := []*HTTPFetcher{base, base.Share(), base.Share(), base.Share()}
+
+	// Every worker sees the same block and resets; only the first reset
+	// of a generation drops the session
+	for _, f := range fetchers {
+		if _, err := f.Fetch(context.Background(), srv.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range fetchers {
+		if err := f.Reset(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, gen := base.session.current(); gen != 1 {
+		t.Errorf("generation after one reset by each worker = %d, want 1", gen)
+	}
+
+	// Fetches and resets race freely; run with -race
+	var wg sync.WaitGroup
+	for _, f := range fetchers {
+		wg.Add(1)
+		go func(f *HTTPFetcher) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if _, err := f.Fetch(context.Background(), srv.URL); err != nil {
+					t.Error(err)
+					return
+				}
+				if i%5 == 4 {
+					if err := f.Reset(); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(f)
+	}
+	wg.Wait()
+}
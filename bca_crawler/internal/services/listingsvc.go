@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/retry"
+	"bca_crawler/internal/utils"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/sirupsen/logrus"
+)
+
+// ListingCategory is a Bursa announcement category filter. Code is the value
+// of the listing's cat parameter; Label is stored as the category of every
+// row found under it.
+type ListingCategory struct {
+	Code  string
+	Label string
+}
+
+// ParseListingCategories parses "CODE=Label,CODE=Label" as given on the
+// command line. A missing label leaves the category of the rows empty.
+func ParseListingCategories(s string) []ListingCategory {
+	var cats []ListingCategory
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, label, _ := strings.Cut(part, "=")
+		cats = append(cats, ListingCategory{Code: strings.TrimSpace(code), Label: strings.TrimSpace(label)})
+	}
+	return cats
+}
+
+// ListingQuery selects one slice of the announcement listing. Zero dates and
+// an empty company leave that filter off.
+type ListingQuery struct {
+	From     time.Time
+	To       time.Time
+	Category ListingCategory
+	Company  string
+}
+
+// ListingURL returns the listing page for q. Bursa takes dates as dd/mm/yyyy
+// in dt_ht (from) and dt_lt (to).
+func ListingURL(base string, q ListingQuery, page int) string {
+	v := url.Values{}
+	v.Set("cat", q.Category.Code)
+	v.Set("company", q.Company)
+	v.Set("dt_ht", listingDate(q.From))
+	v.Set("dt_lt", listingDate(q.To))
+	v.Set("page", strconv.Itoa(page))
+
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + v.Encode()
+}
+
+func listingDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("02/01/2006")
+}
+
+// ParseListingRows extracts the announcements shown on one listing page.
+func ParseListingRows(body string, cfg *utils.Config) ([]*models.Announcement, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("[Error] goquery parse error: %w", err)
+	}
+
+	var rows []*models.Announcement
+	doc.Find("table tbody tr").Each(func(_ int, tr *goquery.Selection) {
+		ann := &models.Announcement{}
+
+		tr.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+			href, _ := a.Attr("href")
+			u, err := url.Parse(href)
+			if err != nil {
+				return
+			}
+
+			if id, err := strconv.Atoi(u.Query().Get("ann_id")); err == nil && id > 0 {
+				ann.AnnID = id
+				ann.Title = utils.CleanString(a.Text())
+			} else if u.Query().Get("stock_code") != "" {
+				ann.CompanyName = utils.CleanString(a.Text())
+			}
+		})
+		if ann.AnnID == 0 {
+			return
+		}
+
+		tr.Find("td").EachWithBreak(func(_ int, td *goquery.Selection) bool {
+			// Dates may be followed by the time on the next line
+			text := strings.TrimSpace(td.Text())
+			if i := strings.IndexAny(text, "\n\r"); i > 0 {
+				text = text[:i]
+			}
+			if t := utils.ParseDate(text); t != nil {
+				ann.DatePosted = *t
+				return false
+			}
+			return true
+		})
+
+		ann.Link = cfg.DetailDomain + cfg.DetailURL + strconv.Itoa(ann.AnnID)
+		rows = append(rows, ann)
+	})
+
+	return rows, nil
+}
+
+// CrawlListing pages through the listing for q from startPage until a page
+// shows nothing new or maxPages pages were read, handing each page's rows to
+// save with the page number. It returns the number of rows found and whether
+// the end of the listing was reached.
+func CrawlListing(ctx context.Context, log logrus.FieldLogger, f Fetcher, cfg *utils.Config, q ListingQuery, startPage, maxPages int, save func(page int, rows []*models.Announcement) error) (int, bool, error) {
+	seen := make(map[int]bool)
+	total := 0
+
+	startPage = max(startPage, 1)
+	for page := startPage; maxPages <= 0 || page < startPage+maxPages; page++ {
+		pageURL := ListingURL(cfg.StartURL, q, page)
+
+		policy := retry.NewPolicy(cfg)
+		policy.Log = log
+		html, outcome, err := policy.Do(ctx, fmt.Sprintf("listing page %d", page), func() (string, error) {
+			return f.Fetch(ctx, pageURL)
+		})
+		if err != nil {
+			return total, false, err
+		}
+		if outcome.Class != retry.OK {
+			return total, false, fmt.Errorf("[Error] listing page rejected: %s", outcome.Reason)
+		}
+
+		rows, err := ParseListingRows(html, cfg)
+		if err != nil {
+			return total, false, err
+		}
+
+		var fresh []*models.Announcement
+		for _, row := range rows {
+			if seen[row.AnnID] {
+				continue
+			}
+			seen[row.AnnID] = true
+			row.Category = q.Category.Label
+			fresh = append(fresh, row)
+		}
+
+		// Past the last page Bursa repeats the last page or shows none
+		if len(fresh) == 0 {
+			return total, true, nil
+		}
+
+		if err := save(page, fresh); err != nil {
+			return total, false, err
+		}
+
+		total += len(fresh)
+		log.Infof("Listing page %d: %d announcements", page, len(fresh))
+	}
+
+	return total, false, nil
+}
@@ -60,7 +60,12 @@ func GetMaxAnnID(body string) int {
 }
 
 func ParseAnnouncementHTML(ann *models.Announcement) error {
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(ann.Content))
+	content, err := AnnouncementContent(ann)
+	if err != nil {
+		return err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
 	if err != nil {
 		return fmt.Errorf("[Error] parse announcement info HTML: %w", err)
 	}
@@ -96,7 +101,7 @@ func ParseAnnouncementHTML(ann *models.Announcement) error {
 	// --------------------------------------------
 	// 1. Extract Announcement Info section
 	// --------------------------------------------
-	section, err := extractAnnouncementInfoHTML(ann.Content)
+	section, err := extractAnnouncementInfoHTML(content)
 	if err != nil {
 		return fmt.Errorf("[Error] announcement info section not found")
 	}
@@ -170,7 +175,12 @@ func extractAnnouncementInfoHTML(html string) (string, error) {
 }
 
 func ParseBoardroomChangeHTML(ann *models.Announcement) (*models.BoardroomChange, error) {
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(ann.Content))
+	content, err := AnnouncementContent(ann)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
 	if err != nil {
 		return nil, fmt.Errorf("[Error] parse HTML: %w", err)
 	}
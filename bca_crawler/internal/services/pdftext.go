@@ -0,0 +1,76 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ExtractPDFText returns the text of each page of the PDF at path, one line
+// per line of text on the page. A page without text, such as a scanned image,
+// comes back empty.
+func ExtractPDFText(path string) (pages []string, err error) {
+	// The reader panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			pages, err = nil, fmt.Errorf("read pdf %s: %v", path, r)
+		}
+	}()
+
+	f, r, err := pdf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open pdf %s: %w", path, err)
+	}
+	defer f.Close()
+
+	n := r.NumPage()
+	pages = make([]string, n)
+	for i := 1; i <= n; i++ {
+		p := r.Page(i)
+		if p.V.IsNull() {
+			continue
+		}
+		pages[i-1] = cleanPDFText(pageText(p.Content().Text))
+	}
+	return pages, nil
+}
+
+// pageText joins the glyphs of a page in content stream order, which is the
+// reading order of most generated PDFs. A move down starts a
+// new line and a gap on the line becomes a space.
+func pageText(glyphs []pdf.Text) string {
+	var b strings.Builder
+	var prev *pdf.Text
+	for i := range glyphs {
+		g := &glyphs[i]
+		if prev != nil {
+			size := max(prev.FontSize, 1)
+			switch {
+			case math.Abs(g.Y-prev.Y) > size/2:
+				b.WriteByte('\n')
+			case g.X-(prev.X+prev.W) > size/4 && !strings.HasSuffix(prev.S, " ") && g.S != " ":
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(g.S)
+		prev = g
+	}
+
+	lines := strings.Split(b.String(), "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// cleanPDFText drops what PostgreSQL refuses in a TEXT column: NUL bytes and
+// invalid UTF-8, which broken font encodings produce.
+func cleanPDFText(s string) string {
+	s = strings.ReplaceAll(s, "\x00", "")
+	return strings.ToValidUTF8(s, "")
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"bca_crawler/internal/metrics"
 	"bca_crawler/internal/models"
 	"bca_crawler/internal/utils"
 
@@ -293,6 +294,24 @@ const (
 	TypeNoticeCeasing
 )
 
+func (t AnnouncementType) String() string {
+	switch t {
+	case TypeDirector135:
+		return "director_135"
+	case TypeDirector219:
+		return "director_219"
+	case TypeChangesInSub138:
+		return "changes_in_sub_138"
+	case TypeChangesInSub29B:
+		return "changes_in_sub_29b"
+	case TypeNoticeInterest:
+		return "notice_interest"
+	case TypeNoticeCeasing:
+		return "notice_ceasing"
+	}
+	return "unknown"
+}
+
 func detectAnnouncementType(doc *goquery.Document) AnnouncementType {
 
 	title := strings.ToLower(strings.TrimSpace(doc.Find("h3").First().Text()))
@@ -322,12 +341,24 @@ func detectAnnouncementType(doc *goquery.Document) AnnouncementType {
 }
 
 func ParseShareholdingChange(ann *models.Announcement) ([]*models.ShareholdingChange, error) {
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(ann.Content))
+	content, err := AnnouncementContent(ann)
 	if err != nil {
 		return nil, err
 	}
 
-	switch detectAnnouncementType(doc) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	typ := detectAnnouncementType(doc)
+	changes, err := parseShareholdingByType(typ, doc, ann)
+	metrics.ParseResult(typ.String(), err)
+	return changes, err
+}
+
+func parseShareholdingByType(typ AnnouncementType, doc *goquery.Document, ann *models.Announcement) ([]*models.ShareholdingChange, error) {
+	switch typ {
 
 	case TypeDirector135:
 		return parseDirectorChange135(doc, ann)
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"bca_crawler/internal/utils"
+)
+
+const (
+	stubListingPath = "/market_information/announcements/company_announcement"
+	stubDetailPath  = "/FileAccess/viewHtml"
+)
+
+// AnnouncementStub is a local stand-in for the Bursa listing and detail pages,
+// used to measure crawler throughput and ordering without hitting Bursa.
+type AnnouncementStub struct {
+	*httptest.Server
+
+	maxID   int
+	latency time.Duration
+	missing map[int]bool
+	hits    atomic.Int64
+}
+
+// NewAnnouncementStub starts a stub serving ann_ids 1..maxID. Each detail
+// request sleeps for up to latency; ids in missing get Bursa's not-found page.
+func NewAnnouncementStub(maxID int, latency time.Duration, missing []int) *AnnouncementStub {
+	s := &AnnouncementStub{
+		maxID:   maxID,
+		latency: latency,
+		missing: make(map[int]bool, len(missing)),
+	}
+	for _, id := range missing {
+		s.missing[id] = true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(stubListingPath, s.serveListing)
+	mux.HandleFunc(stubDetailPath, s.serveDetail)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Config returns a copy of base pointed at the stub with the http fetcher.
+func (s *AnnouncementStub) Config(base *utils.Config) *utils.Config {
+	cfg := *base
+	cfg.StartURL = s.URL + stubListingPath
+	cfg.DetailDomain = s.URL
+	cfg.DetailURL = stubDetailPath + "?e="
+	cfg.Fetcher = "http"
+	return &cfg
+}
+
+// Hits returns the number of detail pages served so far.
+func (s *AnnouncementStub) Hits() int64 {
+	return s.hits.Load()
+}
+
+func (s *AnnouncementStub) serveListing(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	b.WriteString("<html><body><h1>Company Announcements</h1><table><tbody>\n")
+	for id := s.maxID; id > 0 && id > s.maxID-20; id-- {
+		fmt.Fprintf(&b, `<tr><td>%d</td><td><a href="%s/announcement_details?ann_id=%d">Announcement %d</a></td></tr>`+"\n",
+			s.maxID-id+1, stubListingPath, id, id)
+	}
+	b.WriteString("</tbody></table></body></html>")
+
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, b.String())
+}
+
+func (s *AnnouncementStub) serveDetail(w http.ResponseWriter, r *http.Request) {
+	s.hits.Add(1)
+	if s.latency > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(s.latency))))
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("e"))
+	w.Header().Set("Content-Type", "text/html")
+	if err != nil || id < 1 || id > s.maxID || s.missing[id] {
+		fmt.Fprint(w, "<html><body><p>HTML file is not found</p></body></html>")
+		return
+	}
+
+	fmt.Fprintf(w, `<html><body>
+<h3>Stub Announcement %d</h3>
+<div class="ven_announcement_info">
+	<table>
+		<tr><td>Company Name</td><td>STUB BERHAD</td></tr>
+		<tr><td>Stock Name</td><td>STUB</td></tr>
+		<tr><td>Date Announced</td><td>%s</td></tr>
+		<tr><td>Category</td><td>General Announcement for PLC</td></tr>
+		<tr><td>Reference Number</td><td>GA1-STUB-%06d</td></tr>
+	</table>
+</div>
+</body></html>`, id, time.Now().Format("02 Jan 2006"), id)
+}
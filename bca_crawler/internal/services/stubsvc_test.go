@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"bca_crawler/internal/models"
+	"bca_crawler/internal/utils"
+)
+
+func TestCrawlAnnouncementsStub(t *testing.T) {
+	const maxID = 150
+	missing := []int{17, 34, 51, 68, 85, 102, 119, 136}
+
+	stub := NewAnnouncementStub(maxID, 5*time.Millisecond, missing)
+	defer stub.Close()
+
+	for _, concurrency := range []int{1, 4, 16} {
+		cfg := stub.Config(&utils.Config{
+			UserAgent:        "bca-crawler-test",
+			Concurrency:      concurrency,
+			HTTPTimeout:      5 * time.Second,
+			RetryMaxAttempts: 1,
+		})
+
+		fetchers, err := NewFetchers(cfg, utils.Logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := make([]int, 0, maxID)
+		for id := 1; id <= maxID; id++ {
+			ids = append(ids, id)
+		}
+
+		store := &memCrawlStore{}
+		done := make(chan int)
+		go func() {
+			saved, err := CrawlAnnouncements(context.Background(), utils.Logger, fetchers, cfg, ids, store)
+			if err != nil {
+				t.Errorf("concurrency %d: CrawlAnnouncements = %v", concurrency, err)
+			}
+			done <- saved
+		}()
+
+		var saved int
+		select {
+		case saved = <-done:
+		case <-time.After(30 * time.Second):
+			t.Fatalf("concurrency %d: crawl did not finish", concurrency)
+		}
+		CloseFetchers(fetchers)
+
+		if want := maxID - len(missing); saved != want {
+			t.Errorf("concurrency %d: saved = %d, want %d", concurrency, saved, want)
+		}
+		if len(store.attempts) != maxID {
+			t.Fatalf("concurrency %d: got %d ledger rows, want %d", concurrency, len(store.attempts), maxID)
+		}
+
+		notFound := make(map[int]bool)
+		for _, id := range missing {
+			notFound[id] = true
+		}
+		for i, a := range store.attempts {
+			if a.AnnID != ids[i] {
+				t.Fatalf("concurrency %d: ledger row %d is ID %d, want %d", concurrency, i, a.AnnID, ids[i])
+			}
+			want := models.CrawlStatusSaved
+			if notFound[a.AnnID] {
+				want = models.CrawlStatusNotFound
+			}
+			if a.Status != want {
+				t.Errorf("concurrency %d: ID %d status = %s, want %s", concurrency, a.AnnID, a.Status, want)
+			}
+		}
+		for i := 1; i < len(store.saved); i++ {
+			if store.saved[i].AnnID <= store.saved[i-1].AnnID {
+				t.Errorf("concurrency %d: ID %d saved after %d", concurrency, store.saved[i].AnnID, store.saved[i-1].AnnID)
+			}
+		}
+	}
+
+	if hits := stub.Hits(); hits != 3*maxID {
+		t.Errorf("stub served %d detail pages, want %d", hits, 3*maxID)
+	}
+}
+
+func TestCrawlAnnouncementsDeadline(t *testing.T) {
+	stub := NewAnnouncementStub(100, 50*time.Millisecond, nil)
+	defer stub.Close()
+
+	cfg := stub.Config(&utils.Config{
+		UserAgent:        "bca-crawler-test",
+		Concurrency:      4,
+		HTTPTimeout:      5 * time.Second,
+		RetryMaxAttempts: 1,
+	})
+	fetchers, err := NewFetchers(cfg, utils.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseFetchers(fetchers)
+
+	ids := make([]int, 0, 100)
+	for id := 1; id <= 100; id++ {
+		ids = append(ids, id)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// A deadline stops the crawl like a cancel: the ledger holds a prefix of
+	// ids and no ID is recorded as failed.
+	store := &memCrawlStore{}
+	if _, err := CrawlAnnouncements(ctx, utils.Logger, fetchers, cfg, ids, store); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CrawlAnnouncements = %v, want context.DeadlineExceeded", err)
+	}
+
+	if len(store.attempts) == len(ids) {
+		t.Fatalf("every ID was recorded before the deadline")
+	}
+	for i, a := range store.attempts {
+		if a.AnnID != ids[i] {
+			t.Fatalf("ledger row %d is ID %d, want %d", i, a.AnnID, ids[i])
+		}
+		if a.Status != models.CrawlStatusSaved {
+			t.Errorf("ID %d status = %s, want %s", a.AnnID, a.Status, models.CrawlStatusSaved)
+		}
+	}
+}
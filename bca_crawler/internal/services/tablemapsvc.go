@@ -0,0 +1,218 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+)
+
+// ErrUnknownTable is returned for attachments without a table the mappers
+// recognise, or whose recognised tables have no rows they could map.
+var ErrUnknownTable = errors.New("[Error] no table of a known type")
+
+type TableType int
+
+const (
+	TableUnknown TableType = iota
+	TableShareBuyBack
+	TableDealing
+	TableMarketStats
+)
+
+func (t TableType) String() string {
+	switch t {
+	case TableShareBuyBack:
+		return "table_share_buy_back"
+	case TableDealing:
+		return "table_dealing"
+	case TableMarketStats:
+		return "table_market_stats"
+	}
+	return "table_unknown"
+}
+
+// DetectTableType picks the mapper for a table from the announcement
+// category, or from its header for files without one such as the
+// /misc/missftp market statistics.
+func DetectTableType(category string, t *Table) TableType {
+	category = strings.ToLower(category)
+
+	switch {
+	case strings.Contains(category, "buy back"), strings.Contains(category, "buy-back"):
+		return TableShareBuyBack
+
+	case strings.Contains(category, "dealing"):
+		return TableDealing
+
+	case t.Column("buy_back") >= 0 || t.Column("shares", "purchased") >= 0:
+		return TableShareBuyBack
+
+	case t.Column("nature") >= 0 && t.Column("name") >= 0:
+		return TableDealing
+
+	case t.Column("volume") >= 0 && (t.Column("stock") >= 0 || t.Column("code") >= 0):
+		return TableMarketStats
+	}
+
+	return TableUnknown
+}
+
+// ParseTableAttachment reads the tables of the spreadsheet or CSV attachment
+// at path and maps the rows of each one it recognises. Tables of an unknown
+// type, or without a row the mapper could read, count as parse failures and
+// are skipped; when no table is left it returns ErrUnknownTable.
+func ParseTableAttachment(path, category string) (*models.TableRecords, error) {
+	tables, err := ReadTables(path)
+	if err != nil {
+		return nil, err
+	}
+
+	records := &models.TableRecords{}
+	mapped := 0
+	for _, t := range tables {
+		typ := DetectTableType(category, t)
+
+		var err error
+		switch n := mapTableByType(typ, t, records); {
+		case typ == TableUnknown:
+			err = fmt.Errorf("%w: sheet %s", ErrUnknownTable, t.Sheet)
+		case n == 0:
+			err = fmt.Errorf("%w: no %s rows in sheet %s", ErrUnknownTable, typ, t.Sheet)
+		default:
+			mapped++
+		}
+		metrics.ParseResult(typ.String(), err)
+	}
+
+	if mapped == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTable, filepath.Base(path))
+	}
+	return records, nil
+}
+
+// mapTableByType appends the rows of t mapped as typ to records and returns
+// how many there were.
+func mapTableByType(typ TableType, t *Table, records *models.TableRecords) int {
+	switch typ {
+
+	case TableShareBuyBack:
+		rows := mapShareBuyBacks(t)
+		records.BuyBacks = append(records.BuyBacks, rows...)
+		return len(rows)
+
+	case TableDealing:
+		rows := mapDealings(t)
+		records.Dealings = append(records.Dealings, rows...)
+		return len(rows)
+
+	case TableMarketStats:
+		rows := mapMarketStats(t)
+		records.MarketStats = append(records.MarketStats, rows...)
+		return len(rows)
+	}
+	return 0
+}
+
+func mapShareBuyBacks(t *Table) []*models.ShareBuyBack {
+	var (
+		date          = t.Column("date")
+		description   = t.Column("description")
+		purchased     = t.Column("total", "shares", "purchased")
+		minimum       = t.Column("minimum", "price")
+		maximum       = t.Column("maximum", "price")
+		consideration = t.Column("consideration")
+		retained      = t.Column("treasury")
+		cancelled     = t.Column("cancelled")
+	)
+	if purchased < 0 {
+		purchased = t.Column("number", "shares")
+	}
+	if purchased == retained {
+		// Only the treasury column names the shares purchased
+		purchased = -1
+	}
+
+	var results []*models.ShareBuyBack
+	for _, row := range t.Rows {
+		b := &models.ShareBuyBack{
+			TableSource:        tableSource(t, row),
+			DateOfBuyBack:      row.Date(date),
+			Description:        row.Text(description),
+			SharesPurchased:    row.Int64(purchased),
+			MinimumPrice:       row.Float(minimum),
+			MaximumPrice:       row.Float(maximum),
+			TotalConsideration: row.Float(consideration),
+			SharesRetained:     row.Int64(retained),
+			SharesCancelled:    row.Int64(cancelled),
+		}
+
+		// Total lines carry no date
+		if b.DateOfBuyBack == nil || b.SharesPurchased == nil {
+			continue
+		}
+		results = append(results, b)
+	}
+	return results
+}
+
+func mapDealings(t *Table) []*models.Dealing {
+	var (
+		name   = t.Column("name")
+		date   = t.Column("date")
+		nature = t.Column("nature")
+		shares = t.Column("shares")
+		price  = t.Column("price")
+	)
+
+	var results []*models.Dealing
+	for _, row := range t.Rows {
+		d := &models.Dealing{
+			TableSource:   tableSource(t, row),
+			Name:          row.Text(name),
+			DateOfDealing: row.Date(date),
+			Nature:        row.Text(nature),
+			Shares:        row.Int64(shares),
+			Price:         row.Float(price),
+		}
+		if d.Name == "" || d.Shares == nil {
+			continue
+		}
+		results = append(results, d)
+	}
+	return results
+}
+
+func mapMarketStats(t *Table) []*models.MarketStat {
+	var (
+		date      = t.Column("date")
+		stockCode = t.Column("code")
+		stockName = t.Column("name")
+		volume    = t.Column("volume")
+		value     = t.Column("value")
+	)
+
+	var results []*models.MarketStat
+	for _, row := range t.Rows {
+		s := &models.MarketStat{
+			TableSource: tableSource(t, row),
+			Date:        row.Date(date),
+			StockCode:   row.Text(stockCode),
+			StockName:   row.Text(stockName),
+			Volume:      row.Int64(volume),
+			Value:       row.Float(value),
+		}
+		if s.StockCode == "" && s.StockName == "" {
+			continue
+		}
+		results = append(results, s)
+	}
+	return results
+}
+
+func tableSource(t *Table, row TableRow) models.TableSource {
+	return models.TableSource{Sheet: t.Sheet, Line: row.Line}
+}
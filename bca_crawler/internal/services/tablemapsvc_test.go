@@ -0,0 +1,261 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"bca_crawler/internal/metrics"
+	"bca_crawler/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func tableFixture(name string) string {
+	return filepath.Join("testdata", "tables", name)
+}
+
+func TestReadTablesHeader(t *testing.T) {
+	tests := []struct {
+		file      string
+		sheet     string
+		headerRow int
+		header    []string
+		rows      int
+	}{
+		{
+			// Semicolon separated, under a title line
+			"dealing.csv", "dealing", 2,
+			[]string{"name", "designation", "date_of_dealing", "nature_of_dealing", "no_of_shares", "price_rm"},
+			2,
+		},
+		{
+			// A byte order mark, title and company lines and a blank line
+			// above the header; the total line is kept as a row
+			"share_buy_back.csv", "share_buy_back", 3,
+			[]string{
+				"date_of_buy_back", "description_of_shares_purchased", "total_number_of_shares_purchased_units",
+				"minimum_price_paid_for_each_share_purchased_rm", "maximum_price_paid_for_each_share_purchased_rm",
+				"total_consideration_paid_rm", "number_of_shares_purchased_retained_in_treasury_units",
+				"number_of_shares_purchased_which_are_proposed_to_be_cancelled_units",
+			},
+			3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			tables, err := ReadTables(tableFixture(tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tables) != 1 {
+				t.Fatalf("got %d tables, want 1", len(tables))
+			}
+			tbl := tables[0]
+			if tbl.Sheet != tt.sheet || tbl.HeaderRow != tt.headerRow {
+				t.Errorf("sheet %q header row %d, want %q row %d", tbl.Sheet, tbl.HeaderRow, tt.sheet, tt.headerRow)
+			}
+			if len(tbl.Header) != len(tt.header) {
+				t.Fatalf("header = %q, want %q", tbl.Header, tt.header)
+			}
+			for i := range tt.header {
+				if tbl.Header[i] != tt.header[i] {
+					t.Errorf("header column %d = %q, want %q", i, tbl.Header[i], tt.header[i])
+				}
+			}
+			if len(tbl.Rows) != tt.rows {
+				t.Errorf("got %d rows, want %d", len(tbl.Rows), tt.rows)
+			}
+		})
+	}
+
+	tables, err := ReadTables(tableFixture("market_stats.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 || tables[0].Sheet != "Statistics" {
+		t.Fatalf("market_stats.xlsx tables = %+v, want the Statistics sheet", tables)
+	}
+	if tables[0].Column("volume") < 0 || tables[0].Column("code") < 0 {
+		t.Errorf("market_stats.xlsx header = %q", tables[0].Header)
+	}
+
+	if _, err := ReadTables("report.xls"); !errors.Is(err, ErrTableFormat) {
+		t.Errorf("ReadTables(.xls) = %v, want ErrTableFormat", err)
+	}
+}
+
+func TestDetectTableType(t *testing.T) {
+	dealing := &Table{Header: []string{"name", "designation", "date_of_dealing", "nature_of_dealing", "no_of_shares"}}
+	buyBack := &Table{Header: []string{"date_of_buy_back", "total_number_of_shares_purchased"}}
+	stats := &Table{Header: []string{"date", "stock_code", "stock_name", "volume", "value"}}
+	other := &Table{Header: []string{"item", "description", "amount"}}
+
+	tests := []struct {
+		category string
+		table    *Table
+		want     TableType
+	}{
+		// The announcement category decides over the header
+		{"Share Buy Back", other, TableShareBuyBack},
+		{"Immediate Announcement on Share Buy-Back", other, TableShareBuyBack},
+		{"Dealings in Listed Securities (Chapter 14 of Listing Requirements)", stats, TableDealing},
+		// Without one the header does
+		{"", buyBack, TableShareBuyBack},
+		{"", dealing, TableDealing},
+		{"", stats, TableMarketStats},
+		{"General Announcement", stats, TableMarketStats},
+		{"", other, TableUnknown},
+		{"General Announcement", other, TableUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := DetectTableType(tt.category, tt.table); got != tt.want {
+			t.Errorf("DetectTableType(%q, %q) = %s, want %s", tt.category, tt.table.Header, got, tt.want)
+		}
+	}
+}
+
+func tableDate(s string) *time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return &t
+}
+
+func TestParseTableAttachment(t *testing.T) {
+	records, err := ParseTableAttachment(tableFixture("share_buy_back.csv"), "Share Buy Back")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBuyBacks := []struct {
+		line                int
+		date                *time.Time
+		purchased           int64
+		minimum, consider   float64
+		retained, cancelled *int64
+	}{
+		{4, tableDate("2025-01-02"), 100000, 1.23, 124500, ptrInt64(100000), nil},
+		{5, tableDate("2025-01-03"), 50000, 1.24, 62750, nil, ptrInt64(50000)},
+	}
+	// The total line has no date and is left out
+	if len(records.BuyBacks) != len(wantBuyBacks) {
+		t.Fatalf("got %d buy backs, want %d", len(records.BuyBacks), len(wantBuyBacks))
+	}
+	for i, want := range wantBuyBacks {
+		b := records.BuyBacks[i]
+		if b.Line != want.line || !b.DateOfBuyBack.Equal(*want.date) || *b.SharesPurchased != want.purchased ||
+			*b.MinimumPrice != want.minimum || *b.TotalConsideration != want.consider ||
+			!equalInt64(b.SharesRetained, want.retained) || !equalInt64(b.SharesCancelled, want.cancelled) {
+			t.Errorf("buy back %d = %+v", i, b)
+		}
+	}
+
+	records, err = ParseTableAttachment(tableFixture("dealing.csv"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDealings := []models.Dealing{
+		{TableSource: models.TableSource{Sheet: "dealing", Line: 3}, Name: "Tan Sri Ali bin Abu", DateOfDealing: tableDate("2025-01-02"),
+			Nature: "Acquired", Shares: ptrInt64(1000000), Price: ptrFloat64(0.85)},
+		// An accounting negative
+		{TableSource: models.TableSource{Sheet: "dealing", Line: 4}, Name: "Lee Mei Ling", DateOfDealing: tableDate("2025-01-06"),
+			Nature: "Disposed", Shares: ptrInt64(-20000), Price: ptrFloat64(0.9)},
+	}
+	if len(records.Dealings) != len(wantDealings) || len(records.BuyBacks) != 0 {
+		t.Fatalf("got %d dealings and %d buy backs, want %d dealings", len(records.Dealings), len(records.BuyBacks), len(wantDealings))
+	}
+	for i, want := range wantDealings {
+		d := records.Dealings[i]
+		if d.TableSource != want.TableSource || d.Name != want.Name || !d.DateOfDealing.Equal(*want.DateOfDealing) ||
+			d.Nature != want.Nature || *d.Shares != *want.Shares || *d.Price != *want.Price {
+			t.Errorf("dealing %d = %+v, want %+v", i, d, want)
+		}
+	}
+
+	// Dates come as Excel serial numbers
+	records, err = ParseTableAttachment(tableFixture("market_stats.xlsx"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStats := []struct {
+		line   int
+		code   string
+		name   string
+		volume int64
+		value  float64
+	}{
+		{4, "1155", "MAYBANK", 1234567, 12345678.9},
+		{5, "5347", "TENAGA", 890123, 11833100.5},
+		{7, "0166", "INARI", 45000, 1575000},
+	}
+	if len(records.MarketStats) != len(wantStats) {
+		t.Fatalf("got %d market stats, want %d", len(records.MarketStats), len(wantStats))
+	}
+	for i, want := range wantStats {
+		s := records.MarketStats[i]
+		if s.Sheet != "Statistics" || s.Line != want.line || s.StockCode != want.code || s.StockName != want.name ||
+			!s.Date.Equal(*tableDate("2025-01-15")) || *s.Volume != want.volume || *s.Value != want.value {
+			t.Errorf("market stat %d = %+v", i, s)
+		}
+	}
+}
+
+func TestParseTableAttachmentUnknown(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	failures := func(typ TableType) float64 {
+		return testutil.ToFloat64(metrics.ParseResults.WithLabelValues(typ.String(), "failure"))
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		category string
+		typ      TableType
+	}{
+		{"unknown header", write("fees.csv", "Item,Description,Amount\nAudit,Annual audit,\"120,000\"\n"), "", TableUnknown},
+		// A dealing table by category whose rows have no name or shares
+		{"unmapped rows", write("notes.csv", "Note,Remarks\nSee page 2,Closed period\n"), "Dealings in Listed Securities", TableDealing},
+		{"no header", write("empty.csv", "1,2\n3,4\n"), "", TableUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := failures(tt.typ)
+			records, err := ParseTableAttachment(tt.path, tt.category)
+			if !errors.Is(err, ErrUnknownTable) {
+				t.Errorf("ParseTableAttachment = %+v, %v, want ErrUnknownTable", records, err)
+			}
+			// A file without a header has no table to count
+			want := before + 1
+			if tt.name == "no header" {
+				want = before
+			}
+			if got := failures(tt.typ); got != want {
+				t.Errorf("%s failures = %v, want %v", tt.typ, got, want)
+			}
+		})
+	}
+}
+
+func ptrInt64(n int64) *int64 { return &n }
+
+func ptrFloat64(f float64) *float64 { return &f }
+
+func equalInt64(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"bca_crawler/internal/utils"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ErrTableFormat is returned for attachments ReadTables cannot read, such as
+// the binary .xls format.
+var ErrTableFormat = errors.New("[Error] unsupported spreadsheet format")
+
+// headerScan is how many rows from the top of a sheet may hold the header;
+// the rows above it are titles and notes.
+const headerScan = 20
+
+var headerWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Table is one sheet of a spreadsheet or CSV attachment. Header holds the
+// column names lower-cased with every run of other characters turned into
+// "_", e.g. "No. of Shares" becomes "no_of_shares".
+type Table struct {
+	Sheet     string
+	Header    []string
+	HeaderRow int
+	Rows      []TableRow
+}
+
+// TableRow is one data row below the header. Line is its 1-based row number
+// in the sheet, or record number in a CSV file, for pointing back at the
+// source.
+type TableRow struct {
+	Line  int
+	Cells []string
+}
+
+// ReadTables reads every sheet of the .xlsx or .csv file at path that has a
+// header row. Cells are read unformatted, so numbers keep their full
+// precision and dates come as Excel serial numbers, which TableRow.Date
+// understands.
+func ReadTables(path string) ([]*Table, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xlsx", ".xlsm":
+		return readXLSX(path)
+	case ".csv", ".txt":
+		return readCSV(path)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTableFormat, filepath.Base(path))
+}
+
+func readXLSX(path string) ([]*Table, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var tables []*Table
+	for _, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, fmt.Errorf("read sheet %s of %s: %w", sheet, path, err)
+		}
+		if t := newTable(sheet, rows); t != nil {
+			tables = append(tables, t)
+		}
+	}
+	return tables, nil
+}
+
+func readCSV(path string) ([]*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = sniffDelimiter(data)
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+
+	var rows [][]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		rows = append(rows, row)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if t := newTable(name, rows); t != nil {
+		return []*Table{t}, nil
+	}
+	return nil, nil
+}
+
+// sniffDelimiter picks whichever of comma, semicolon and tab is most frequent
+// on the busiest of the first lines, which is usually the header.
+func sniffDelimiter(data []byte) rune {
+	best, count := ',', 0
+	for i, line := range bytes.SplitN(data, []byte("\n"), headerScan+1) {
+		if i == headerScan {
+			break
+		}
+		for _, d := range []rune{',', ';', '\t'} {
+			if n := bytes.Count(line, []byte(string(d))); n > count {
+				best, count = d, n
+			}
+		}
+	}
+	return best
+}
+
+// newTable finds the header of rows and returns the rows below it, or nil
+// when the sheet has no header.
+func newTable(sheet string, rows [][]string) *Table {
+	h := findHeader(rows)
+	if h < 0 {
+		return nil
+	}
+
+	t := &Table{Sheet: sheet, HeaderRow: h + 1, Header: normalizeHeader(rows[h])}
+	for i := h + 1; i < len(rows); i++ {
+		cells := make([]string, len(t.Header))
+		empty := true
+		for j := range cells {
+			if j < len(rows[i]) {
+				cells[j] = strings.TrimSpace(strings.ReplaceAll(rows[i][j], "\u00a0", " "))
+			}
+			if cells[j] != "" {
+				empty = false
+			}
+		}
+		if empty || slicesEqualFold(normalizeHeader(cells), t.Header) {
+			// Blank rows, and the header repeated on a printed page break
+			continue
+		}
+		t.Rows = append(t.Rows, TableRow{Line: i + 1, Cells: cells})
+	}
+	return t
+}
+
+// findHeader returns the index of the header row: among the first rows, the
+// one with the most text cells, needing at least two. Titles above the table
+// have fewer; data rows are mostly numbers and dates.
+func findHeader(rows [][]string) int {
+	best, bestText := -1, 1
+	for i, row := range rows[:min(len(rows), headerScan)] {
+		text, filled := 0, 0
+		for _, c := range row {
+			c = strings.TrimSpace(c)
+			if c == "" {
+				continue
+			}
+			filled++
+			if !isValueCell(c) {
+				text++
+			}
+		}
+		if text > bestText && text*2 >= filled {
+			best, bestText = i, text
+		}
+	}
+	return best
+}
+
+// isValueCell reports whether c holds a number or a date rather than text.
+func isValueCell(c string) bool {
+	return parseTableFloat(c) != nil || utils.ParseDate(c) != nil
+}
+
+// normalizeHeader names each column, see Table. Unnamed columns are called
+// col_<n> and a repeated name gets a _2, _3... suffix.
+func normalizeHeader(row []string) []string {
+	header := make([]string, len(row))
+	seen := make(map[string]int)
+	for i, c := range row {
+		name := strings.Trim(headerWord.ReplaceAllString(strings.ToLower(c), "_"), "_")
+		if name == "" {
+			name = fmt.Sprintf("col_%d", i+1)
+		}
+		if seen[name]++; seen[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, seen[name])
+		}
+		header[i] = name
+	}
+	return header
+}
+
+func slicesEqualFold(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Column returns the index of the first column whose name contains every
+// word, or -1 when there is none. Mappers look columns up this way as the
+// wording of headers varies between companies.
+func (t *Table) Column(words ...string) int {
+	for i, name := range t.Header {
+		match := true
+		for _, w := range words {
+			if !strings.Contains(name, w) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// Text returns the cell in column col, or "" when col is -1.
+func (r TableRow) Text(col int) string {
+	if col < 0 || col >= len(r.Cells) {
+		return ""
+	}
+	return r.Cells[col]
+}
+
+// Int64 returns the cell in column col as a whole number, accepting
+// thousands separators and a zero fraction such as "1,000.00".
+func (r TableRow) Int64(col int) *int64 {
+	s := r.Text(col)
+	if n := utils.ParseInt64(s); n != nil {
+		return n
+	}
+	if f := parseTableFloat(s); f != nil && *f == float64(int64(*f)) {
+		n := int64(*f)
+		return &n
+	}
+	return nil
+}
+
+// Float returns the cell in column col as a number. A trailing % is dropped,
+// so "25.10%" reads as 25.1, and accounting negatives such as "(1,200)" come
+// back negative.
+func (r TableRow) Float(col int) *float64 {
+	return parseTableFloat(r.Text(col))
+}
+
+// Date returns the cell in column col as a date, read as text or as the
+// Excel serial number of an unformatted date cell.
+func (r TableRow) Date(col int) *time.Time {
+	s := r.Text(col)
+	if t := utils.ParseDate(s); t != nil {
+		return t
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05", "2 January 2006", "2-Jan-2006", "02-Jan-06"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t
+		}
+	}
+
+	// Serials from 1 (1900-01-01) to 2958465 (9999-12-31)
+	if serial, err := strconv.ParseFloat(s, 64); err == nil && serial >= 1 && serial <= 2958465 {
+		if t, err := excelize.ExcelDateToTime(serial, false); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+func parseTableFloat(s string) *float64 {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")")
+	s = strings.Trim(s, "()")
+	s = strings.TrimSpace(strings.TrimSuffix(s, "%"))
+
+	f := utils.ParseFloat(s)
+	if f != nil && negative {
+		*f = -*f
+	}
+	return f
+}
@@ -4,6 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -17,29 +20,295 @@ type Config struct {
 	DBDriver     string
 	UserAgent    string
 	LogLevel     string
+	LogFormat    string
+	Fetcher      string
+	ReplayDir    string
+	RecordDir    string
+	ArchiveDir   string
+	DownloadDir  string
+	Concurrency  int
+	RateLimit    float64
+	RateBurst    int
+	HTTPTimeout  time.Duration
+	MetricsAddr  string
+
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+
+	RetryMaxAttempts int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+	RetryCooldown    time.Duration
+
+	BreakerThreshold   int
+	BreakerWindow      time.Duration
+	BreakerCooldown    time.Duration
+	BreakerMaxCooldown time.Duration
+	BreakerMaxTrips    int
+
+	BrowserMaxNavigations int
+	BrowserAcquireTimeout time.Duration
+	BrowserPageTimeout    time.Duration
+
+	ClaimLease time.Duration
+	ClaimBatch int
+
+	DownloadWorkers int
+	DownloadPerHost int
+	DownloadMaxMB   int
+	DownloadTypes   string
+}
+
+// setting describes one configuration key. The same key names the flag and
+// the config file entry.
+type setting struct {
+	key    string
+	env    string
+	usage  string
+	field  func(c *Config) any
+	secret bool
+}
+
+var settings = []setting{
+	{"start-url", "START_URL", "Base Bursa announcements URL", func(c *Config) any { return &c.StartURL }, false},
+	{"detail-domain", "DETAIL_DOMAIN", "Announcement detail URL prefix", func(c *Config) any { return &c.DetailDomain }, false},
+	{"detail-url", "DETAIL_URL", "Announcement detail URL prefix", func(c *Config) any { return &c.DetailURL }, false},
+	{"db-path", "DB_PATH", "Database connection string", func(c *Config) any { return &c.DBPath }, true},
+	{"db-driver", "DB_DRIVER", "Database driver (postgres)", func(c *Config) any { return &c.DBDriver }, false},
+	{"db-max-open-conns", "DB_MAX_OPEN_CONNS", "Max open database connections (0 = unlimited)", func(c *Config) any { return &c.DBMaxOpenConns }, false},
+	{"db-max-idle-conns", "DB_MAX_IDLE_CONNS", "Max idle database connections", func(c *Config) any { return &c.DBMaxIdleConns }, false},
+	{"db-conn-max-lifetime", "DB_CONN_MAX_LIFETIME", "Max lifetime of a database connection (0 = forever)", func(c *Config) any { return &c.DBConnMaxLifetime }, false},
+	{"ua", "UA", "Browser User-Agent", func(c *Config) any { return &c.UserAgent }, false},
+	{"log-level", "LOG_LEVEL", "Log level (debug, info, warn, error)", func(c *Config) any { return &c.LogLevel }, false},
+	{"log-format", "LOG_FORMAT", "Log format (text, json)", func(c *Config) any { return &c.LogFormat }, false},
+	{"fetcher", "FETCHER", "Page fetcher (chrome, http, replay)", func(c *Config) any { return &c.Fetcher }, false},
+	{"replay-dir", "REPLAY_DIR", "Directory of recorded pages served by the replay fetcher", func(c *Config) any { return &c.ReplayDir }, false},
+	{"record-dir", "RECORD_DIR", "Directory to record every fetched page into (optional)", func(c *Config) any { return &c.RecordDir }, false},
+	{"archive-dir", "ARCHIVE_DIR", "Raw page archive directory; pages are kept in announcements.content when empty", func(c *Config) any { return &c.ArchiveDir }, false},
+	{"download-dir", "DOWNLOAD_DIR", "Directory attachments are downloaded into", func(c *Config) any { return &c.DownloadDir }, false},
+	{"http-timeout", "HTTP_TIMEOUT", "Timeout of one plain HTTP request", func(c *Config) any { return &c.HTTPTimeout }, false},
+	{"metrics-addr", "METRICS_ADDR", "Address to serve Prometheus /metrics on, e.g. :9100 (empty = disabled)", func(c *Config) any { return &c.MetricsAddr }, false},
+	{"concurrency", "CONCURRENCY", "Number of concurrent fetch workers", func(c *Config) any { return &c.Concurrency }, false},
+	{"rate-limit", "RATE_LIMIT", "Max requests per second per host (0 = unlimited)", func(c *Config) any { return &c.RateLimit }, false},
+	{"rate-burst", "RATE_BURST", "Request burst allowed per host", func(c *Config) any { return &c.RateBurst }, false},
+	{"retry-max-attempts", "RETRY_MAX_ATTEMPTS", "Fetch attempts per page before giving up", func(c *Config) any { return &c.RetryMaxAttempts }, false},
+	{"retry-base-delay", "RETRY_BASE_DELAY", "Delay before the first retry, doubled per attempt", func(c *Config) any { return &c.RetryBaseDelay }, false},
+	{"retry-max-delay", "RETRY_MAX_DELAY", "Upper bound for the retry delay", func(c *Config) any { return &c.RetryMaxDelay }, false},
+	{"retry-cooldown", "RETRY_COOLDOWN", "Minimum delay after a challenge, block or maintenance page", func(c *Config) any { return &c.RetryCooldown }, false},
+	{"breaker-threshold", "BREAKER_THRESHOLD", "Block/challenge detections within the window that pause the crawl (0 = disabled)", func(c *Config) any { return &c.BreakerThreshold }, false},
+	{"breaker-window", "BREAKER_WINDOW", "Window in which breaker detections are counted", func(c *Config) any { return &c.BreakerWindow }, false},
+	{"breaker-cooldown", "BREAKER_COOLDOWN", "Pause after the first trip, doubled per consecutive trip", func(c *Config) any { return &c.BreakerCooldown }, false},
+	{"breaker-max-cooldown", "BREAKER_MAX_COOLDOWN", "Upper bound for the breaker pause", func(c *Config) any { return &c.BreakerMaxCooldown }, false},
+	{"breaker-max-trips", "BREAKER_MAX_TRIPS", "Consecutive trips before the crawl stops (0 = never)", func(c *Config) any { return &c.BreakerMaxTrips }, false},
+	{"browser-max-navigations", "BROWSER_MAX_NAVIGATIONS", "Pages a Chrome tab loads before it is recycled (0 = never)", func(c *Config) any { return &c.BrowserMaxNavigations }, false},
+	{"browser-acquire-timeout", "BROWSER_ACQUIRE_TIMEOUT", "Max wait for a free Chrome tab", func(c *Config) any { return &c.BrowserAcquireTimeout }, false},
+	{"browser-page-timeout", "BROWSER_PAGE_TIMEOUT", "Deadline for loading one page in Chrome", func(c *Config) any { return &c.BrowserPageTimeout }, false},
+	{"claim-lease", "CLAIM_LEASE", "How long a claimed work item stays leased without a heartbeat", func(c *Config) any { return &c.ClaimLease }, false},
+	{"claim-batch", "CLAIM_BATCH", "Work items claimed at a time", func(c *Config) any { return &c.ClaimBatch }, false},
+	{"download-workers", "DOWNLOAD_WORKERS", "Number of concurrent file downloads", func(c *Config) any { return &c.DownloadWorkers }, false},
+	{"download-per-host", "DOWNLOAD_PER_HOST", "Max concurrent file downloads from one host", func(c *Config) any { return &c.DownloadPerHost }, false},
+	{"download-max-mb", "DOWNLOAD_MAX_MB", "Largest file downloaded, in MB (0 = no limit)", func(c *Config) any { return &c.DownloadMaxMB }, false},
+	{"download-types", "DOWNLOAD_TYPES", "Content types downloaded, comma separated, type/* allowed (empty = any)", func(c *Config) any { return &c.DownloadTypes }, false},
+}
+
+// DefaultConfig returns the built-in defaults, the lowest configuration layer.
+func DefaultConfig() *Config {
+	return &Config{
+		DBDriver:              "postgres",
+		LogLevel:              "info",
+		LogFormat:             "text",
+		DownloadDir:           "attachments",
+		HTTPTimeout:           60 * time.Second,
+		DBMaxOpenConns:        10,
+		DBMaxIdleConns:        2,
+		DBConnMaxLifetime:     30 * time.Minute,
+		Concurrency:           1,
+		RateBurst:             1,
+		RetryMaxAttempts:      3,
+		RetryBaseDelay:        3 * time.Second,
+		RetryMaxDelay:         time.Minute,
+		RetryCooldown:         30 * time.Second,
+		BreakerThreshold:      3,
+		BreakerWindow:         5 * time.Minute,
+		BreakerCooldown:       2 * time.Minute,
+		BreakerMaxCooldown:    30 * time.Minute,
+		BreakerMaxTrips:       5,
+		BrowserMaxNavigations: 200,
+		BrowserAcquireTimeout: 5 * time.Minute,
+		BrowserPageTimeout:    2 * time.Minute,
+		ClaimLease:            10 * time.Minute,
+		ClaimBatch:            100,
+		DownloadWorkers:       4,
+		DownloadPerHost:       2,
+		DownloadMaxMB:         200,
+		DownloadTypes:         "application/pdf,application/zip,application/x-zip-compressed,application/vnd.*,application/msword,application/octet-stream,text/*,image/*",
+	}
+}
+
+// ConfigFlags are the shared configuration flags registered on a flag set.
+type ConfigFlags struct {
+	fs    *flag.FlagSet
+	flags *Config
+	file  string
 }
 
-// Load reads .env and CLI flags, sets defaults, and returns a Config struct
+// Load reads .env, the config file and CLI flags, and returns a Config
+// struct. The config file section used is named after the binary, which is
+// also the stage name the matching bca command reads.
 func LoadCfg() (*Config, error) {
-	// Load from .env (if exists)
+	flags := RegisterConfigFlags(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := flags.Load(filepath.Base(os.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(true); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// RegisterConfigFlags registers the shared configuration flags on fs. .env
+// (if exists) is loaded into the environment straight away.
+func RegisterConfigFlags(fs *flag.FlagSet) *ConfigFlags {
 	_ = godotenv.Load()
 
-	cfg := &Config{}
+	cf := &ConfigFlags{fs: fs, flags: DefaultConfig()}
+	fs.StringVar(&cf.file, "config", os.Getenv("CONFIG_FILE"), "YAML config file")
 
-	flag.StringVar(&cfg.StartURL, "start-url", os.Getenv("START_URL"), "Base Bursa announcements URL")
-	flag.StringVar(&cfg.DetailDomain, "detail-domain", os.Getenv("DETAIL_DOMAIN"), "Announcement detail URL prefix")
-	flag.StringVar(&cfg.DetailURL, "detail-url", os.Getenv("DETAIL_URL"), "Announcement detail URL prefix")
-	flag.StringVar(&cfg.DBPath, "db-path", os.Getenv("DB_PATH"), "SQLite DB file path")
-	flag.StringVar(&cfg.DBDriver, "db-driver", os.Getenv("DB_DRIVER"), "Database driver (sqlite, postgres)")
-	flag.StringVar(&cfg.UserAgent, "ua", os.Getenv("UA"), "Browser User-Agent")
-	flag.StringVar(&cfg.LogLevel, "log-level", os.Getenv("LOG_LEVEL"), "Log level (debug, info, warn, error)")
+	for _, s := range settings {
+		switch p := s.field(cf.flags).(type) {
+		case *string:
+			fs.StringVar(p, s.key, *p, s.usage)
+		case *int:
+			fs.IntVar(p, s.key, *p, s.usage)
+		case *float64:
+			fs.Float64Var(p, s.key, *p, s.usage)
+		case *time.Duration:
+			fs.DurationVar(p, s.key, *p, s.usage)
+		}
+	}
 
-	flag.Parse()
+	return cf
+}
+
+// Load builds the effective configuration once the flag set is parsed,
+// layered as defaults < config file (top level, then the command's section)
+// < environment < flags given on the command line.
+func (cf *ConfigFlags) Load(command string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	if cf.file != "" {
+		if err := loadConfigFile(cfg, cf.file, command); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		v := os.Getenv(s.env)
+		if v == "" {
+			continue
+		}
+		if err := setValue(s.field(cfg), v); err != nil {
+			return nil, fmt.Errorf("[Error] %s: %w", s.env, err)
+		}
+	}
 
-	// Validate
-	if cfg.StartURL == "" || cfg.DetailDomain == "" || cfg.DetailURL == "" {
-		return nil, fmt.Errorf("[Error] missing required URLs")
+	var err error
+	cf.fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.key == f.Name && err == nil {
+				err = setValue(s.field(cfg), f.Value.String())
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return cfg, nil
 }
+
+// Validate checks the configuration and reports every problem at once.
+// Commands that fetch from Bursa set network, which also requires the
+// announcement URLs.
+func (cfg *Config) Validate(network bool) error {
+	var problems []string
+	fail := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if network && (cfg.StartURL == "" || cfg.DetailDomain == "" || cfg.DetailURL == "") {
+		fail("missing required URLs")
+	}
+
+	switch cfg.Fetcher {
+	case "", "chrome", "http":
+	case "replay":
+		if cfg.ReplayDir == "" {
+			fail("replay fetcher requires REPLAY_DIR")
+		}
+	default:
+		fail("unknown fetcher %q", cfg.Fetcher)
+	}
+
+	if cfg.DBDriver != "postgres" {
+		fail("unsupported db-driver %q", cfg.DBDriver)
+	}
+
+	switch cfg.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("unknown log-level %q", cfg.LogLevel)
+	}
+
+	switch cfg.LogFormat {
+	case "text", "json":
+	default:
+		fail("unknown log-format %q", cfg.LogFormat)
+	}
+
+	if cfg.Concurrency < 1 {
+		fail("concurrency must be at least 1")
+	}
+	if cfg.RateLimit < 0 {
+		fail("rate-limit must not be negative")
+	}
+	if cfg.RateBurst < 1 {
+		fail("rate-burst must be at least 1")
+	}
+	if cfg.RetryMaxAttempts < 1 {
+		fail("retry-max-attempts must be at least 1")
+	}
+	if cfg.RetryBaseDelay > cfg.RetryMaxDelay {
+		fail("retry-base-delay %s exceeds retry-max-delay %s", cfg.RetryBaseDelay, cfg.RetryMaxDelay)
+	}
+	if cfg.BreakerCooldown > cfg.BreakerMaxCooldown {
+		fail("breaker-cooldown %s exceeds breaker-max-cooldown %s", cfg.BreakerCooldown, cfg.BreakerMaxCooldown)
+	}
+	if cfg.HTTPTimeout <= 0 {
+		fail("http-timeout must be positive")
+	}
+	if cfg.DBMaxOpenConns < 0 || cfg.DBMaxIdleConns < 0 {
+		fail("db connection limits must not be negative")
+	}
+	if cfg.ClaimLease < time.Minute {
+		fail("claim-lease must be at least 1m")
+	}
+	if cfg.ClaimBatch < 1 {
+		fail("claim-batch must be at least 1")
+	}
+	if cfg.DownloadWorkers < 1 || cfg.DownloadPerHost < 1 {
+		fail("download-workers and download-per-host must be at least 1")
+	}
+	if cfg.DownloadMaxMB < 0 {
+		fail("download-max-mb must not be negative")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("[Error] invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
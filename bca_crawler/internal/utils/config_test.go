@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadTestConfig writes text as the config file and loads it for command
+// with the given command line flags.
+func loadTestConfig(t *testing.T, text, command string, args ...string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cf := RegisterConfigFlags(fs)
+	if err := fs.Parse(append([]string{"-config", path}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return cf.Load(command)
+}
+
+func TestConfigLayers(t *testing.T) {
+	const file = `
+concurrency: 2
+rate-burst: 2
+claim-batch: 50
+download-workers: 6
+commands:
+  crawler:
+    concurrency: 3
+    rate-burst: 3
+    claim-batch: 60
+  parser:
+    download-workers: 9
+`
+	t.Setenv("CONCURRENCY", "4")
+	t.Setenv("RATE_BURST", "4")
+
+	cfg, err := loadTestConfig(t, file, "crawler", "-concurrency", "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key       string
+		got, want int
+	}{
+		{"retry-max-attempts", cfg.RetryMaxAttempts, 3}, // default
+		{"download-workers", cfg.DownloadWorkers, 6},    // top level, another command's section ignored
+		{"claim-batch", cfg.ClaimBatch, 60},             // section over top level
+		{"rate-burst", cfg.RateBurst, 4},                // environment over section
+		{"concurrency", cfg.Concurrency, 5},             // flag over environment
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.key, tt.got, tt.want)
+		}
+	}
+
+	// A command without a section gets the top level
+	cfg, err = loadTestConfig(t, file, "parser-board")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ClaimBatch != 50 || cfg.DownloadWorkers != 6 {
+		t.Errorf("parser-board claim-batch %d download-workers %d, want 50 and 6", cfg.ClaimBatch, cfg.DownloadWorkers)
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name, file, want string
+	}{
+		{"unknown top-level key", "concurency: 2\n", `config.yaml:1: unknown config key "concurency"`},
+		{"unknown key in own section", "commands:\n  crawler:\n    claim-bach: 5\n", `config.yaml:3: unknown config key "claim-bach"`},
+		// Typos in other commands' sections fail every run
+		{"unknown key in other section", "commands:\n  parser:\n    concurrency: 2\n    retry-max: 4\n", `config.yaml:4: unknown config key "retry-max"`},
+		{"bad value in other section", "commands:\n  parser-att:\n    claim-lease: soon\n", `config.yaml:3: claim-lease: invalid duration "soon"`},
+		{"section not a mapping", "commands:\n  parser: 2\n", `section "parser" must be a mapping`},
+		{"list value", "concurrency: [1, 2]\n", "concurrency must be a single value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadTestConfig(t, tt.file, "crawler")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		network bool
+		change  func(c *Config)
+		want    []string
+	}{
+		{"defaults", false, func(c *Config) {}, nil},
+		{"network without urls", true, func(c *Config) {}, []string{"missing required URLs"}},
+		{"network", true, func(c *Config) {
+			c.StartURL, c.DetailDomain, c.DetailURL = "https://www.bursamalaysia.com", "https://disclosure.bursamalaysia.com", "/FileAccess/viewHtml?e="
+		}, nil},
+		{"replay without dir", false, func(c *Config) { c.Fetcher = "replay" }, []string{"replay fetcher requires REPLAY_DIR"}},
+		{"unknown fetcher", false, func(c *Config) { c.Fetcher = "curl" }, []string{`unknown fetcher "curl"`}},
+		{"short lease", false, func(c *Config) { c.ClaimLease = 30 * time.Second }, []string{"claim-lease must be at least 1m"}},
+		{
+			// Every problem is reported at once
+			"several", false, func(c *Config) {
+				c.LogLevel = "trace"
+				c.Concurrency = 0
+				c.RetryBaseDelay = 2 * time.Minute
+				c.DownloadMaxMB = -1
+			},
+			[]string{`unknown log-level "trace"`, "concurrency must be at least 1", "retry-base-delay 2m0s exceeds retry-max-delay 1m0s", "download-max-mb must not be negative"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.change(cfg)
+			err := cfg.Validate(tt.network)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate = nil, want %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
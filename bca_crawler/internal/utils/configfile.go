@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfigFile applies a YAML config file onto cfg: the top-level keys
+// first, then those of commands.<command>. Keys are the flag names, and any
+// unknown key or malformed value is an error, in every section.
+//
+//	concurrency: 2
+//	commands:
+//	  crawler:
+//	    concurrency: 8
+func loadConfigFile(cfg *Config, path, command string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("[Error] read config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("[Error] parse config file %s: %w", path, err)
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return fmt.Errorf("[Error] %s:%d: config file must be a mapping", path, doc.Line)
+	}
+
+	var section *yaml.Node
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+		if key.Value != "commands" {
+			if err := applyConfigNode(cfg, path, key, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if value.Kind != yaml.MappingNode {
+			return fmt.Errorf("[Error] %s:%d: commands must be a mapping", path, value.Line)
+		}
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			name, body := value.Content[j], value.Content[j+1]
+			if body.Kind != yaml.MappingNode {
+				return fmt.Errorf("[Error] %s:%d: section %q must be a mapping", path, body.Line, name.Value)
+			}
+			if name.Value == command {
+				section = body
+				continue
+			}
+
+			// Check the other sections too, so typos surface on any run
+			scratch := DefaultConfig()
+			for k := 0; k+1 < len(body.Content); k += 2 {
+				if err := applyConfigNode(scratch, path, body.Content[k], body.Content[k+1]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if section != nil {
+		for i := 0; i+1 < len(section.Content); i += 2 {
+			if err := applyConfigNode(cfg, path, section.Content[i], section.Content[i+1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func applyConfigNode(cfg *Config, path string, key, value *yaml.Node) error {
+	s, ok := lookupSetting(key.Value)
+	if !ok {
+		return fmt.Errorf("[Error] %s:%d: unknown config key %q", path, key.Line, key.Value)
+	}
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("[Error] %s:%d: %s must be a single value", path, value.Line, key.Value)
+	}
+	if err := setValue(s.field(cfg), value.Value); err != nil {
+		return fmt.Errorf("[Error] %s:%d: %s: %w", path, value.Line, key.Value, err)
+	}
+	return nil
+}
+
+func lookupSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// setValue parses v into the Config field p points to.
+func setValue(p any, v string) error {
+	switch p := p.(type) {
+	case *string:
+		*p = v
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		*p = n
+	case *float64:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		*p = f
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		*p = d
+	default:
+		return fmt.Errorf("unsupported setting type %T", p)
+	}
+	return nil
+}
+
+// Redacted returns a copy of cfg that is safe to log, with secrets masked.
+func (cfg *Config) Redacted() Config {
+	c := *cfg
+	for _, s := range settings {
+		if p, ok := s.field(&c).(*string); ok && s.secret {
+			*p = RedactDSN(*p)
+		}
+	}
+	return c
+}
+
+// IsSecretSetting reports whether the setting key holds a secret.
+func IsSecretSetting(key string) bool {
+	for _, s := range settings {
+		if s.key == key {
+			return s.secret
+		}
+	}
+	return false
+}
+
+var dsnPassword = regexp.MustCompile(`(?i)(password=)\S+`)
+
+// RedactDSN masks the password of a URL or key=value connection string.
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+			return u.String()
+		}
+		return dsn
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}xxxxx")
+}
+
+// WriteYAML writes the configuration in config file format, secrets
+// redacted.
+func (cfg *Config) WriteYAML(w io.Writer) error {
+	c := cfg.Redacted()
+
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range settings {
+		var value string
+		switch p := s.field(&c).(type) {
+		case *string:
+			value = *p
+		case *int:
+			value = strconv.Itoa(*p)
+		case *float64:
+			value = strconv.FormatFloat(*p, 'g', -1, 64)
+		case *time.Duration:
+			value = p.String()
+		}
+
+		doc.Content = append(doc.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: s.key},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: value},
+		)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
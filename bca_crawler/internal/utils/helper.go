@@ -139,6 +139,11 @@ func Int64Value(i *int64) int64 {
 	return *i
 }
 
+// PtrInt returns a pointer to the given int.
+func PtrInt(i int) *int {
+	return &i
+}
+
 // PtrInt64 returns a pointer to the given int64.
 func PtrInt64(i int64) *int64 {
 	return &i
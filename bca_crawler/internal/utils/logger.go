@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -13,8 +15,41 @@ import (
 // Logger is the global structured logger used across all files
 var Logger = logrus.New()
 
-// InitLogger sets up logrus with both file and console output, rotation, compression, timestamps
-func InitLogger() {
+// RunID identifies this process's run and is attached to every log entry as
+// run_id.
+var RunID = newRunID()
+
+// Contextual log fields, attached with WithField on the logger handed down to
+// the services.
+const (
+	FieldRunID     = "run_id"
+	FieldStage     = "stage"
+	FieldAnnID     = "ann_id"
+	FieldStockCode = "stock_code"
+)
+
+// newRunID returns a sortable ID such as 20260117-093000-1a2b3c.
+func newRunID() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// runIDHook adds run_id to every entry.
+type runIDHook struct{}
+
+func (runIDHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (runIDHook) Fire(e *logrus.Entry) error {
+	if _, ok := e.Data[FieldRunID]; !ok {
+		e.Data[FieldRunID] = RunID
+	}
+	return nil
+}
+
+// InitLogger sets up logrus with both file and console output, rotation, compression, timestamps.
+// The level and format (text or json) come from cfg; a nil cfg logs text at info.
+func InitLogger(cfg *Config) {
 	logDir := "logs"
 	if _, err := os.Stat(logDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(logDir, 0755); err != nil {
@@ -35,14 +70,30 @@ func InitLogger() {
 	multiWriter := io.MultiWriter(os.Stdout, fileWriter)
 	Logger.SetOutput(multiWriter)
 
-	Logger.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp:   true,
-		TimestampFormat: "2006-01-02 15:04:05",
-		DisableColors:   true,
-		PadLevelText:    true,
-	})
+	if cfg != nil && cfg.LogFormat == "json" {
+		Logger.SetFormatter(&logrus.JSONFormatter{
+			TimestampFormat: time.RFC3339,
+		})
+	} else {
+		Logger.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: "2006-01-02 15:04:05",
+			DisableColors:   true,
+			PadLevelText:    true,
+		})
+	}
+
+	level := logrus.InfoLevel
+	if cfg != nil && cfg.LogLevel != "" {
+		if l, err := logrus.ParseLevel(cfg.LogLevel); err == nil {
+			level = l
+		}
+	}
+	Logger.SetLevel(level)
+
+	Logger.ReplaceHooks(logrus.LevelHooks{})
+	Logger.AddHook(runIDHook{})
 
-	Logger.SetLevel(logrus.InfoLevel)
 	Logger.Info("----------------------------------------------------------")
 	Logger.Infof("Log started at %s", time.Now().Format(time.RFC1123))
 	Logger.Info("----------------------------------------------------------")